@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	gecko "github.com/superoo7/go-gecko/v3"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+const backfillUsage = `usage: price-oracle-server backfill -tokens <tokens> [-from <time>] [-to <time>]
+
+Fills the price history of the given tokens, e.g. atom,osmo, between from and
+to (unix seconds or RFC 3339, both inclusive) with Coingecko market charts.
+to defaults to now, from to 90 days before to. An interrupted backfill resumes
+where it stopped when started again, with the same range or the default one.
+
+flags:
+`
+
+// runBackfill implements the backfill subcommand. args are the arguments
+// following "backfill".
+func runBackfill(h *store.Handler, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), backfillUsage)
+		fs.PrintDefaults()
+	}
+	tokensFlag := fs.String("tokens", "", "comma separated tokens to backfill")
+	fromFlag := fs.String("from", "", "start of the range, 90 days before -to if empty")
+	toFlag := fs.String("to", "", "end of the range, now if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	var tokens []string
+	for _, t := range strings.Split(*tokensFlag, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("no tokens to backfill")
+	}
+	var err error
+	to := time.Now().Unix()
+	if *toFlag != "" {
+		if to, err = parseTime(*toFlag); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	from := to - int64((90 * 24 * time.Hour).Seconds())
+	if *fromFlag != "" {
+		if from, err = parseTime(*fromFlag); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return h.Backfill(ctx, gecko.NewClient(&http.Client{Timeout: h.Cfg.HttpClientTimeout}), tokens, from, to)
+}
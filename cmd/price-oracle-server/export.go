@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/export"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+const exportUsage = `usage: price-oracle-server export -symbols <symbols> -o <file> [-from <time>] [-to <time>] [-format <format>]
+
+Writes the price history of the given symbols, e.g. ATOMUSDT,USDEUR, between
+from and to (unix seconds or RFC 3339, both inclusive), as csv, jsonl or
+parquet. to defaults to now, from to 24 hours before to, and the range can
+not be longer than 366 days. The export is written to a file, logs go to the
+standard output.
+
+flags:
+`
+
+// runExport implements the export subcommand. args are the arguments
+// following "export".
+func runExport(db store.Store, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), exportUsage)
+		fs.PrintDefaults()
+	}
+	symbols := fs.String("symbols", "", "comma separated symbols to export")
+	fromFlag := fs.String("from", "", "start of the range, 24 hours before -to if empty")
+	toFlag := fs.String("to", "", "end of the range, now if empty")
+	formatFlag := fs.String("format", string(export.FormatCSV), "csv, jsonl or parquet")
+	out := fs.String("o", "", "output file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	if *out == "" {
+		return fmt.Errorf("missing output file -o")
+	}
+
+	format, err := export.ParseFormat(*formatFlag)
+	if err != nil {
+		return err
+	}
+	req := export.Request{Format: format}
+	for _, s := range strings.Split(*symbols, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			req.Symbols = append(req.Symbols, strings.ToUpper(s))
+		}
+	}
+	if len(req.Symbols) == 0 {
+		return fmt.Errorf("no symbols to export")
+	}
+	var from, to *int64
+	if *toFlag != "" {
+		t, err := parseTime(*toFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+		to = &t
+	}
+	if *fromFlag != "" {
+		f, err := parseTime(*fromFlag)
+		if err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+		from = &f
+	}
+	if req.From, req.To, err = export.Range(from, to, time.Now()); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+	w := bufio.NewWriter(f)
+	if err := export.Write(context.Background(), db, w, req); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// parseTime parses s as unix seconds or as an RFC 3339 time.
+func parseTime(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither unix seconds nor RFC 3339", s)
+	}
+	return t.Unix(), nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"sync"
@@ -9,16 +11,23 @@ import (
 	"time"
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/priceprovider"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/rediscache"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/rest"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/sql"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
 	"github.com/emerishq/emeris-utils/logging"
 	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
 )
 
 var Version = "not specified"
 
+// shutdownTimeout bounds how long the REST server takes to shut down.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	cfg, err := config.Read()
 	if err != nil {
@@ -32,17 +41,88 @@ func main() {
 
 	logger.Infow("price-oracle-server", "version", Version)
 
-	db, err := sql.NewDB(cfg.DatabaseConnectionURL)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		db, err := newStore(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		sqlDB, ok := db.(*sql.SqlDB)
+		if !ok {
+			logger.Fatalf("migrate needs an SQL store backend, got %s", cfg.StoreBackend)
+		}
+		if err := runMigrate(sqlDB, os.Args[2:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		db, err := newStore(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		err = runExport(db, os.Args[2:])
+		if closeErr := db.Close(); closeErr != nil {
+			logger.Errorw("store close", "error", closeErr)
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		db, err := newStore(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		storeHandler, err := store.NewStoreHandler(
+			store.WithDB(context.Background(), db),
+			store.WithConfig(cfg),
+			store.WithLogger(logger),
+			store.WithSpotPriceCache(nil),
+		)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if err := runBackfill(storeHandler, os.Args[2:]); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	db, err := newStore(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infow("store", "backend", cfg.StoreBackend)
+
+	cacheBackend, err := newCacheBackend(cfg)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	logger.Infow("cache", "backend", cfg.CacheBackend)
+
+	// A worker failing more than cfg.RecoverCount times is stopped, /ready
+	// then fails so that the replica no longer gets requests, until the
+	// worker is restarted.
+	restartPolicy := daemon.RestartPolicy{
+		InitialBackoff: cfg.RestartBackoff,
+		MaxBackoff:     cfg.RestartMaxBackoff,
+		FailureWindow:  cfg.RecoverWindow,
+		OnTerminal: func(name string, err error) {
+			logger.Errorw("worker stopped", "worker", name, "error", err)
+		},
+	}
 
 	storeHandler, err := store.NewStoreHandler(
 		store.WithDB(context.Background(), db),
 		store.WithConfig(cfg),
 		store.WithLogger(logger),
 		store.WithSpotPriceCache(nil),
-		store.WithChartDataCache(nil, time.Minute*5),
+		store.WithChartDataCache(nil, cfg.ChartCacheMaxBytes),
+		store.WithCacheBackend(cacheBackend),
+		store.WithRestartPolicy(restartPolicy),
 	)
 	if err != nil {
 		logger.Fatal(err)
@@ -77,32 +157,130 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	restServer := rest.NewServer(storeHandler, logger, cfg)
+	if err := storeHandler.Start(ctx); err != nil {
+		logger.Fatal(err)
+	}
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		store.StartAggregate(ctx, storeHandler)
+		priceprovider.StartSubscription(ctx, storeHandler)
 	}()
 	go func() {
 		defer wg.Done()
-		priceprovider.StartSubscription(ctx, storeHandler)
+		handleWorkerSignals(ctx, storeHandler.Workers, logger)
 	}()
 
-	restServer := rest.NewServer(storeHandler, logger, cfg)
-	fatalErr := make(chan error)
+	// Serve returns nil once shutdown stops the REST server.
+	fatalErr := make(chan error, 1)
 	go func() {
 		fatalErr <- restServer.Serve(cfg.ListenAddr)
 	}()
+	go func() {
+		// Serve with cold caches rather than not at all if the warmup fails.
+		if cfg.WarmupTimeout > 0 {
+			warmupCtx, cancel := context.WithTimeout(ctx, cfg.WarmupTimeout)
+			defer cancel()
+			if err := storeHandler.Warmup(warmupCtx); err != nil {
+				logger.Warnw("cache warmup failed", "error", err)
+			}
+		}
+		restServer.SetReady()
+	}()
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	select {
 	case <-quit:
 		logger.Info("Shutting down server...")
-		cancel()
-		wg.Wait()
+		shutdown(cancel, &wg, restServer, storeHandler, db, cacheBackend, logger)
 	case err := <-fatalErr:
-		cancel()
-		wg.Wait()
+		shutdown(cancel, &wg, restServer, storeHandler, db, cacheBackend, logger)
 		logger.Panicw("rest http server error", "error", err)
 	}
 }
+
+// shutdown stops the subscriptions, the REST server and the backfill started
+// through it, then the background tasks of the store handler, waits for them
+// to return, and closes the cache backend and the store. The REST server is
+// stopped first so that no request uses the store handler once closed.
+func shutdown(
+	cancel context.CancelFunc,
+	wg *sync.WaitGroup,
+	restServer *rest.Server,
+	storeHandler *store.Handler,
+	db store.Store,
+	cacheBackend store.CacheBackend,
+	logger *zap.SugaredLogger,
+) {
+	cancel()
+	wg.Wait()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := restServer.Shutdown(shutdownCtx); err != nil {
+		logger.Errorw("rest server shutdown", "error", err)
+	}
+	if err := storeHandler.Close(); err != nil {
+		logger.Errorw("store handler close", "error", err)
+	}
+	if c, ok := cacheBackend.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			logger.Errorw("cache backend close", "error", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		logger.Errorw("store close", "error", err)
+	}
+	logger.Info("Background tasks stopped")
+}
+
+// newStore returns the store selected by cfg.StoreBackend.
+func newStore(cfg *config.Config) (store.Store, error) {
+	switch cfg.StoreBackend {
+	case config.StoreBackendMemory:
+		db := memory.NewDB()
+		if cfg.CNSDataFile != "" {
+			if err := db.LoadCNSFile(cfg.CNSDataFile); err != nil {
+				return nil, err
+			}
+		}
+		return db, nil
+	case config.StoreBackendPostgres:
+		return sql.NewWithDialect(cfg.DatabaseConnectionURL, sql.DialectPostgres, sqlOptions(cfg)...)
+	case config.StoreBackendSQLite:
+		return sql.NewWithDialect(cfg.DatabaseConnectionURL, sql.DialectSQLite, sqlOptions(cfg)...)
+	default:
+		return sql.NewDB(cfg.DatabaseConnectionURL, sqlOptions(cfg)...)
+	}
+}
+
+// newCacheBackend returns the cache backend configured by cfg, nil when the
+// caches are only in memory.
+func newCacheBackend(cfg *config.Config) (store.CacheBackend, error) {
+	if cfg.CacheBackend != config.CacheBackendRedis {
+		return nil, nil
+	}
+	c, err := rediscache.NewFromURL(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Ping(ctx); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("redis cache backend: %w", err)
+	}
+	return c, nil
+}
+
+// sqlOptions returns the connection pool options of the SQL store backends.
+func sqlOptions(cfg *config.Config) []sql.Option {
+	opts := []sql.Option{
+		sql.WithMaxConns(cfg.DatabaseMaxConns),
+		sql.WithReadPool(cfg.DatabaseReadConnectionURL, cfg.DatabaseReadMaxConns),
+	}
+	if cfg.FollowerReads {
+		opts = append(opts, sql.WithFollowerReads(cfg.FollowerReadStaleness))
+	}
+	return opts
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/sql"
+)
+
+const migrateUsage = `usage: price-oracle-server migrate <command>
+
+commands:
+  up [n]      apply the next n pending migrations, all of them if n is omitted
+  down [n]    roll back the last n applied migrations, 1 if n is omitted
+  status      show which migrations are applied
+`
+
+// runMigrate implements the migrate subcommand. args are the arguments
+// following "migrate".
+func runMigrate(db *sql.SqlDB, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("invalid arguments\n%s", migrateUsage)
+	}
+
+	steps := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of migrations %q\n%s", args[1], migrateUsage)
+		}
+		steps = n
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx, steps)
+		for _, v := range applied {
+			fmt.Printf("applied migration %d\n", v)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migration")
+		}
+		return err
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		reverted, err := db.MigrateDown(ctx, steps)
+		for _, v := range reverted {
+			fmt.Printf("rolled back migration %d\n", v)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Println("no applied migration")
+		}
+		return err
+	case "status":
+		if len(args) != 1 {
+			return fmt.Errorf("invalid arguments\n%s", migrateUsage)
+		}
+		status, err := db.MigrationsStatus(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], migrateUsage)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+)
+
+// signalControlTimeout bounds the wait for the daemons to apply an action
+// asked by a signal.
+const signalControlTimeout = 10 * time.Second
+
+// handleWorkerSignals controls the workers of registry on signals, until ctx
+// is done:
+//   - SIGUSR1 logs the status of every worker.
+//   - SIGUSR2 pauses every running worker, or resumes every paused worker
+//     when none is running.
+func handleWorkerSignals(ctx context.Context, registry *daemon.Registry, logger *zap.SugaredLogger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			switch sig {
+			case syscall.SIGUSR1:
+				for _, status := range registry.All() {
+					logger.Infow("worker status", "worker", status.Name, "status", status)
+				}
+			case syscall.SIGUSR2:
+				action := daemon.ActionPause
+				if !anyRunning(registry) {
+					action = daemon.ActionResume
+				}
+				controlCtx, cancel := context.WithTimeout(ctx, signalControlTimeout)
+				err := registry.ControlAll(controlCtx, action)
+				cancel()
+				if err != nil {
+					logger.Errorw("worker control", "action", action, "error", err)
+					continue
+				}
+				logger.Infow("worker control", "action", action)
+			}
+		}
+	}
+}
+
+// anyRunning tells whether a worker of registry is running.
+func anyRunning(registry *daemon.Registry) bool {
+	for _, status := range registry.All() {
+		if status.Running {
+			return true
+		}
+	}
+	return false
+}
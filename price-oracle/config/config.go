@@ -8,10 +8,20 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+const (
+	StoreBackendSQL      = "sql"
+	StoreBackendPostgres = "postgres"
+	StoreBackendSQLite   = "sqlite"
+	StoreBackendMemory   = "memory"
+
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
 type Config struct {
 	Debug                 bool
 	LogPath               string
-	DatabaseConnectionURL string        `validate:"required"`
+	DatabaseConnectionURL string        `validate:"required_unless=StoreBackend memory"`
 	ListenAddr            string        `validate:"required"`
 	Interval              string        `validate:"required"`
 	WhitelistedFiats      []string      `validate:"required"`
@@ -21,6 +31,95 @@ type Config struct {
 	WorkerPulse           time.Duration `validate:"required"`
 	HttpClientTimeout     time.Duration `validate:"required"`
 
+	// StoreBackend is where prices are stored: "sql" (the default, CockroachDB),
+	// "postgres", "sqlite" or "memory". For sqlite, DatabaseConnectionURL is the
+	// path of the database file. The memory backend loses everything on restart
+	// and is meant for local development, CNS data is then read from the JSON
+	// file CNSDataFile.
+	StoreBackend string `validate:"omitempty,oneof=sql postgres sqlite memory"`
+	CNSDataFile  string
+
+	// DatabaseMaxConns is the size of the pool used by the providers and the
+	// aggregators. REST reads use their own pool of DatabaseReadMaxConns
+	// connections, to DatabaseReadConnectionURL if set, e.g. a read replica,
+	// else to DatabaseConnectionURL. With FollowerReads, REST reads are
+	// CockroachDB follower reads, FollowerReadStaleness old, or as old as
+	// follower_read_timestamp() if it is zero.
+	DatabaseMaxConns          int `validate:"gt=0"`
+	DatabaseReadMaxConns      int `validate:"gt=0"`
+	DatabaseReadConnectionURL string
+	FollowerReads             bool
+	FollowerReadStaleness     time.Duration `validate:"gte=0"`
+
+	// AdminToken authenticates the admin endpoints, e.g. /export, which
+	// callers must send as "Authorization: Bearer <AdminToken>". Admin
+	// endpoints are disabled when it is empty.
+	AdminToken string
+
+	// BackfillRequestInterval is the minimum time between two Coingecko
+	// requests of a price history backfill, to stay below its rate limit.
+	BackfillRequestInterval time.Duration `validate:"gte=0"`
+
+	// AuditRetention is how long the entries of the price audit log, raw
+	// provider quotes and aggregation decisions, are kept. Zero keeps them
+	// forever.
+	AuditRetention time.Duration `validate:"gte=0"`
+
+	// AuditChangesOnly records a provider quote, or the aggregation of a
+	// symbol, in the audit log only when it changed since the last one
+	// recorded. Every quote and every aggregation is recorded when false.
+	AuditChangesOnly bool
+
+	// ChainSupplyInterval is how often the total supply of the CNS tokens is
+	// read from the bank module of their chain. ChainSupplyTokens are the
+	// tickers, e.g. atom, whose supply is the on-chain supply rather than the
+	// Coingecko circulating supply. A zero ChainSupplyInterval disables
+	// on-chain supplies.
+	ChainSupplyInterval time.Duration `validate:"gte=0"`
+	ChainSupplyTokens   []string
+
+	// ChartCacheMaxBytes is how much memory, in bytes, the in-memory cache of
+	// the /chart responses can use. The least recently used charts are
+	// evicted beyond it.
+	ChartCacheMaxBytes int64 `validate:"gte=0"`
+
+	// CacheBackend is where the spot prices and the chart data are cached:
+	// "memory" (the default), in each replica, or "redis", shared by the
+	// replicas through the Redis server at RedisURL, e.g.
+	// redis://:password@localhost:6379/0. The in-memory caches stay in front
+	// of Redis.
+	CacheBackend string `validate:"omitempty,oneof=memory redis"`
+	RedisURL     string `validate:"required_if=CacheBackend redis"`
+
+	// ChangePollInterval is how often the aggregated prices are read to
+	// update the cached prices changed by other replicas. Zero disables
+	// it, the changes written by the replica itself are always applied.
+	ChangePollInterval time.Duration `validate:"gte=0"`
+
+	// WarmupTimeout bounds the loading of the spot prices and the gecko ids
+	// in the caches at startup, /ready fails until it is done. Zero skips the
+	// warmup.
+	WarmupTimeout time.Duration `validate:"gte=0"`
+
+	// Every ChartPrefetchInterval, the ChartPrefetchCount most requested
+	// charts are refreshed if they are about to expire from the chart cache.
+	// A zero ChartPrefetchCount disables the prefetch.
+	ChartPrefetchInterval time.Duration `validate:"gte=0"`
+	ChartPrefetchCount    int           `validate:"gte=0"`
+
+	// SubscriptionTimeout bounds a call of a price provider. Every provider
+	// runs under a daemon, which restarts it when it hangs longer, and up to
+	// RecoverCount times when it panics.
+	SubscriptionTimeout time.Duration `validate:"gte=0"`
+
+	// A worker is restarted RestartBackoff after it failed, doubled with
+	// every failure within RecoverWindow, up to RestartMaxBackoff. Only the
+	// failures within RecoverWindow count against RecoverCount, zero counts
+	// them all. A worker failing more is stopped and /ready fails.
+	RestartBackoff    time.Duration `validate:"gte=0"`
+	RestartMaxBackoff time.Duration `validate:"gte=0"`
+	RecoverWindow     time.Duration `validate:"gte=0"`
+
 	SentryDSN              string
 	SentryEnvironment      string
 	SentrySampleRate       float64
@@ -47,8 +146,24 @@ func Read() (*Config, error) {
 	var c Config
 
 	return &c, configuration.ReadConfig(&c, "emeris-price-oracle", map[string]string{
-		"SentryEnvironment":      "notset",
-		"SentrySampleRate":       "1.0",
-		"SentryTracesSampleRate": "0.3",
+		"StoreBackend":            StoreBackendSQL,
+		"DatabaseMaxConns":        "25",
+		"DatabaseReadMaxConns":    "25",
+		"BackfillRequestInterval": "6s",
+		"AuditRetention":          "168h",
+		"ChainSupplyInterval":     "5m",
+		"ChartCacheMaxBytes":      "268435456",
+		"CacheBackend":            CacheBackendMemory,
+		"WarmupTimeout":           "30s",
+		"ChangePollInterval":      "2s",
+		"ChartPrefetchInterval":   "1m",
+		"ChartPrefetchCount":      "20",
+		"SubscriptionTimeout":     "1m",
+		"RestartBackoff":          "1s",
+		"RestartMaxBackoff":       "1m",
+		"RecoverWindow":           "10m",
+		"SentryEnvironment":       "notset",
+		"SentrySampleRate":        "1.0",
+		"SentryTracesSampleRate":  "0.3",
 	})
 }
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// Action is a command to the daemon of a worker, see Registry.Control.
+type Action string
+
+const (
+	// ActionPause stops the worker until it is resumed or restarted.
+	ActionPause Action = "pause"
+	// ActionResume starts a paused worker again.
+	ActionResume Action = "resume"
+	// ActionTrigger makes the worker run now rather than at its next tick.
+	ActionTrigger Action = "trigger"
+	// ActionRestart restarts the worker now, without counting it as a
+	// failure. A terminated worker is restarted with its past failures
+	// forgotten, it is the only action it accepts.
+	ActionRestart Action = "restart"
+)
+
+var (
+	ErrUnknownWorker = errors.New("daemon: unknown worker")
+	ErrUnknownAction = errors.New("daemon: unknown action")
+	// ErrWorkerStopped is returned for a terminated worker, or one whose
+	// daemon returned.
+	ErrWorkerStopped    = errors.New("daemon: worker stopped")
+	ErrWorkerNotRunning = errors.New("daemon: worker not running")
+)
+
+// command is an Action sent to a daemon, which replies with its outcome.
+type command struct {
+	action Action
+	reply  chan error
+}
+
+type triggerKey struct{}
+
+// Triggered returns a channel receiving a value when the worker is asked to
+// run now, nil when ctx is not the context of a worker started by a daemon.
+// Workers select on it next to their ticker.
+func Triggered(ctx context.Context) <-chan struct{} {
+	trigger, _ := ctx.Value(triggerKey{}).(<-chan struct{})
+	return trigger
+}
+
+// Control sends action to the daemon of the worker called name, and returns
+// its outcome. It fails if the daemon is busy until ctx is done.
+func (r *Registry) Control(ctx context.Context, name string, action Action) error {
+	if r == nil {
+		return ErrUnknownWorker
+	}
+	r.mu.RLock()
+	control, ok := r.controls[name]
+	_, known := r.workers[name]
+	r.mu.RUnlock()
+	if !ok {
+		if known {
+			return ErrWorkerStopped
+		}
+		return ErrUnknownWorker
+	}
+
+	cmd := command{action: action, reply: make(chan error, 1)}
+	select {
+	case control <- cmd:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-cmd.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ControlAll sends action to the daemons of all the workers which are not
+// stopped, nor terminated unless action is ActionRestart, and returns the
+// first error.
+func (r *Registry) ControlAll(ctx context.Context, action Action) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	names := make([]string, 0, len(r.controls))
+	for name := range r.controls {
+		if r.workers[name].Terminated && action != ActionRestart {
+			continue
+		}
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	var firstErr error
+	for _, name := range names {
+		if err := r.Control(ctx, name, action); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// register returns the channel the daemon of the worker called name reads
+// its commands from, nil for a nil Registry.
+func (r *Registry) register(name string) chan command {
+	if r == nil {
+		return nil
+	}
+	control := make(chan command)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.controls[name] = control
+	return control
+}
+
+// unregister forgets control, once its daemon returned.
+func (r *Registry) unregister(name string, control chan command) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.controls[name] == control {
+		delete(r.controls, name)
+	}
+}
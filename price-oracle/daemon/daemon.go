@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"math/big"
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"time"
 
@@ -29,6 +31,23 @@ type (
 // ErrWorkerRestarted is used to indicate a restarting process is taking place.
 var ErrWorkerRestarted = errors.New("daemon: process not responsive; restarting")
 
+// ErrWorkerPanicked is wrapped by the errors of the panics recovered by Recover.
+var ErrWorkerPanicked = errors.New("daemon: worker panicked")
+
+// Recover wraps fn so that a panic in fn is returned as an error wrapping
+// ErrWorkerPanicked, with the stack of the panic, instead of crashing the
+// process.
+func Recover(fn AggFunc) AggFunc {
+	return func(ctx context.Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %s: %v\n%s", ErrWorkerPanicked, GetFunctionName(fn), r, debug.Stack())
+			}
+		}()
+		return fn(ctx)
+	}
+}
+
 // or takes an arbitrary number of channels (param:<chans>) and return a channel
 // named orDone. If any of the channels in (param:<chans>) is closed, orDone
 // is also closed.
@@ -67,19 +86,32 @@ func or(chans ...chan struct{}) chan struct{} {
 // MakeDaemon takes a WorkerFunc (param:<worker>) and wraps it with self-healing
 // daemon-like functionality. When the worker is not responsive for a certain timeout
 // period (param:<timeout>), it restarts the worker. It also has a (param:<recoverCount>)
-// which indicates on how many times it will recover from errors caused by the worker.
+// which indicates on how many times it will recover from errors caused by the worker,
+// within the failure window of its RestartPolicy given with WithRestartPolicy.
+//
+// A worker with more fatal errors than (param:<recoverCount>) is terminated:
+// the daemon stops it and keeps running, so that it can still be restarted
+// with ActionRestart.
 //
 // (param:<recoverCount>) can have one of 3 types of values.
 //		1. Value 0, which means do not numRecover from fatal error.
 //		2. Negative value, means always numRecover from fatal error.
 // 		3. Positive value, self explaining.
 //
-// Right now heartbeat from the worker only indicates liveliness. In the future we plan to
-// include meaningful data for monitoring/sampling.
+// Workers beat with a Heartbeat, or any other value which then only indicates
+// liveliness. The daemon beats with the WorkerStatus of the worker, also kept
+// in the Registry given with WithRegistry.
+//
+// The worker can be paused, resumed, triggered and restarted through the
+// Registry, see Registry.Control. Workers run when Triggered fires.
 //
 // Info: daemon's pulse should be at least 2* the pulse of the worker.
 // So that worker does not compete with the daemon when trying to notify.
-func MakeDaemon(timeout time.Duration, recoverCount int, worker WorkerFunc) WorkerFunc {
+func MakeDaemon(timeout time.Duration, recoverCount int, worker WorkerFunc, opts ...Option) WorkerFunc {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 	return func(
 		ctx context.Context,
 		done chan struct{},
@@ -98,14 +130,68 @@ func MakeDaemon(timeout time.Duration, recoverCount int, worker WorkerFunc) Work
 				workerDone      chan struct{}
 				workerHeartbeat <-chan interface{}
 				workerFatalErr  <-chan error
+				// timeoutSignal fires when the running worker did not beat for
+				// timeout. restartSignal fires when the backoff before a restart
+				// is over. Both are nil when not waited for.
+				timeoutSignal <-chan time.Time
+				restartSignal <-chan time.Time
 			)
 			// initialised in the past, so the first heartbeat log is never skipped.
 			prevHbLogTime := time.Now().Add(-(61 * time.Second))
 
+			status := WorkerStatus{Name: o.name}
+			if status.Name == "" {
+				status.Name = GetFunctionName(fn)
+			}
+			control := o.registry.register(status.Name)
+			defer func() {
+				o.registry.unregister(status.Name, control)
+				status.Running = false
+				o.registry.set(status)
+			}()
+			// prev is the Heartbeat of the worker when it was last started, its
+			// counters are added to the ones of the running worker.
+			var prev Heartbeat
+			// The worker reads trigger through Triggered, it outlives restarts.
+			trigger := make(chan struct{}, 1)
+			workerCtx := context.WithValue(ctx, triggerKey{}, (<-chan struct{})(trigger))
+
 			startWorker := func() {
 				logger.Infow("Daemon", "starts function:", GetFunctionName(fn))
 				workerDone = make(chan struct{})
-				workerHeartbeat, workerFatalErr = worker(ctx, or(workerDone, done), pulseInterval, logger, cfg, fn)
+				workerHeartbeat, workerFatalErr = worker(workerCtx, or(workerDone, done), pulseInterval, logger, cfg, fn)
+				timeoutSignal = time.After(timeout)
+				restartSignal = nil
+				status.Running = true
+				status.Paused = false
+				prev = status.Heartbeat
+				o.registry.set(status)
+			}
+			stopWorker := func() {
+				if status.Running {
+					close(workerDone)
+				}
+				workerHeartbeat, workerFatalErr = nil, nil
+				timeoutSignal, restartSignal = nil, nil
+				status.Running = false
+			}
+			// Every restart counts for the backoff, only fatal errors count
+			// against recoverCount.
+			restarts := failures{window: o.policy.FailureWindow}
+			fatalErrs := failures{window: o.policy.FailureWindow}
+			// restartWorker stops the failed worker and starts it again after
+			// the backoff.
+			restartWorker := func() {
+				stopWorker()
+				status.Restarts++
+				backoff := o.policy.backoff(restarts.add(time.Now()))
+				if backoff <= 0 {
+					startWorker()
+					return
+				}
+				logger.Infow("Daemon", "restarts function:", GetFunctionName(fn), "backoff", backoff)
+				restartSignal = time.After(backoff)
+				o.registry.set(status)
 			}
 			startWorker()
 
@@ -125,48 +211,109 @@ func MakeDaemon(timeout time.Duration, recoverCount int, worker WorkerFunc) Work
 			pulse := time.NewTicker((2 * pulseInterval) + jitter)
 			defer pulse.Stop()
 
-		monitorLoop:
 			for {
-				timeoutSignal := time.After(timeout)
-				for {
+				select {
+				case <-pulse.C:
 					select {
-					case <-pulse.C:
-						select {
-						case heartbeat <- "Heartbeat from daemon":
-						default:
-						}
-					case beat := <-workerHeartbeat:
-						// TODO: Send useful metric in future. Or metrics should be handled by
-						// the worker? Revisit here later when implement monitoring for price-oracle.
-						//
-						// Until we figure what to do with the heartbeat, we just log one heartbeat
-						// every 60 seconds. Because logging every heartbeat creates a lot of log on
-						// kubernetes.
-						if time.Since(prevHbLogTime) > (60 * time.Second) {
-							logger.Infow("Daemon", "heartbeat received:", beat)
-							prevHbLogTime = time.Now()
-						}
-						continue monitorLoop
-					case err := <-workerFatalErr:
-						logger.Infow("Daemon", "received fatal error from worker:", err,
-							"Remaining recover count", recoverCount)
-						if recoverCount == 0 {
-							logger.Errorw("Daemon", "Terminating", "Max recovery limit reached:")
-							return
+					case heartbeat <- status:
+					default:
+					}
+				case beat, ok := <-workerHeartbeat:
+					if !ok {
+						// The worker returned, its timeout restarts it.
+						workerHeartbeat = nil
+						continue
+					}
+					timeoutSignal = time.After(timeout)
+					status.LastHeartbeat = time.Now()
+					if hb, ok := beat.(Heartbeat); ok {
+						status.Heartbeat = hb.after(prev)
+					}
+					o.registry.set(status)
+					// Log one heartbeat every 60 seconds. Because logging every heartbeat
+					// creates a lot of log on kubernetes.
+					if time.Since(prevHbLogTime) > (60 * time.Second) {
+						logger.Infow("Daemon", "heartbeat received:", beat)
+						prevHbLogTime = time.Now()
+					}
+				case err, ok := <-workerFatalErr:
+					if !ok {
+						workerFatalErr = nil
+						continue
+					}
+					n := fatalErrs.add(time.Now())
+					logger.Infow("Daemon", "received fatal error from worker:", err,
+						"Remaining recover count", recoverCount-n+1)
+					if recoverCount >= 0 && n > recoverCount {
+						logger.Errorw("Daemon", "Terminating", "Max recovery limit reached:")
+						stopWorker()
+						status.Terminated = true
+						status.LastError = err.Error()
+						o.registry.set(status)
+						if o.policy.OnTerminal != nil {
+							o.policy.OnTerminal(status.Name, err)
 						}
-						recoverCount--
-						errCh <- err
-						close(workerDone)
-						startWorker()
-						continue monitorLoop
-					case <-timeoutSignal:
-						errCh <- ErrWorkerRestarted
-						close(workerDone)
-						startWorker()
-						continue monitorLoop
+						// Only ActionRestart starts it again.
+						continue
+					}
+					select {
+					case errCh <- err:
 					case <-done:
+						stopWorker()
 						return
 					}
+					restartWorker()
+				case <-timeoutSignal:
+					select {
+					case errCh <- ErrWorkerRestarted:
+					case <-done:
+						stopWorker()
+						return
+					}
+					restartWorker()
+				case <-restartSignal:
+					startWorker()
+				case cmd := <-control:
+					cmd.reply <- func() error {
+						if status.Terminated && cmd.action != ActionRestart {
+							return ErrWorkerStopped
+						}
+						switch cmd.action {
+						case ActionPause:
+							stopWorker()
+							status.Paused = true
+						case ActionResume:
+							if status.Paused {
+								startWorker()
+							}
+						case ActionRestart:
+							// Asked for, so not a failure. A terminated worker
+							// starts over with its failures forgotten.
+							stopWorker()
+							if status.Terminated {
+								restarts = failures{window: o.policy.FailureWindow}
+								fatalErrs = failures{window: o.policy.FailureWindow}
+								status.Terminated = false
+							}
+							status.Restarts++
+							startWorker()
+						case ActionTrigger:
+							if !status.Running {
+								return ErrWorkerNotRunning
+							}
+							select {
+							case trigger <- struct{}{}:
+							default: // A run is already due.
+							}
+						default:
+							return ErrUnknownAction
+						}
+						logger.Infow("Daemon", "function:", GetFunctionName(fn), "action", cmd.action)
+						o.registry.set(status)
+						return nil
+					}()
+				case <-done:
+					return
 				}
 			}
 		}()
@@ -174,6 +321,37 @@ func MakeDaemon(timeout time.Duration, recoverCount int, worker WorkerFunc) Work
 	}
 }
 
+// Option configures a daemon made by MakeDaemon.
+type Option func(*options)
+
+type options struct {
+	name     string
+	registry *Registry
+	policy   RestartPolicy
+}
+
+// WithName names the worker of the daemon, the name of its AggFunc by
+// default.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithRegistry keeps the status of the worker of the daemon in registry.
+func WithRegistry(registry *Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithRestartPolicy restarts the worker of the daemon with policy.
+func WithRestartPolicy(policy RestartPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
 func GetFunctionName(i interface{}) string {
 	fullName := runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
 	parts := strings.Split(fullName, "/")
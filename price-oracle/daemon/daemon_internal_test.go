@@ -36,3 +36,16 @@ func TestOr(t *testing.T) {
 	_, ok = <-orCh
 	require.Equal(t, false, ok)
 }
+
+func TestHeartbeat_after(t *testing.T) {
+	prev := Heartbeat{Runs: 3, Errors: 2, ConsecutiveFailures: 2, LastError: "failed"}
+
+	// Not run yet.
+	require.Equal(t, prev, Heartbeat{}.after(prev))
+	// Failed again.
+	hb := Heartbeat{Runs: 1, Errors: 1, ConsecutiveFailures: 1, LastError: "failed again"}
+	require.Equal(t, Heartbeat{Runs: 4, Errors: 3, ConsecutiveFailures: 3, LastError: "failed again"}, hb.after(prev))
+	// Succeeded.
+	hb = Heartbeat{Runs: 2, Errors: 1, ConsecutiveFailures: 1, LastError: "failed again"}
+	require.Equal(t, Heartbeat{Runs: 5, Errors: 3, ConsecutiveFailures: 1, LastError: "failed again"}, hb.after(prev))
+}
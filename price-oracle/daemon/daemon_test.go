@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,30 +20,34 @@ func TestMakeDaemon(t *testing.T) {
 	dummyWorker, dummyAgg, logger, _, cfg := setupTest(t)
 
 	recoverCount := 2
-	runAsDaemon := daemon.MakeDaemon(1*time.Second, recoverCount, dummyWorker)
+	terminated := make(chan struct{})
+	policy := daemon.RestartPolicy{OnTerminal: func(string, error) { close(terminated) }}
+	runAsDaemon := daemon.MakeDaemon(1*time.Second, recoverCount, dummyWorker, daemon.WithRestartPolicy(policy))
 	require.IsType(t, runAsDaemon, dummyWorker)
 
 	done := make(chan struct{})
 	hbCh, errCh := runAsDaemon(context.Background(), done, 300*time.Millisecond, logger, cfg, dummyAgg)
 	errorList := make([]error, 0)
 	go func() {
+		// The daemon keeps running once the worker is terminated.
 		defer close(done)
 		for {
 			select {
 			case hb := <-hbCh:
 				logger.Infof("Main Caller: found heartbeat: %v", hb)
-			case err, ok := <-errCh:
-				if !ok {
-					return
-				}
+			case err := <-errCh:
 				logger.Infof("Main Caller: found error: %v", err)
 				errorList = append(errorList, err)
+			case <-terminated:
+				return
 			}
 		}
 	}()
 
 	<-done
 	require.Equal(t, len(errorList), recoverCount)
+	_, ok := <-errCh
+	require.False(t, ok)
 }
 
 func TestDaemon_recoverCount(t *testing.T) {
@@ -61,7 +66,9 @@ func TestDaemon_recoverCount(t *testing.T) {
 	for name, expected := range testCases {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			runAsDaemon := daemon.MakeDaemon(expected.timeout, expected.numRecover, dummyWorker)
+			terminated := make(chan struct{})
+			policy := daemon.RestartPolicy{OnTerminal: func(string, error) { close(terminated) }}
+			runAsDaemon := daemon.MakeDaemon(expected.timeout, expected.numRecover, dummyWorker, daemon.WithRestartPolicy(policy))
 			done := make(chan struct{})
 			hbCh, errCh := runAsDaemon(context.Background(), done, expected.pulse, logger, cfg, dummyAgg)
 			errorList := make([]error, 0)
@@ -70,10 +77,9 @@ func TestDaemon_recoverCount(t *testing.T) {
 				for {
 					select {
 					case <-hbCh:
-					case err, ok := <-errCh:
-						if !ok {
-							return
-						}
+					case <-terminated:
+						return
+					case err := <-errCh:
 						errorList = append(errorList, err)
 
 						// "Always Recover" case, we need a way to stop the execution.
@@ -181,6 +187,268 @@ Loop:
 	}
 }
 
+func TestRecover(t *testing.T) {
+	t.Parallel()
+	errFailed := errors.New("failed")
+	fn := daemon.Recover(func(context.Context) error { return errFailed })
+	require.ErrorIs(t, fn(context.Background()), errFailed)
+
+	fn = daemon.Recover(func(context.Context) error { panic("boom") })
+	err := fn(context.Background())
+	require.ErrorIs(t, err, daemon.ErrWorkerPanicked)
+	require.Contains(t, err.Error(), "boom")
+}
+
+func TestHeartbeat_Record(t *testing.T) {
+	t.Parallel()
+	var hb daemon.Heartbeat
+	errFailed := errors.New("failed")
+
+	require.ErrorIs(t, hb.Record(context.Background(), func(context.Context) error { return errFailed }), errFailed)
+	require.ErrorIs(t, hb.Record(context.Background(), func(context.Context) error { return errFailed }), errFailed)
+	require.Equal(t, 2, hb.ConsecutiveFailures)
+	require.Equal(t, "failed", hb.LastError)
+
+	require.NoError(t, hb.Record(context.Background(), func(ctx context.Context) error {
+		daemon.AddRows(ctx, 2)
+		daemon.AddRows(ctx, 3)
+		time.Sleep(time.Millisecond)
+		return nil
+	}))
+	require.EqualValues(t, 5, hb.RowsWritten)
+	require.EqualValues(t, 3, hb.Runs)
+	require.EqualValues(t, 2, hb.Errors)
+	require.Zero(t, hb.ConsecutiveFailures)
+	require.GreaterOrEqual(t, hb.LastRunDuration, time.Millisecond)
+	require.Equal(t, hb.LastRunEnd.Sub(hb.LastRunStart), hb.LastRunDuration)
+}
+
+func TestMakeDaemon_registry(t *testing.T) {
+	t.Parallel()
+	_, _, logger, _, cfg := setupTest(t)
+	worker := func(
+		ctx context.Context,
+		done chan struct{},
+		pulseInterval time.Duration,
+		logger *zap.SugaredLogger,
+		cfg *config.Config,
+		fn daemon.AggFunc,
+	) (chan interface{}, chan error) {
+		heartbeatCh := make(chan interface{})
+		errCh := make(chan error)
+		go func() {
+			defer close(errCh)
+			defer close(heartbeatCh)
+			hb := daemon.Heartbeat{Runs: 1, RowsWritten: 7}
+			for {
+				select {
+				case <-done:
+					return
+				case heartbeatCh <- hb:
+					time.Sleep(pulseInterval)
+				}
+			}
+		}()
+		return heartbeatCh, errCh
+	}
+
+	registry := daemon.NewRegistry()
+	runAsDaemon := daemon.MakeDaemon(time.Second, 0, worker, daemon.WithName("test"), daemon.WithRegistry(registry))
+	done := make(chan struct{})
+	hbCh, _ := runAsDaemon(context.Background(), done, 10*time.Millisecond, logger, cfg, func(context.Context) error { return nil })
+
+	require.Eventually(t, func() bool {
+		status, ok := registry.Get("test")
+		return ok && status.Running && status.RowsWritten == 7
+	}, 5*time.Second, 10*time.Millisecond)
+	status := (<-hbCh).(daemon.WorkerStatus)
+	require.Equal(t, "test", status.Name)
+	require.EqualValues(t, 7, status.RowsWritten)
+
+	close(done)
+	require.Eventually(t, func() bool {
+		status, _ := registry.Get("test")
+		return !status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, registry.All(), 1)
+}
+
+// failingWorker returns a worker failing with a fatal error after delay,
+// and records when it was started.
+func failingWorker(delay time.Duration, starts chan<- time.Time) daemon.WorkerFunc {
+	return func(
+		ctx context.Context,
+		done chan struct{},
+		pulseInterval time.Duration,
+		logger *zap.SugaredLogger,
+		cfg *config.Config,
+		fn daemon.AggFunc,
+	) (chan interface{}, chan error) {
+		starts <- time.Now()
+		heartbeatCh := make(chan interface{})
+		errCh := make(chan error)
+		go func() {
+			defer close(errCh)
+			defer close(heartbeatCh)
+			select {
+			case <-done:
+			case <-time.After(delay):
+				select {
+				case errCh <- errors.New("failed"):
+				case <-done:
+				}
+			}
+		}()
+		return heartbeatCh, errCh
+	}
+}
+
+func TestMakeDaemon_backoff(t *testing.T) {
+	t.Parallel()
+	_, _, logger, _, cfg := setupTest(t)
+	starts := make(chan time.Time, 10)
+	policy := daemon.RestartPolicy{InitialBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	runAsDaemon := daemon.MakeDaemon(time.Minute, -1, failingWorker(0, starts), daemon.WithRestartPolicy(policy))
+	done := make(chan struct{})
+	defer close(done)
+	_, errCh := runAsDaemon(context.Background(), done, time.Minute, logger, cfg, nil)
+	go func() {
+		for range errCh {
+		}
+	}()
+
+	prev := <-starts
+	for _, backoff := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond} {
+		start := <-starts
+		require.GreaterOrEqual(t, start.Sub(prev), backoff)
+		prev = start
+	}
+}
+
+func TestMakeDaemon_failureWindow(t *testing.T) {
+	t.Parallel()
+	_, _, logger, _, cfg := setupTest(t)
+
+	// Failures are further apart than the window, so the worker is always
+	// restarted.
+	starts := make(chan time.Time, 10)
+	policy := daemon.RestartPolicy{FailureWindow: 20 * time.Millisecond}
+	runAsDaemon := daemon.MakeDaemon(time.Minute, 1, failingWorker(50*time.Millisecond, starts), daemon.WithRestartPolicy(policy))
+	done := make(chan struct{})
+	_, errCh := runAsDaemon(context.Background(), done, time.Minute, logger, cfg, nil)
+	for i := 0; i < 3; i++ {
+		require.EqualError(t, <-errCh, "failed")
+	}
+	close(done)
+
+	// Without a window, the second failure is terminal.
+	terminated := make(chan string, 2)
+	policy = daemon.RestartPolicy{OnTerminal: func(name string, err error) {
+		terminated <- name + ": " + err.Error()
+	}}
+	registry := daemon.NewRegistry()
+	runAsDaemon = daemon.MakeDaemon(time.Minute, 1, failingWorker(0, starts), daemon.WithRestartPolicy(policy),
+		daemon.WithName("flaky"), daemon.WithRegistry(registry))
+	done = make(chan struct{})
+	_, errCh = runAsDaemon(context.Background(), done, time.Minute, logger, cfg, nil)
+	var errs []error
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for err := range errCh {
+			errs = append(errs, err)
+		}
+	}()
+	require.Equal(t, "flaky: failed", <-terminated)
+	status, ok := registry.Get("flaky")
+	require.True(t, ok)
+	require.True(t, status.Terminated)
+	require.False(t, status.Running)
+	ctx := context.Background()
+	require.ErrorIs(t, registry.Control(ctx, "flaky", daemon.ActionResume), daemon.ErrWorkerStopped)
+
+	// Restarted, its failures are forgotten: it is terminated again on its
+	// second failure.
+	require.NoError(t, registry.Control(ctx, "flaky", daemon.ActionRestart))
+	require.Equal(t, "flaky: failed", <-terminated)
+	close(done)
+	<-collected
+	require.Len(t, errs, 2)
+}
+
+func TestRegistry_Control(t *testing.T) {
+	t.Parallel()
+	_, _, logger, _, cfg := setupTest(t)
+	var starts, runs int32
+	worker := func(
+		ctx context.Context,
+		done chan struct{},
+		pulseInterval time.Duration,
+		logger *zap.SugaredLogger,
+		cfg *config.Config,
+		fn daemon.AggFunc,
+	) (chan interface{}, chan error) {
+		atomic.AddInt32(&starts, 1)
+		heartbeatCh := make(chan interface{})
+		errCh := make(chan error)
+		go func() {
+			defer close(errCh)
+			defer close(heartbeatCh)
+			for {
+				select {
+				case <-done:
+					return
+				case <-daemon.Triggered(ctx):
+					_ = fn(ctx)
+				}
+			}
+		}()
+		return heartbeatCh, errCh
+	}
+	fn := func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}
+
+	registry := daemon.NewRegistry()
+	runAsDaemon := daemon.MakeDaemon(time.Minute, 0, worker, daemon.WithName("test"), daemon.WithRegistry(registry))
+	done := make(chan struct{})
+	runAsDaemon(context.Background(), done, time.Minute, logger, cfg, fn)
+	ctx := context.Background()
+	require.Eventually(t, func() bool {
+		_, ok := registry.Get("test")
+		return ok
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, registry.Control(ctx, "test", daemon.ActionTrigger))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&runs) == 1 }, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, registry.Control(ctx, "test", daemon.ActionPause))
+	status, _ := registry.Get("test")
+	require.True(t, status.Paused)
+	require.False(t, status.Running)
+	require.ErrorIs(t, registry.Control(ctx, "test", daemon.ActionTrigger), daemon.ErrWorkerNotRunning)
+
+	require.NoError(t, registry.Control(ctx, "test", daemon.ActionResume))
+	status, _ = registry.Get("test")
+	require.True(t, status.Running)
+	require.False(t, status.Paused)
+	require.EqualValues(t, 2, atomic.LoadInt32(&starts))
+
+	require.NoError(t, registry.Control(ctx, "test", daemon.ActionRestart))
+	status, _ = registry.Get("test")
+	require.EqualValues(t, 1, status.Restarts)
+	require.EqualValues(t, 3, atomic.LoadInt32(&starts))
+
+	require.ErrorIs(t, registry.Control(ctx, "test", "stop"), daemon.ErrUnknownAction)
+	require.ErrorIs(t, registry.Control(ctx, "other", daemon.ActionPause), daemon.ErrUnknownWorker)
+
+	close(done)
+	require.Eventually(t, func() bool {
+		return errors.Is(registry.Control(ctx, "test", daemon.ActionPause), daemon.ErrWorkerStopped)
+	}, 5*time.Second, time.Millisecond)
+}
+
 func setupTest(t *testing.T) (daemon.WorkerFunc, daemon.AggFunc, *zap.SugaredLogger, *observer.ObservedLogs, *config.Config) {
 	t.Helper()
 
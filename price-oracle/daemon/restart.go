@@ -0,0 +1,65 @@
+package daemon
+
+import "time"
+
+// RestartPolicy decides how a daemon restarts its worker. The zero value
+// restarts the worker immediately, and counts all its fatal errors against
+// the recoverCount of MakeDaemon.
+type RestartPolicy struct {
+	// InitialBackoff is how long the daemon waits before restarting the
+	// worker after a failure, a fatal error or a timeout. It doubles with
+	// every failure within FailureWindow, up to MaxBackoff when positive.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureWindow is how long failures are remembered, both for the
+	// backoff and the recoverCount of MakeDaemon. Zero remembers them
+	// forever.
+	FailureWindow time.Duration
+	// OnTerminal, when not nil, is called with the name of the worker and
+	// its last error when the daemon gives up on it, e.g. to fail readiness.
+	OnTerminal func(name string, err error)
+}
+
+// maxBackoffShift bounds the doubling of the backoff, so that it does not
+// overflow.
+const maxBackoffShift = 30
+
+// backoff returns how long to wait before restarting a worker which failed
+// failures times within the window.
+func (p RestartPolicy) backoff(failures int) time.Duration {
+	if p.InitialBackoff <= 0 || failures <= 0 {
+		return 0
+	}
+	shift := failures - 1
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	d := p.InitialBackoff << shift
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// failures counts the failures of a worker, only the ones of the last
+// window when window is positive.
+type failures struct {
+	window time.Duration
+	times  []time.Time
+	count  int
+}
+
+// add records a failure at now, and returns the number of failures.
+func (f *failures) add(now time.Time) int {
+	if f.window <= 0 {
+		f.count++
+		return f.count
+	}
+	f.times = append(f.times, now)
+	i := 0
+	for i < len(f.times) && now.Sub(f.times[i]) >= f.window {
+		i++
+	}
+	f.times = f.times[i:]
+	return len(f.times)
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat is the state of a worker, sent by the worker to its daemon with
+// every beat. The counters of a worker start over when it is restarted, its
+// daemon adds them up in its WorkerStatus.
+type Heartbeat struct {
+	LastRunStart time.Time `json:"last_run_start"`
+	LastRunEnd   time.Time `json:"last_run_end"`
+	// LastRunDuration is in nanoseconds in JSON.
+	LastRunDuration time.Duration `json:"last_run_duration"`
+	// RowsWritten is how many rows the last run wrote, as counted by AddRows.
+	RowsWritten         int64  `json:"rows_written"`
+	Runs                uint64 `json:"runs"`
+	Errors              uint64 `json:"errors"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+type rowsKey struct{}
+
+// AddRows counts n rows written by the run of a worker that ctx belongs to.
+// It does nothing when ctx is not the context of a run recorded by
+// Heartbeat.Record.
+func AddRows(ctx context.Context, n int) {
+	if rows, ok := ctx.Value(rowsKey{}).(*int64); ok {
+		atomic.AddInt64(rows, int64(n))
+	}
+}
+
+// Record runs fn and records the run in hb.
+func (hb *Heartbeat) Record(ctx context.Context, fn AggFunc) error {
+	var rows int64
+	start := time.Now()
+	err := fn(context.WithValue(ctx, rowsKey{}, &rows))
+	end := time.Now()
+
+	hb.LastRunStart = start
+	hb.LastRunEnd = end
+	hb.LastRunDuration = end.Sub(start)
+	hb.RowsWritten = atomic.LoadInt64(&rows)
+	hb.Runs++
+	if err != nil {
+		hb.Errors++
+		hb.ConsecutiveFailures++
+		hb.LastError = err.Error()
+	} else {
+		hb.ConsecutiveFailures = 0
+	}
+	return err
+}
+
+// after returns hb, sent by a worker started after prev was sent, with the
+// counters of prev added. prev is returned until the worker ran.
+func (hb Heartbeat) after(prev Heartbeat) Heartbeat {
+	if hb.Runs == 0 {
+		return prev
+	}
+	if hb.ConsecutiveFailures == int(hb.Runs) {
+		// No run succeeded since the restart.
+		hb.ConsecutiveFailures += prev.ConsecutiveFailures
+	}
+	hb.Runs += prev.Runs
+	hb.Errors += prev.Errors
+	return hb
+}
+
+// WorkerStatus is the status of a worker supervised by a daemon, with the
+// last Heartbeat the worker sent and the counters of all its runs, across
+// restarts.
+type WorkerStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+	// Paused is true while the worker is paused, see ActionPause.
+	Paused bool `json:"paused"`
+	// Terminated is true once the daemon gave up on the worker.
+	Terminated    bool      `json:"terminated"`
+	Restarts      uint64    `json:"restarts"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	Heartbeat
+}
+
+// Registry holds the status of the workers, kept up to date by the daemons
+// given it with WithRegistry, through which the workers can be controlled.
+// A nil Registry holds nothing.
+type Registry struct {
+	mu       sync.RWMutex
+	workers  map[string]WorkerStatus
+	controls map[string]chan command
+}
+
+func NewRegistry() *Registry {
+	return &Registry{workers: map[string]WorkerStatus{}, controls: map[string]chan command{}}
+}
+
+// Get returns the status of the worker called name.
+func (r *Registry) Get(name string) (WorkerStatus, bool) {
+	if r == nil {
+		return WorkerStatus{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	status, ok := r.workers[name]
+	return status, ok
+}
+
+// All returns the status of all the workers, sorted by name.
+func (r *Registry) All() []WorkerStatus {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make([]WorkerStatus, 0, len(r.workers))
+	for _, status := range r.workers {
+		all = append(all, status)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// set records status.
+func (r *Registry) set(status WorkerStatus) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers[status.Name] = status
+}
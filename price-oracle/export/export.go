@@ -0,0 +1,205 @@
+// Package export writes the price history as CSV, JSON Lines or Parquet, for
+// analytics outside of the oracle.
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatParquet Format = "parquet"
+)
+
+const (
+	// DefaultRange is how far back from To an export goes when From is not
+	// given.
+	DefaultRange = 24 * time.Hour
+	// MaxRange is the longest range a single export may cover.
+	MaxRange = 366 * 24 * time.Hour
+)
+
+// parquetRowGroupSize bounds the memory used by a Parquet export, rows are
+// buffered until a row group is full.
+const parquetRowGroupSize = 8 * 1024 * 1024
+
+// ParseFormat returns the format called s, case insensitive.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatJSONL, FormatParquet:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, must be one of csv, jsonl, parquet", s)
+	}
+}
+
+// ContentType returns the MIME type of f.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// Request selects the price history to export.
+type Request struct {
+	Symbols []string
+	// From and To are unix timestamps in seconds, both inclusive.
+	From   int64
+	To     int64
+	Format Format
+}
+
+// Range returns the range to export given the from and to asked for, nil
+// when not given. to defaults to now, from to DefaultRange before to. Ranges
+// ending before they start, at 0, or longer than MaxRange are rejected.
+func Range(from *int64, to *int64, now time.Time) (int64, int64, error) {
+	end := now.Unix()
+	if to != nil {
+		end = *to
+	}
+	if end <= 0 {
+		return 0, 0, fmt.Errorf("to must be a positive unix time")
+	}
+	start := end - int64(DefaultRange.Seconds())
+	if from != nil {
+		start = *from
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("from is after to")
+	}
+	if end-start > int64(MaxRange.Seconds()) {
+		return 0, 0, fmt.Errorf("range longer than %s", MaxRange)
+	}
+	return start, end, nil
+}
+
+// record is an exported sample. Columns are named after oracle.pricehistory.
+type record struct {
+	Symbol    string  `json:"symbol" parquet:"name=symbol, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Price     float64 `json:"price" parquet:"name=price, type=DOUBLE"`
+	MarketCap float64 `json:"marketcap" parquet:"name=marketcap, type=DOUBLE"`
+	Volume    float64 `json:"volume" parquet:"name=volume, type=DOUBLE"`
+	UpdatedAt int64   `json:"updatedat" parquet:"name=updatedat, type=INT64"`
+}
+
+// encoder writes records in a format. Close writes whatever is buffered and,
+// depending on the format, a footer.
+type encoder interface {
+	Encode(record) error
+	Close() error
+}
+
+// Write streams the price history selected by req from s to w. Samples are
+// ordered by symbol then time.
+func Write(ctx context.Context, s store.Store, w io.Writer, req Request) error {
+	if req.From > req.To {
+		return fmt.Errorf("from is after to")
+	}
+
+	enc, err := newEncoder(w, req.Format)
+	if err != nil {
+		return err
+	}
+	err = s.StreamPriceHistory(ctx, req.Symbols, req.From, req.To, func(sample types.HistoricalPrice) error {
+		return enc.Encode(record(sample))
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func newEncoder(w io.Writer, f Format) (encoder, error) {
+	switch f {
+	case FormatCSV:
+		return newCSVEncoder(w)
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatParquet:
+		pw, err := writer.NewParquetWriterFromWriter(w, new(record), 1)
+		if err != nil {
+			return nil, err
+		}
+		pw.RowGroupSize = parquetRowGroupSize
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+		return &parquetEncoder{pw: pw}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", f)
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) (*csvEncoder, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"symbol", "price", "marketcap", "volume", "updatedat"}); err != nil {
+		return nil, err
+	}
+	return &csvEncoder{w: cw}, nil
+}
+
+func (e *csvEncoder) Encode(r record) error {
+	return e.w.Write([]string{
+		r.Symbol,
+		strconv.FormatFloat(r.Price, 'f', -1, 64),
+		strconv.FormatFloat(r.MarketCap, 'f', -1, 64),
+		strconv.FormatFloat(r.Volume, 'f', -1, 64),
+		strconv.FormatInt(r.UpdatedAt, 10),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) Encode(r record) error {
+	return e.enc.Encode(r)
+}
+
+func (e *jsonlEncoder) Close() error {
+	return e.w.Flush()
+}
+
+type parquetEncoder struct {
+	pw *writer.ParquetWriter
+}
+
+func (e *parquetEncoder) Encode(r record) error {
+	return e.pw.Write(r)
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.pw.WriteStop()
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+const day = int64(24 * 60 * 60)
+
+func TestWrite(t *testing.T) {
+	db := memory.NewDB()
+	require.NoError(t, db.UpsertPriceHistory(context.Background(), []types.HistoricalPrice{
+		{Symbol: "OSMOUSDT", Price: 0.5, MarketCap: 100, Volume: 10, UpdatedAt: 200},
+		{Symbol: "ATOMUSDT", Price: 10.25, MarketCap: 3000, Volume: 30, UpdatedAt: 300},
+		{Symbol: "ATOMUSDT", Price: 10, MarketCap: 2000, Volume: 20, UpdatedAt: 200},
+		{Symbol: "ATOMUSDT", Price: 9, MarketCap: 1000, Volume: 10, UpdatedAt: 100},
+		{Symbol: "LUNAUSDT", Price: 1, UpdatedAt: 200},
+	}))
+	req := Request{Symbols: []string{"OSMOUSDT", "ATOMUSDT"}, From: 200, To: 300}
+
+	t.Run("csv", func(t *testing.T) {
+		req := req
+		req.Format = FormatCSV
+		var b bytes.Buffer
+		require.NoError(t, Write(context.Background(), db, &b, req))
+		require.Equal(t, "symbol,price,marketcap,volume,updatedat\n"+
+			"ATOMUSDT,10,2000,20,200\n"+
+			"ATOMUSDT,10.25,3000,30,300\n"+
+			"OSMOUSDT,0.5,100,10,200\n", b.String())
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		req := req
+		req.Format = FormatJSONL
+		var b bytes.Buffer
+		require.NoError(t, Write(context.Background(), db, &b, req))
+		require.Equal(t, `{"symbol":"ATOMUSDT","price":10,"marketcap":2000,"volume":20,"updatedat":200}
+{"symbol":"ATOMUSDT","price":10.25,"marketcap":3000,"volume":30,"updatedat":300}
+{"symbol":"OSMOUSDT","price":0.5,"marketcap":100,"volume":10,"updatedat":200}
+`, b.String())
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		req := req
+		req.Format = FormatParquet
+		var b bytes.Buffer
+		require.NoError(t, Write(context.Background(), db, &b, req))
+
+		f, err := buffer.NewBufferFile(b.Bytes())
+		require.NoError(t, err)
+		pr, err := reader.NewParquetReader(f, new(record), 1)
+		require.NoError(t, err)
+		defer pr.ReadStop()
+		require.Equal(t, int64(3), pr.GetNumRows())
+
+		records := make([]record, pr.GetNumRows())
+		require.NoError(t, pr.Read(&records))
+		require.Equal(t, []record{
+			{Symbol: "ATOMUSDT", Price: 10, MarketCap: 2000, Volume: 20, UpdatedAt: 200},
+			{Symbol: "ATOMUSDT", Price: 10.25, MarketCap: 3000, Volume: 30, UpdatedAt: 300},
+			{Symbol: "OSMOUSDT", Price: 0.5, MarketCap: 100, Volume: 10, UpdatedAt: 200},
+		}, records)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		req := req
+		req.Format = FormatCSV
+		req.From, req.To = req.To, req.From
+		require.Error(t, Write(context.Background(), db, &bytes.Buffer{}, req))
+	})
+}
+
+func TestRange(t *testing.T) {
+	now := time.Unix(10*day, 0)
+	ts := func(n int64) *int64 { return &n }
+
+	from, to, err := Range(nil, nil, now)
+	require.NoError(t, err)
+	require.Equal(t, [2]int64{9 * day, 10 * day}, [2]int64{from, to})
+
+	from, to, err = Range(nil, ts(5*day), now)
+	require.NoError(t, err)
+	require.Equal(t, [2]int64{4 * day, 5 * day}, [2]int64{from, to})
+
+	from, to, err = Range(ts(0), ts(200), now)
+	require.NoError(t, err)
+	require.Equal(t, [2]int64{0, 200}, [2]int64{from, to})
+
+	for _, r := range [][2]*int64{
+		{nil, ts(0)},
+		{ts(200), ts(100)},
+		{ts(0), ts(400 * day)},
+	} {
+		_, _, err := Range(r[0], r[1], now)
+		require.Error(t, err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"csv", "JSONL", "Parquet"} {
+		_, err := ParseFormat(s)
+		require.NoError(t, err, s)
+	}
+	_, err := ParseFormat("xlsx")
+	require.Error(t, err)
+}
@@ -0,0 +1,598 @@
+// Package memory implements store.Store in memory, for tests and for running
+// the oracle locally without a database.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+const (
+	coinmarketcapStore       = "oracle.coinmarketcap"
+	coinmarketcapSupplyStore = "oracle.coinmarketcapsupply"
+)
+
+// tableKind tells which columns a table has, thus which Upsert* method can
+// write in it.
+type tableKind int
+
+const (
+	// symbol, price
+	priceTable tableKind = iota
+	// symbol, price, updatedat
+	tokenTable
+	// symbol, supply, totalsupply, maxsupply
+	supplyTable
+)
+
+// tables lists the tables of the oracle schema, as created by the sql
+// migrations, except the price history which has its own structure.
+var tables = map[string]tableKind{
+	store.BinanceStore:         tokenTable,
+	coinmarketcapStore:         tokenTable,
+	store.CoingeckoStore:       tokenTable,
+	store.FixerStore:           tokenTable,
+	store.TokensStore:          priceTable,
+	store.FiatsStore:           priceTable,
+	coinmarketcapSupplyStore:   supplyTable,
+	store.CoingeckoSupplyStore: supplyTable,
+}
+
+// row is a row of any table but the price history. Price and UpdatedAt are
+// unused in supply tables, the supplies are only used there.
+type row struct {
+	Price       float64
+	Supply      float64
+	TotalSupply *float64
+	MaxSupply   *float64
+	UpdatedAt   int64
+}
+
+// CNSDenom is the part of a CNS denom the oracle uses.
+type CNSDenom struct {
+	Name       string `json:"name"`
+	Ticker     string `json:"ticker"`
+	PriceID    string `json:"price_id"`
+	Precision  int64  `json:"precision"`
+	FetchPrice bool   `json:"fetch_price"`
+}
+
+// CNSPublicNodeEndpoints are the public endpoints of a CNS chain.
+type CNSPublicNodeEndpoints struct {
+	CosmosAPI []string `json:"cosmos_api"`
+}
+
+// CNSChain is the part of a CNS chain (cns.chains) the oracle uses.
+type CNSChain struct {
+	ChainName           string                 `json:"chain_name"`
+	PublicNodeEndpoints CNSPublicNodeEndpoints `json:"public_node_endpoints"`
+	Denoms              []CNSDenom             `json:"denoms"`
+}
+
+// DB is an in-memory store.Store. It is safe for concurrent use.
+//
+// The CNS data that the sql store reads from cns.chains is set with SetCNS
+// or LoadCNSFile.
+type DB struct {
+	mu          sync.RWMutex
+	tables      map[string]map[string]row
+	chainSupply map[string]types.ChainSupply
+	markets     map[string]types.TokenMarket
+	history     map[string]map[int64]types.HistoricalPrice
+	backfill    map[backfillKey]types.BackfillProgress
+	audit       map[auditKey]types.AuditEntry
+	chains      []CNSChain
+}
+
+// backfillKey identifies a backfill, as the primary key of
+// oracle.backfillprogress.
+type backfillKey struct {
+	symbol   string
+	from, to int64
+}
+
+// auditKey identifies an audit entry, as the primary key of oracle.priceaudit.
+type auditKey struct {
+	symbol       string
+	createdAt    int64
+	kind, source string
+}
+
+var _ store.Store = (*DB)(nil)
+
+// NewDB returns an empty in-memory store.
+func NewDB() *DB {
+	m := &DB{
+		tables:      make(map[string]map[string]row, len(tables)),
+		chainSupply: map[string]types.ChainSupply{},
+		markets:     map[string]types.TokenMarket{},
+		history:     map[string]map[int64]types.HistoricalPrice{},
+		backfill:    map[backfillKey]types.BackfillProgress{},
+		audit:       map[auditKey]types.AuditEntry{},
+	}
+	for name := range tables {
+		m.tables[name] = map[string]row{}
+	}
+	return m
+}
+
+// SetCNS replaces the CNS chains.
+func (m *DB) SetCNS(chains []CNSChain) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chains = append([]CNSChain(nil), chains...)
+}
+
+// LoadCNSFile replaces the CNS chains with the ones in the JSON file at path.
+// The file holds an array of chains with the same fields as cns.chains, e.g.:
+//
+//	[{"chain_name": "cosmos-hub", "denoms": [{"name": "uatom", "ticker": "ATOM", "price_id": "cosmos", "fetch_price": true}]}]
+func (m *DB) LoadCNSFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var chains []CNSChain
+	if err := json.Unmarshal(b, &chains); err != nil {
+		return fmt.Errorf("cannot parse CNS file %s: %w", path, err)
+	}
+	m.SetCNS(chains)
+	return nil
+}
+
+// Init is a no-op, there is no schema to migrate.
+func (m *DB) Init(context.Context) error {
+	return nil
+}
+
+// Close is a no-op, the data is kept until m is garbage collected.
+func (m *DB) Close() error {
+	return nil
+}
+
+func (m *DB) GetTokenPriceAndSupplies(_ context.Context, tokens []string) ([]types.TokenPriceAndSupply, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var priceAndSupplies []types.TokenPriceAndSupply //nolint:prealloc
+	for _, symbol := range m.symbols(store.TokensStore, tokens) {
+		token := types.TokenPriceAndSupply{
+			Symbol: symbol,
+			Price:  m.tables[store.TokensStore][symbol].Price,
+		}
+		if r, ok := m.tables[store.CoingeckoSupplyStore][symbol]; ok {
+			supply := r.Supply
+			token.Supply = &supply
+			token.CirculatingSupply = &supply
+			token.TotalSupply = r.TotalSupply
+			token.MaxSupply = r.MaxSupply
+		}
+		if c, ok := m.chainSupply[symbol]; ok {
+			supply := c.Supply
+			token.OnChainSupply = &supply
+		}
+		priceAndSupplies = append(priceAndSupplies, token)
+	}
+	return priceAndSupplies, nil
+}
+
+func (m *DB) GetFiatPrices(_ context.Context, fiats []string) ([]types.FiatPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var fiatPrices []types.FiatPrice //nolint:prealloc
+	for _, symbol := range m.symbols(store.FiatsStore, fiats) {
+		fiatPrices = append(fiatPrices, types.FiatPrice{
+			Symbol: symbol,
+			Price:  m.tables[store.FiatsStore][symbol].Price,
+		})
+	}
+	return fiatPrices, nil
+}
+
+// symbols returns the given symbols present in table, sorted and without
+// duplicates.
+func (m *DB) symbols(table string, symbols []string) []string {
+	seen := make(map[string]bool, len(symbols))
+	ret := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		if _, ok := m.tables[table][symbol]; !ok || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		ret = append(ret, symbol)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (m *DB) GetTokenNames(context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var whitelists []string
+	for _, chain := range m.chains {
+		for _, denom := range chain.Denoms {
+			if denom.FetchPrice {
+				whitelists = append(whitelists, denom.Ticker)
+			}
+		}
+	}
+	return whitelists, nil
+}
+
+// GetCNSChainDenoms returns the denoms of the CNS chains that have a Cosmos
+// SDK REST API endpoint. The first endpoint of a chain is used.
+func (m *DB) GetCNSChainDenoms(context.Context) ([]types.ChainDenom, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chainDenoms []types.ChainDenom
+	for _, chain := range m.chains {
+		if len(chain.PublicNodeEndpoints.CosmosAPI) == 0 {
+			continue
+		}
+		for _, denom := range chain.Denoms {
+			chainDenoms = append(chainDenoms, types.ChainDenom{
+				ChainName:  chain.ChainName,
+				Endpoint:   chain.PublicNodeEndpoints.CosmosAPI[0],
+				Name:       denom.Name,
+				Ticker:     denom.Ticker,
+				Precision:  denom.Precision,
+				FetchPrice: denom.FetchPrice,
+			})
+		}
+	}
+	return chainDenoms, nil
+}
+
+// GetPriceIDToTicker returns all not empty price_ids with their ticker
+// Returns map price_id -> ticker; Ex: cosmos -> atom; osmosis -> osmo
+func (m *DB) GetPriceIDToTicker(context.Context) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	priceIDtoTicker := make(map[string]string)
+	for _, chain := range m.chains {
+		for _, denom := range chain.Denoms {
+			if denom.PriceID == "" {
+				continue
+			}
+			pid := strings.ToLower(denom.PriceID)
+			// Same as CNS, only the first occurrence of a price_id is taken.
+			if _, ok := priceIDtoTicker[pid]; ok {
+				continue
+			}
+			priceIDtoTicker[pid] = strings.ToLower(denom.Ticker)
+		}
+	}
+	return priceIDtoTicker, nil
+}
+
+func (m *DB) GetPrices(_ context.Context, from string) ([]types.Prices, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, err := m.table(from, priceTable, tokenTable); err != nil {
+		return nil, fmt.Errorf("fatal: GetPrices: %w", err)
+	}
+
+	var prices []types.Prices //nolint:prealloc
+	for symbol, r := range m.tables[from] {
+		prices = append(prices, types.Prices{Symbol: symbol, Price: r.Price, UpdatedAt: r.UpdatedAt})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Symbol < prices[j].Symbol })
+	return prices, nil
+}
+
+func (m *DB) UpsertPrice(_ context.Context, to string, price float64, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.table(to, priceTable)
+	if err != nil {
+		return err
+	}
+	t[token] = row{Price: price}
+	return nil
+}
+
+func (m *DB) UpsertToken(_ context.Context, to string, symbol string, price float64, time int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.table(to, tokenTable)
+	if err != nil {
+		return err
+	}
+	t[symbol] = row{Price: price, UpdatedAt: time}
+	return nil
+}
+
+func (m *DB) UpsertTokenSupply(_ context.Context, to string, symbol string, supply float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.table(to, supplyTable)
+	if err != nil {
+		return err
+	}
+	r := t[symbol]
+	r.Supply = supply
+	t[symbol] = r
+	return nil
+}
+
+func (m *DB) UpsertTokens(ctx context.Context, to string, tokens []types.Prices) error {
+	return m.UpsertTokensAndSupplies(ctx, to, tokens, "", nil)
+}
+
+// UpsertTokensAndSupplies writes the whole batch or nothing, supplyTo may be
+// empty when there are no supplies.
+func (m *DB) UpsertTokensAndSupplies(_ context.Context, to string, tokens []types.Prices, supplyTo string, supplies []types.TokenSupply) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokenRows, supplyRows map[string]row
+	var err error
+	if len(tokens) > 0 {
+		if tokenRows, err = m.table(to, tokenTable); err != nil {
+			return err
+		}
+	}
+	if len(supplies) > 0 {
+		if supplyRows, err = m.table(supplyTo, supplyTable); err != nil {
+			return err
+		}
+	}
+	for _, t := range tokens {
+		tokenRows[t.Symbol] = row{Price: t.Price, UpdatedAt: t.UpdatedAt}
+	}
+	for _, s := range supplies {
+		supplyRows[s.Symbol] = row{Supply: s.Supply, TotalSupply: s.TotalSupply, MaxSupply: s.MaxSupply}
+	}
+	return nil
+}
+
+func (m *DB) UpsertChainSupplies(_ context.Context, supplies []types.ChainSupply) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range supplies {
+		m.chainSupply[s.Symbol] = s
+	}
+	return nil
+}
+
+func (m *DB) UpsertMarkets(_ context.Context, markets []types.TokenMarket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, mk := range markets {
+		m.markets[mk.Symbol] = mk
+	}
+	return nil
+}
+
+// GetMarkets returns the market data of the given tokens in alphabetic order.
+func (m *DB) GetMarkets(_ context.Context, tokens []string) ([]types.TokenMarket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool, len(tokens))
+	markets := []types.TokenMarket{}
+	for _, symbol := range tokens {
+		if mk, ok := m.markets[symbol]; ok && !seen[symbol] {
+			seen[symbol] = true
+			markets = append(markets, mk)
+		}
+	}
+	sort.Slice(markets, func(i, j int) bool { return markets[i].Symbol < markets[j].Symbol })
+	return markets, nil
+}
+
+// table returns the rows of the table called name, an error if it does not
+// exist or is not of one of the given kinds.
+func (m *DB) table(name string, kinds ...tableKind) (map[string]row, error) {
+	kind, ok := tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s does not exist", name)
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return m.tables[name], nil
+		}
+	}
+	return nil, fmt.Errorf("table %s does not have the expected columns", name)
+}
+
+// GetPriceHistory returns the price history of symbol between from and to
+// (unix seconds, both inclusive) in ascending order of time.
+func (m *DB) GetPriceHistory(_ context.Context, symbol string, from int64, to int64) ([]types.HistoricalPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var history []types.HistoricalPrice //nolint:prealloc
+	for ts, sample := range m.history[symbol] {
+		if ts >= from && ts <= to {
+			history = append(history, sample)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].UpdatedAt < history[j].UpdatedAt })
+	return history, nil
+}
+
+// GetPriceHistoryAt returns, for every symbol, the history sample closest to
+// (param:<at>), looking at most (param:<tolerance>) seconds away from it.
+// Symbols without any sample in that window are not returned.
+func (m *DB) GetPriceHistoryAt(_ context.Context, symbols []string, at int64, tolerance int64) ([]types.HistoricalPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool, len(symbols))
+	var history []types.HistoricalPrice //nolint:prealloc
+	for _, symbol := range symbols {
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+
+		var closest *types.HistoricalPrice
+		for ts := range m.history[symbol] {
+			if ts < at-tolerance || ts > at+tolerance {
+				continue
+			}
+			sample := m.history[symbol][ts]
+			// On a tie, the older sample wins.
+			if closest == nil ||
+				abs(ts-at) < abs(closest.UpdatedAt-at) ||
+				(abs(ts-at) == abs(closest.UpdatedAt-at) && ts < closest.UpdatedAt) {
+				closest = &sample
+			}
+		}
+		if closest != nil {
+			history = append(history, *closest)
+		}
+	}
+	return history, nil
+}
+
+// StreamPriceHistory calls fn with the price history of symbols between from
+// and to (unix seconds, both inclusive), ordered by symbol then time. The
+// history of a symbol is copied before fn is called, so fn can use m.
+func (m *DB) StreamPriceHistory(ctx context.Context, symbols []string, from int64, to int64, fn func(types.HistoricalPrice) error) error {
+	sorted := append([]string(nil), symbols...)
+	sort.Strings(sorted)
+
+	var prev string
+	for i, symbol := range sorted {
+		if i > 0 && symbol == prev {
+			continue
+		}
+		prev = symbol
+
+		history, err := m.GetPriceHistory(ctx, symbol, from, to)
+		if err != nil {
+			return err
+		}
+		for _, sample := range history {
+			if err := fn(sample); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UpsertPriceHistory writes the given samples in the price history. A sample
+// with the same symbol and timestamp as an existing one replaces it.
+func (m *DB) UpsertPriceHistory(_ context.Context, history []types.HistoricalPrice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, sample := range history {
+		if m.history[sample.Symbol] == nil {
+			m.history[sample.Symbol] = map[int64]types.HistoricalPrice{}
+		}
+		m.history[sample.Symbol][sample.UpdatedAt] = sample
+	}
+	return nil
+}
+
+// GetBackfillProgress returns the progress of every backfill ever started,
+// ordered by symbol and range.
+func (m *DB) GetBackfillProgress(context.Context) ([]types.BackfillProgress, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	progress := make([]types.BackfillProgress, 0, len(m.backfill))
+	for _, p := range m.backfill {
+		progress = append(progress, p)
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		a, b := progress[i], progress[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return progress, nil
+}
+
+func (m *DB) UpsertBackfillProgress(_ context.Context, progress types.BackfillProgress) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.backfill[backfillKey{symbol: progress.Symbol, from: progress.From, to: progress.To}] = progress
+	return nil
+}
+
+func (m *DB) AppendAudit(_ context.Context, entries []types.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range entries {
+		key := auditKey{symbol: e.Symbol, createdAt: e.CreatedAt, kind: e.Kind, source: e.Source}
+		if _, ok := m.audit[key]; !ok {
+			m.audit[key] = e
+		}
+	}
+	return nil
+}
+
+// GetAudit returns the audit entries of symbol created between from and to
+// (unix seconds, both inclusive), ordered by time, kind and source.
+func (m *DB) GetAudit(_ context.Context, symbol string, from int64, to int64) ([]types.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []types.AuditEntry{}
+	for _, e := range m.audit {
+		if e.Symbol == symbol && e.CreatedAt >= from && e.CreatedAt <= to {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Source < b.Source
+	})
+	return entries, nil
+}
+
+func (m *DB) DeleteAuditBefore(_ context.Context, before int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, e := range m.audit {
+		if e.CreatedAt < before {
+			delete(m.audit, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	mDB := NewDB()
+	defer func() {
+		require.NoError(t, mDB.Close())
+	}()
+
+	err := mDB.Init(context.Background())
+	require.NoError(t, err)
+
+	store.TestStore(t, mDB)
+}
+
+func TestLoadCNSFile(t *testing.T) {
+	mDB := NewDB()
+
+	err := mDB.LoadCNSFile("testdata/cns.json")
+	require.NoError(t, err)
+
+	names, err := mDB.GetTokenNames(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"ATOM", "OSMO"}, names)
+
+	priceIDs, err := mDB.GetPriceIDToTicker(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"cosmos":  "atom",
+		"osmosis": "osmo",
+		"ion":     "ion",
+	}, priceIDs)
+
+	err = mDB.LoadCNSFile("testdata/missing.json")
+	require.Error(t, err)
+}
+
+func TestUnknownTable(t *testing.T) {
+	mDB := NewDB()
+	ctx := context.Background()
+
+	require.Error(t, mDB.UpsertPrice(ctx, "oracle.unknown", 1, "ATOM"))
+	require.Error(t, mDB.UpsertToken(ctx, "oracle.unknown", "ATOM", 1, 1))
+	require.Error(t, mDB.UpsertTokenSupply(ctx, "oracle.unknown", "ATOM", 1))
+	_, err := mDB.GetPrices(ctx, "oracle.unknown")
+	require.Error(t, err)
+
+	// Tables exist but do not have the right columns.
+	require.Error(t, mDB.UpsertPrice(ctx, store.CoingeckoSupplyStore, 1, "ATOM"))
+	require.Error(t, mDB.UpsertTokenSupply(ctx, store.TokensStore, "ATOM", 1))
+}
+
+func TestGetTokenPriceAndSupplies(t *testing.T) {
+	mDB := NewDB()
+	ctx := context.Background()
+
+	require.NoError(t, mDB.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+	require.NoError(t, mDB.UpsertPrice(ctx, store.TokensStore, 2, "OSMOUSDT"))
+	require.NoError(t, mDB.UpsertTokenSupply(ctx, store.CoingeckoSupplyStore, "ATOMUSDT", 1000))
+
+	tokens, err := mDB.GetTokenPriceAndSupplies(ctx, []string{"OSMOUSDT", "ATOMUSDT", "LUNAUSDT"})
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.Equal(t, "ATOMUSDT", tokens[0].Symbol)
+	require.NotNil(t, tokens[0].Supply)
+	require.Equal(t, float64(1000), *tokens[0].Supply)
+	require.Equal(t, "OSMOUSDT", tokens[1].Symbol)
+	require.Nil(t, tokens[1].Supply)
+}
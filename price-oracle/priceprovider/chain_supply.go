@@ -0,0 +1,126 @@
+package priceprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emerishq/emeris-utils/sentryx"
+	"github.com/getsentry/sentry-go"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// bankSupplyResponse is the response of the Cosmos SDK bank module supply
+// queries, e.g. {"amount":{"denom":"uatom","amount":"290000000000000"}}.
+type bankSupplyResponse struct {
+	Amount struct {
+		Denom  string `json:"denom"`
+		Amount string `json:"amount"`
+	} `json:"amount"`
+}
+
+// SubscriptionChainSupply reads the total supply of the CNS tokens with
+// fetch_price set from the bank module of their chain, through the Cosmos SDK
+// REST API (LCD) of its public node endpoints. When a ticker has denoms on
+// several chains, the first one found is used.
+//
+// Chains are best effort: a chain that cannot be queried is logged and
+// skipped, its last supplies are kept.
+func (api *Api) SubscriptionChainSupply(ctx context.Context) error {
+	span, ctx := sentryx.StartSpan(ctx, "subscription", sentry.TransactionName("SubscriptionChainSupply"))
+	defer span.Finish()
+
+	denoms, err := api.StoreHandler.Store.GetCNSChainDenoms(ctx)
+	if err != nil {
+		return fmt.Errorf("SubscriptionChainSupply, Store.GetCNSChainDenoms(): %w", err)
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(denoms))
+	supplies := make([]types.ChainSupply, 0, len(denoms))
+	for _, denom := range denoms {
+		if !denom.FetchPrice || denom.Ticker == "" {
+			continue
+		}
+		symbol := strings.ToUpper(denom.Ticker) + types.USDT
+		if seen[symbol] {
+			continue
+		}
+		supply, err := api.bankSupply(ctx, denom.Endpoint, denom.Name)
+		if err != nil {
+			api.StoreHandler.Logger.Errorw("SubscriptionChainSupply", "chain", denom.ChainName, "denom", denom.Name, "error", err)
+			continue
+		}
+		seen[symbol] = true
+		supplies = append(supplies, types.ChainSupply{
+			Symbol:    symbol,
+			ChainName: denom.ChainName,
+			Denom:     denom.Name,
+			Supply:    supply / math.Pow10(int(denom.Precision)),
+			UpdatedAt: now.Unix(),
+		})
+	}
+	if err := api.StoreHandler.Store.UpsertChainSupplies(ctx, supplies); err != nil {
+		return fmt.Errorf("SubscriptionChainSupply, Store.UpsertChainSupplies(): %w", err)
+	}
+	daemon.AddRows(ctx, len(supplies))
+	return nil
+}
+
+// bankSupply returns the total supply of denom, in base units, from the LCD
+// at endpoint. It uses the by_denom query of recent Cosmos SDK versions, and
+// falls back to the path parameter query of older ones, which does not
+// support denoms with slashes such as ibc/... .
+func (api *Api) bankSupply(ctx context.Context, endpoint string, denom string) (float64, error) {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	body, err := api.getLCD(ctx, endpoint+"/cosmos/bank/v1beta1/supply/by_denom?denom="+url.QueryEscape(denom))
+	if err != nil {
+		body, err = api.getLCD(ctx, endpoint+"/cosmos/bank/v1beta1/supply/"+url.PathEscape(denom))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var resp bankSupplyResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, fmt.Errorf("unmarshal body: %w", err)
+	}
+	supply, err := strconv.ParseFloat(resp.Amount.Amount, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse amount %q: %w", resp.Amount.Amount, err)
+	}
+	return supply, nil
+}
+
+func (api *Api) getLCD(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := api.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s, Status: %s", u, body, resp.Status)
+	}
+	return body, nil
+}
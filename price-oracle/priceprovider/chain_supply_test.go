@@ -0,0 +1,143 @@
+package priceprovider_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/priceprovider"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// lcdServer is a stand-in for the Cosmos SDK REST API of a chain. byDenom
+// tells whether it supports the supply/by_denom query.
+func lcdServer(t *testing.T, byDenom bool, supplies map[string]string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cosmos/bank/v1beta1/supply/", func(w http.ResponseWriter, r *http.Request) {
+		denom := r.URL.Path[len("/cosmos/bank/v1beta1/supply/"):]
+		if denom == "by_denom" {
+			if !byDenom {
+				http.Error(w, `{"code":12,"message":"Not Implemented"}`, http.StatusNotImplemented)
+				return
+			}
+			denom = r.URL.Query().Get("denom")
+		}
+		amount, ok := supplies[denom]
+		if !ok {
+			amount = "0"
+		}
+		fmt.Fprintf(w, `{"amount":{"denom":%q,"amount":%q}}`, denom, amount)
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSubscriptionChainSupply(t *testing.T) {
+	hub := lcdServer(t, true, map[string]string{"uatom": "290000000000000"})
+	osmosis := lcdServer(t, false, map[string]string{"uosmo": "500000000000000", "uion": "20000000000"})
+
+	db := memory.NewDB()
+	db.SetCNS([]memory.CNSChain{
+		{
+			ChainName:           "cosmos-hub",
+			PublicNodeEndpoints: memory.CNSPublicNodeEndpoints{CosmosAPI: []string{hub.URL + "/"}},
+			Denoms:              []memory.CNSDenom{{Name: "uatom", Ticker: "ATOM", Precision: 6, FetchPrice: true}},
+		},
+		{
+			ChainName:           "osmosis",
+			PublicNodeEndpoints: memory.CNSPublicNodeEndpoints{CosmosAPI: []string{osmosis.URL}},
+			Denoms: []memory.CNSDenom{
+				{Name: "uosmo", Ticker: "OSMO", Precision: 6, FetchPrice: true},
+				{Name: "uion", Ticker: "ION", Precision: 6},
+				// Already read on cosmos-hub.
+				{Name: "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", Ticker: "ATOM", Precision: 6, FetchPrice: true},
+			},
+		},
+		{
+			// No endpoint, skipped.
+			ChainName: "akash",
+			Denoms:    []memory.CNSDenom{{Name: "uakt", Ticker: "AKT", Precision: 6, FetchPrice: true}},
+		},
+	})
+	ctx := context.Background()
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 1, "OSMOUSDT"))
+	require.NoError(t, db.UpsertTokenSupply(ctx, store.CoingeckoSupplyStore, "ATOMUSDT", 280000000))
+	require.NoError(t, db.UpsertTokenSupply(ctx, store.CoingeckoSupplyStore, "OSMOUSDT", 400000000))
+
+	storeHandler, err := store.NewStoreHandler(
+		store.WithDB(ctx, db),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(&config.Config{ChainSupplyTokens: []string{"atom"}}),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+
+	api := priceprovider.Api{
+		Client:       http.DefaultClient,
+		StoreHandler: storeHandler,
+	}
+	require.NoError(t, api.SubscriptionChainSupply(ctx))
+
+	tokens, err := db.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT", "OSMOUSDT"})
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.NotNil(t, tokens[0].OnChainSupply)
+	require.Equal(t, 290000000.0, *tokens[0].OnChainSupply)
+	require.NotNil(t, tokens[1].OnChainSupply)
+	require.Equal(t, 500000000.0, *tokens[1].OnChainSupply)
+
+	// ATOM uses the on-chain supply, OSMO the Coingecko circulating supply.
+	tokens, err = storeHandler.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT", "OSMOUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 290000000.0, *tokens[0].Supply)
+	require.Equal(t, 280000000.0, *tokens[0].CirculatingSupply)
+	require.Equal(t, 400000000.0, *tokens[1].Supply)
+}
+
+func TestSubscriptionChainSupplyChainDown(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	db := memory.NewDB()
+	db.SetCNS([]memory.CNSChain{{
+		ChainName:           "cosmos-hub",
+		PublicNodeEndpoints: memory.CNSPublicNodeEndpoints{CosmosAPI: []string{down.URL}},
+		Denoms:              []memory.CNSDenom{{Name: "uatom", Ticker: "ATOM", Precision: 6, FetchPrice: true}},
+	}})
+	ctx := context.Background()
+	require.NoError(t, db.UpsertChainSupplies(ctx, []types.ChainSupply{
+		{Symbol: "ATOMUSDT", ChainName: "cosmos-hub", Denom: "uatom", Supply: 1, UpdatedAt: 1},
+	}))
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+
+	storeHandler, err := store.NewStoreHandler(
+		store.WithDB(ctx, db),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(&config.Config{}),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+
+	api := priceprovider.Api{
+		Client:       http.DefaultClient,
+		StoreHandler: storeHandler,
+	}
+	require.NoError(t, api.SubscriptionChainSupply(ctx))
+
+	// The last known supply is kept.
+	tokens, err := db.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 1.0, *tokens[0].OnChainSupply)
+}
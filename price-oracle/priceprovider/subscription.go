@@ -3,6 +3,7 @@ package priceprovider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -20,7 +21,6 @@ import (
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
-	gecko "github.com/superoo7/go-gecko/v3"
 	geckoTypes "github.com/superoo7/go-gecko/v3/types"
 	"go.uber.org/zap"
 )
@@ -29,6 +29,8 @@ const (
 	BinanceURL = "https://api.binance.com/api/v3/ticker/price"
 	FixerURL   = "https://data.fixer.io/api/latest"
 
+	CoingeckoMarketsURL = "https://api.coingecko.com/api/v3/coins/markets"
+
 	// CoinMarketCapURL = "https://pro-api.coinmarketcap.com/v1/cryptocurrency/quotes/latest"
 )
 
@@ -53,40 +55,170 @@ func StartSubscription(ctx context.Context, storeHandler *store.Handler) {
 		StoreHandler: storeHandler,
 	}
 
+	interval, err := time.ParseDuration(storeHandler.Cfg.Interval)
+	if err != nil {
+		storeHandler.Logger.Errorw("PriceProvider", "StartSubscription", err)
+		return
+	}
+	type subscription struct {
+		name     string
+		fn       daemon.AggFunc
+		interval time.Duration
+	}
+	subscriptions := []subscription{
+		{name: BinanceWorker, fn: api.SubscriptionBinance, interval: interval},
+		{name: CoingeckoWorker, fn: api.SubscriptionCoingecko, interval: interval},
+		{name: FixerWorker, fn: api.SubscriptionFixer, interval: interval},
+	}
+	// On-chain supplies change slowly, they are read less often than prices.
+	if storeHandler.Cfg.ChainSupplyInterval > 0 {
+		subscriptions = append(subscriptions, subscription{name: ChainSupplyWorker, fn: api.SubscriptionChainSupply, interval: storeHandler.Cfg.ChainSupplyInterval})
+	}
+
+	timeout := storeHandler.Cfg.SubscriptionTimeout
+	if timeout <= 0 {
+		timeout = defaultSubscriptionTimeout
+	}
+	pulse := storeHandler.Cfg.WorkerPulse
+
 	var wg sync.WaitGroup
-	for _, s := range []daemon.AggFunc{
-		api.SubscriptionBinance,
-		api.SubscriptionCoingecko,
-		api.SubscriptionFixer,
-	} {
+	for _, subscription := range subscriptions {
+		// The worker does not beat while it calls the provider, which takes
+		// at most timeout.
+		runAsDaemon := daemon.MakeDaemon(timeout+2*pulse, storeHandler.Cfg.RecoverCount, SubscriptionManager(subscription.interval, timeout),
+			daemon.WithName(subscription.name), daemon.WithRegistry(storeHandler.Workers), daemon.WithRestartPolicy(storeHandler.RestartPolicy))
+		done := make(chan struct{})
+		heartbeatCh, errCh := runAsDaemon(ctx, done, pulse, storeHandler.Logger, storeHandler.Cfg, subscription.fn)
 		wg.Add(1)
-		go func(subscriber daemon.AggFunc) {
+		go func(workerName string, lastLogTime time.Time) {
 			defer wg.Done()
-			SubscriptionWorker(ctx, storeHandler.Logger, storeHandler.Cfg, subscriber)
-		}(s)
+			for {
+				select {
+				case <-ctx.Done():
+					close(done)
+					// The daemon closes its channels once stopped.
+					for range heartbeatCh {
+					}
+					return
+				case heartbeat := <-heartbeatCh:
+					// Reduce number of logs on std out. Without this we have a very busy std out.
+					if time.Since(lastLogTime) > 60*time.Second {
+						storeHandler.Logger.Infow("Heartbeat received", "worker", workerName, "status", heartbeat)
+						lastLogTime = time.Now()
+					}
+				case err, ok := <-errCh:
+					// errCh is closed. Daemon process returned.
+					if !ok {
+						storeHandler.Logger.Errorw("PriceProvider", "subscription stopped", workerName)
+						return
+					}
+					storeHandler.Logger.Errorw("PriceProvider", "subscription", workerName, "Error:", err)
+				}
+			}
+		}(subscription.name, time.Now().Add(-60*time.Second))
 	}
 	wg.Wait()
 }
 
-func SubscriptionWorker(ctx context.Context, logger *zap.SugaredLogger, cfg *config.Config, fn daemon.AggFunc) {
-	interval, err := time.ParseDuration(cfg.Interval)
-	if err != nil {
-		logger.Errorw("PriceProvider", "SubscriptionWorker", err)
-		return
-	}
-
-	logger.Infow("PriceProvider", "SubscriptionWorker", "Start", "subscription function", daemon.GetFunctionName(fn))
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
+// Names of the subscription workers in store.Handler.Workers.
+const (
+	BinanceWorker     = "subscription-binance"
+	CoingeckoWorker   = "subscription-coingecko"
+	FixerWorker       = "subscription-fixer"
+	ChainSupplyWorker = "subscription-chainsupply"
+)
 
-		if err := fn(ctx); err != nil {
-			logger.Errorw("PriceProvider", "SubscriptionWorker function name:", daemon.GetFunctionName(fn), "Error:", err)
-		}
-		time.Sleep(interval)
+// defaultSubscriptionTimeout bounds a call of a provider when
+// Cfg.SubscriptionTimeout is not set.
+const defaultSubscriptionTimeout = time.Minute
+
+// SubscriptionManager returns a daemon.WorkerFunc calling the provider every
+// interval, each call bounded by timeout. A provider returning an error is
+// called again at the next tick. A panic of the provider is recovered and
+// sent as a fatal error, the daemon then restarts the worker.
+//
+// The running call is cancelled when the daemon stops or restarts the
+// worker, e.g. because a provider ignoring timeout hung.
+func SubscriptionManager(interval, timeout time.Duration) daemon.WorkerFunc {
+	return func(
+		ctx context.Context,
+		done chan struct{},
+		pulseInterval time.Duration,
+		logger *zap.SugaredLogger,
+		cfg *config.Config,
+		fn daemon.AggFunc,
+	) (chan interface{}, chan error) {
+		heartbeatCh := make(chan interface{})
+		errCh := make(chan error)
+		run := daemon.Recover(fn)
+		go func() {
+			defer close(heartbeatCh)
+			defer close(errCh)
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				select {
+				case <-done:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			var hb daemon.Heartbeat
+			name := daemon.GetFunctionName(fn)
+			logger.Infow("PriceProvider", "SubscriptionWorker", "Start", "subscription function", name)
+			// call calls the provider, and returns false on a fatal error.
+			call := func() bool {
+				callCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				err := hb.Record(callCtx, run)
+				// Report the call without waiting for the pulse.
+				select {
+				case heartbeatCh <- hb:
+				default:
+				}
+				if err == nil {
+					return true
+				}
+				logger.Errorw("PriceProvider", "SubscriptionWorker function name:", name, "Error:", err)
+				if !errors.Is(err, daemon.ErrWorkerPanicked) {
+					return true
+				}
+				select {
+				case errCh <- err:
+				case <-done:
+				}
+				return false
+			}
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			pulse := time.NewTicker(pulseInterval)
+			defer pulse.Stop()
+			if !call() {
+				return
+			}
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if !call() {
+						return
+					}
+				case <-daemon.Triggered(ctx):
+					if !call() {
+						return
+					}
+				case <-pulse.C:
+					select {
+					case heartbeatCh <- hb:
+					default:
+					}
+				}
+			}
+		}()
+		return heartbeatCh, errCh
 	}
 }
 
@@ -141,6 +273,8 @@ func (api *Api) SubscriptionBinance(ctx context.Context) error {
 	}
 
 	var missingTokens []string
+	now := time.Now()
+	tokens := make([]types.Prices, 0, len(whitelistedTokens))
 	for _, token := range whitelistedTokens {
 		tokenSymbol := strings.ToUpper(token + types.USDT) // Force upper, better safe than sorry!
 		var price float64
@@ -149,12 +283,13 @@ func (api *Api) SubscriptionBinance(ctx context.Context) error {
 			missingTokens = append(missingTokens, tokenSymbol)
 			continue
 		}
-		now := time.Now()
-		if err = api.StoreHandler.Store.UpsertToken(ctx, store.BinanceStore, tokenSymbol, price, now.Unix()); err != nil {
-			return fmt.Errorf("SubscriptionBinance, Store.UpsertToken(%s,%s,%f): %w", store.BinanceStore, tokenSymbol, price, err)
-		}
-		time.Sleep(1 * time.Second)
+		tokens = append(tokens, types.Prices{Symbol: tokenSymbol, Price: price, UpdatedAt: now.Unix()})
+	}
+	if err = api.StoreHandler.Store.UpsertTokens(ctx, store.BinanceStore, tokens); err != nil {
+		return fmt.Errorf("SubscriptionBinance, Store.UpsertTokens(%s): %w", store.BinanceStore, err)
 	}
+	daemon.AddRows(ctx, len(tokens))
+	api.StoreHandler.AuditQuotes(ctx, store.BinanceStore, tokens)
 	if len(missingTokens) > 0 {
 		api.StoreHandler.Logger.Infow("SubscriptionBinance", "MissingTokens", strings.Join(missingTokens, ", "))
 	}
@@ -179,34 +314,106 @@ func (api *Api) SubscriptionCoingecko(ctx context.Context) error {
 	}
 	api.StoreHandler.Logger.Infow("SubscriptionCoingecko", "Calling Price Ids", strings.Join(priceIds, ", "))
 
-	cg := gecko.NewClient(api.Client)
-	pcp := geckoTypes.PriceChangePercentageObject
-	priceChangePercentage := []string{pcp.PCP1h}
-	order := geckoTypes.OrderTypeObject.MarketCapDesc
-	market, err := cg.CoinsMarket(types.USD, priceIds, order, 1, 1, false, priceChangePercentage)
+	market, err := api.coinsMarket(ctx, priceIds)
 	if err != nil {
-		return fmt.Errorf("SubscriptionCoingecko, cg.CoinsMarket(): %w", err)
+		return fmt.Errorf("SubscriptionCoingecko, coinsMarket(): %w", err)
 	}
 
-	respTokenSymbols := make([]string, 0, len(*market)) // For logging.
-	for _, token := range *market {
+	respTokenSymbols := make([]string, 0, len(market)) // For logging.
+	now := time.Now().Round(0)
+	tokens := make([]types.Prices, 0, len(market))
+	supplies := make([]types.TokenSupply, 0, len(market))
+	markets := make([]types.TokenMarket, 0, len(market))
+	for _, token := range market {
 		tokenSymbol := strings.ToUpper(token.Symbol) + types.USDT
 		respTokenSymbols = append(respTokenSymbols, fmt.Sprintf("(ID: %s Symbol: %s)", token.ID, token.Symbol))
-		now := time.Now().Round(0)
-
-		if err = api.StoreHandler.Store.UpsertToken(ctx, store.CoingeckoStore, tokenSymbol, token.CurrentPrice, now.Unix()); err != nil {
-			return fmt.Errorf("SubscriptionCoingecko, Store.UpsertToken(%s,%s,%f): %w", store.CoingeckoStore, tokenSymbol, token.CurrentPrice, err)
-		}
-
-		if err = api.StoreHandler.Store.UpsertTokenSupply(ctx, store.CoingeckoSupplyStore, tokenSymbol, token.CirculatingSupply); err != nil {
-			return fmt.Errorf("SubscriptionCoingecko, Store.UpsertTokenSupply(%s,%s,%f): %w", store.CoingeckoSupplyStore, tokenSymbol, token.CirculatingSupply, err)
-		}
-		time.Sleep(1 * time.Second)
+		tokens = append(tokens, types.Prices{Symbol: tokenSymbol, Price: token.CurrentPrice, UpdatedAt: now.Unix()})
+		supplies = append(supplies, types.TokenSupply{
+			Symbol:      tokenSymbol,
+			Supply:      token.CirculatingSupply,
+			TotalSupply: token.TotalSupply,
+			MaxSupply:   token.MaxSupply,
+		})
+		markets = append(markets, types.TokenMarket{
+			Symbol:                   tokenSymbol,
+			MarketCap:                token.MarketCap,
+			Volume24h:                token.TotalVolume,
+			High24h:                  token.High24h,
+			Low24h:                   token.Low24h,
+			PriceChange24h:           token.PriceChange24h,
+			PriceChangePercentage24h: token.PriceChangePercentage24h,
+			UpdatedAt:                now.Unix(),
+		})
 	}
+	if err = api.StoreHandler.Store.UpsertTokensAndSupplies(ctx, store.CoingeckoStore, tokens, store.CoingeckoSupplyStore, supplies); err != nil {
+		return fmt.Errorf("SubscriptionCoingecko, Store.UpsertTokensAndSupplies(%s,%s): %w", store.CoingeckoStore, store.CoingeckoSupplyStore, err)
+	}
+	daemon.AddRows(ctx, len(tokens)+len(supplies))
+	api.StoreHandler.AuditQuotes(ctx, store.CoingeckoStore, tokens)
+	if err = api.StoreHandler.Store.UpsertMarkets(ctx, markets); err != nil {
+		return fmt.Errorf("SubscriptionCoingecko, Store.UpsertMarkets(): %w", err)
+	}
+	daemon.AddRows(ctx, len(markets))
 	api.StoreHandler.Logger.Infow("SubscriptionCoingecko", "Received Price Ids", strings.Join(respTokenSymbols, ", "))
 	return nil
 }
 
+// coingeckoMarket is an item of the Coingecko /coins/markets response.
+// go-gecko's CoinsMarketItem has no max supply and reads a null total supply
+// as zero.
+type coingeckoMarket struct {
+	ID                       string   `json:"id"`
+	Symbol                   string   `json:"symbol"`
+	CurrentPrice             float64  `json:"current_price"`
+	MarketCap                float64  `json:"market_cap"`
+	TotalVolume              float64  `json:"total_volume"`
+	High24h                  float64  `json:"high_24h"`
+	Low24h                   float64  `json:"low_24h"`
+	PriceChange24h           float64  `json:"price_change_24h"`
+	PriceChangePercentage24h float64  `json:"price_change_percentage_24h"`
+	CirculatingSupply        float64  `json:"circulating_supply"`
+	TotalSupply              *float64 `json:"total_supply"`
+	MaxSupply                *float64 `json:"max_supply"`
+}
+
+// coinsMarket returns the USD market data of the given Coingecko ids.
+func (api *Api) coinsMarket(ctx context.Context, ids []string) ([]coingeckoMarket, error) {
+	params := url.Values{}
+	params.Add("vs_currency", types.USD)
+	params.Add("order", geckoTypes.OrderTypeObject.MarketCapDesc)
+	params.Add("ids", strings.Join(ids, ","))
+	params.Add("per_page", "1")
+	params.Add("page", "1")
+	params.Add("sparkline", "false")
+	params.Add("price_change_percentage", geckoTypes.PriceChangePercentageObject.PCP1h)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", CoingeckoMarketsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = params.Encode()
+
+	resp, err := api.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s, Status: %s", CoingeckoMarketsURL, body, resp.Status)
+	}
+	var market []coingeckoMarket
+	if err := json.Unmarshal(body, &market); err != nil {
+		return nil, err
+	}
+	return market, nil
+}
+
 func (api *Api) SubscriptionFixer(ctx context.Context) error {
 	span, ctx := sentryx.StartSpan(ctx, "subscription", sentry.TransactionName("SubscriptionFixer"))
 	defer span.Finish()
@@ -252,18 +459,21 @@ func (api *Api) SubscriptionFixer(ctx context.Context) error {
 		return fmt.Errorf("SubscriptionFixer: unmarshal body: %w", err)
 	}
 
+	now := time.Now()
+	fiats := make([]types.Prices, 0, len(api.StoreHandler.Cfg.WhitelistedFiats))
 	for _, fiat := range api.StoreHandler.Cfg.WhitelistedFiats {
 		fiatSymbol := types.USD + fiat
 		d, ok := data[fiat]
 		if !ok {
 			api.StoreHandler.Logger.Infow("SubscriptionFixer", "From the provider list of deliveries price for symbol not found", fiatSymbol)
-			return nil
-		}
-
-		now := time.Now()
-		if err = api.StoreHandler.Store.UpsertToken(ctx, store.FixerStore, fiatSymbol, d, now.Unix()); err != nil {
-			return fmt.Errorf("SubscriptionFixer, Store.UpsertToken(%s,%s,%f): %w", store.FixerStore, fiatSymbol, d, err)
+			continue
 		}
+		fiats = append(fiats, types.Prices{Symbol: fiatSymbol, Price: d, UpdatedAt: now.Unix()})
+	}
+	if err = api.StoreHandler.Store.UpsertTokens(ctx, store.FixerStore, fiats); err != nil {
+		return fmt.Errorf("SubscriptionFixer, Store.UpsertTokens(%s): %w", store.FixerStore, err)
 	}
+	daemon.AddRows(ctx, len(fiats))
+	api.StoreHandler.AuditQuotes(ctx, store.FixerStore, fiats)
 	return nil
 }
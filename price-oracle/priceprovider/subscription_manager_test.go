@@ -0,0 +1,85 @@
+package priceprovider_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/priceprovider"
+)
+
+func runSubscription(t *testing.T, timeout time.Duration, recoverCount int, fn daemon.AggFunc, options ...daemon.Option) (chan interface{}, chan error) {
+	t.Helper()
+	worker := priceprovider.SubscriptionManager(10*time.Millisecond, timeout)
+	runAsDaemon := daemon.MakeDaemon(timeout+20*time.Millisecond, recoverCount, worker, options...)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	return runAsDaemon(context.Background(), done, 5*time.Millisecond, zap.NewNop().Sugar(), &config.Config{}, fn)
+}
+
+func TestSubscriptionManager_ErrorsAreNotFatal(t *testing.T) {
+	var calls int32
+	_, errCh := runSubscription(t, time.Second, 0, func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("provider down")
+	})
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) >= 3 }, 5*time.Second, 10*time.Millisecond)
+	select {
+	case err := <-errCh:
+		t.Fatalf("unexpected fatal error: %v", err)
+	default:
+	}
+}
+
+func TestSubscriptionManager_RecoversPanics(t *testing.T) {
+	var calls int32
+	terminated := make(chan struct{})
+	policy := daemon.RestartPolicy{OnTerminal: func(string, error) { close(terminated) }}
+	_, errCh := runSubscription(t, time.Second, 2, func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		panic("provider bug")
+	}, daemon.WithRestartPolicy(policy))
+
+	// Restarted twice, then the daemon gives up.
+	var errs []error
+	for stopped := false; !stopped; {
+		select {
+		case err := <-errCh:
+			errs = append(errs, err)
+		case <-terminated:
+			stopped = true
+		}
+	}
+	require.Len(t, errs, 2)
+	for _, err := range errs {
+		require.ErrorIs(t, err, daemon.ErrWorkerPanicked)
+	}
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestSubscriptionManager_RestartsHungProvider(t *testing.T) {
+	var calls, cancelled int32
+	_, errCh := runSubscription(t, 50*time.Millisecond, 0, func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return nil
+		}
+		// Returns well after the call timeout, the worker does not beat meanwhile.
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+		atomic.AddInt32(&cancelled, 1)
+		return ctx.Err()
+	})
+
+	require.Equal(t, daemon.ErrWorkerRestarted, <-errCh)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > 1 && atomic.LoadInt32(&cancelled) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -13,6 +13,7 @@ import (
 
 	models "github.com/emerishq/demeris-backend-models/cns"
 	cnsDB "github.com/emerishq/emeris-cns-server/cns/database"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/sql"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
 
@@ -160,6 +161,66 @@ func TestSubscriptionFixer(t *testing.T) {
 	require.Equal(t, prices[1].Price, 0.806942)
 }
 
+func TestSubscriptionFixer_MissingRate(t *testing.T) {
+	b, err := json.Marshal(&types.Fixer{Success: true, Rates: []byte(`{"CHF": 0.933058, "KRW": 0.719154}`)})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	db := memory.NewDB()
+	storeHandler, err := store.NewStoreHandler(
+		store.WithDB(ctx, db),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(&config.Config{WhitelistedFiats: []string{"CHF", "EUR", "KRW"}}),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+
+	api := priceprovider.Api{
+		Client: newTestClient(func(req *http.Request) *http.Response {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}
+		}),
+		StoreHandler: storeHandler,
+	}
+	require.NoError(t, api.SubscriptionFixer(ctx))
+
+	// The rates Fixer has are written, EUR is skipped.
+	prices, err := db.GetPrices(ctx, store.FixerStore)
+	require.NoError(t, err)
+	require.Len(t, prices, 2)
+	require.Equal(t, "USDCHF", prices[0].Symbol)
+	require.Equal(t, "USDKRW", prices[1].Symbol)
+}
+
+func TestSubscriptionCoingecko_Cancelled(t *testing.T) {
+	db := memory.NewDB()
+	db.SetCNS([]memory.CNSChain{{ChainName: "cosmos-hub", Denoms: []memory.CNSDenom{{Name: "uatom", Ticker: "ATOM", PriceID: "cosmos", FetchPrice: true}}}})
+	storeHandler, err := store.NewStoreHandler(
+		store.WithDB(context.Background(), db),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(&config.Config{}),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+
+	// Coingecko only answers once the request is cancelled.
+	api := priceprovider.Api{
+		Client: newTestClient(func(req *http.Request) *http.Response {
+			<-req.Context().Done()
+			return &http.Response{
+				StatusCode: http.StatusGatewayTimeout,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}
+		}),
+		StoreHandler: storeHandler,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.Error(t, api.SubscriptionCoingecko(ctx))
+}
+
 type roundTripFunc func(req *http.Request) *http.Response
 
 func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -264,7 +325,7 @@ func getStoreHandler(t *testing.T, ts testserver.TestServer, logger *zap.Sugared
 		store.WithLogger(logger),
 		store.WithConfig(cfg),
 		store.WithSpotPriceCache(nil),
-		store.WithChartDataCache(nil, time.Second*1),
+		store.WithChartDataCache(nil, 0),
 	)
 	if err != nil {
 		return nil, err
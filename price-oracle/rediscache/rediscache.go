@@ -0,0 +1,97 @@
+// Package rediscache implements store.CacheBackend with Redis, to share the
+// caches of the oracle between its replicas.
+package rediscache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+// DefaultPrefix is prepended to the keys of the oracle, so that the Redis
+// database can be shared with other services.
+const DefaultPrefix = "emeris-price-oracle:"
+
+var _ store.CacheBackend = (*Cache)(nil)
+
+// Cache is a store.CacheBackend in Redis.
+type Cache struct {
+	client *redis.Client
+	prefix string
+}
+
+// New returns a Cache storing its keys in client, with prefix prepended.
+func New(client *redis.Client, prefix string) *Cache {
+	return &Cache{client: client, prefix: prefix}
+}
+
+// NewFromURL returns a Cache connected to the Redis server at url, e.g.
+// redis://:password@localhost:6379/0, with the keys prefixed by
+// DefaultPrefix.
+func NewFromURL(url string) (*Cache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	return New(redis.NewClient(opts), DefaultPrefix), nil
+}
+
+// Ping checks that the Redis server can be reached.
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the connections to the Redis server.
+func (c *Cache) Close() error {
+	return c.client.Close()
+}
+
+func (c *Cache) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if len(keys) == 0 {
+		return map[string][]byte{}, nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+	res, err := c.client.MGet(ctx, prefixed...).Result()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(keys))
+	for i, v := range res {
+		// MGET returns nil for the missing keys.
+		if s, ok := v.(string); ok {
+			values[keys[i]] = []byte(s)
+		}
+	}
+	return values, nil
+}
+
+func (c *Cache) SetMany(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, v := range values {
+			pipe.Set(ctx, c.prefix+key, v, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (c *Cache) DeleteMany(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+	return c.client.Del(ctx, prefixed...).Err()
+}
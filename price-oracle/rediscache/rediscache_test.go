@@ -0,0 +1,60 @@
+package rediscache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/rediscache"
+)
+
+func newCache(t *testing.T) (*rediscache.Cache, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c, err := rediscache.NewFromURL("redis://" + mr.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c, mr
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newCache(t)
+	require.NoError(t, c.Ping(ctx))
+
+	values, err := c.GetMany(ctx, []string{"a"})
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, time.Minute))
+	values, err = c.GetMany(ctx, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, values)
+
+	// Keys are prefixed, and expire.
+	require.True(t, mr.Exists(rediscache.DefaultPrefix+"a"))
+	require.NoError(t, c.DeleteMany(ctx, []string{"b", "c"}))
+	require.False(t, mr.Exists(rediscache.DefaultPrefix+"b"))
+	mr.FastForward(time.Minute)
+	values, err = c.GetMany(ctx, []string{"a"})
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestCache_Down(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newCache(t)
+	mr.Close()
+
+	_, err := c.GetMany(ctx, []string{"a"})
+	require.Error(t, err)
+	require.Error(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1")}, time.Minute))
+}
+
+func TestNewFromURL(t *testing.T) {
+	_, err := rediscache.NewFromURL("localhost:6379")
+	require.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errAdminDisabled = errors.New("admin endpoints are disabled")
+	errUnauthorized  = errors.New("unauthorized")
+)
+
+// adminAuth only lets through requests carrying the configured admin token as
+// a bearer token. Without a configured token, admin endpoints answer 404 as
+// if they did not exist.
+func (r *router) adminAuth(ctx *gin.Context) {
+	if r.s.c.AdminToken == "" {
+		e(ctx, http.StatusNotFound, errAdminDisabled)
+		return
+	}
+
+	token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(r.s.c.AdminToken)) != 1 {
+		ctx.Header("WWW-Authenticate", "Bearer")
+		e(ctx, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+	ctx.Next()
+}
@@ -1,11 +1,16 @@
 package rest
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/getsentry/sentry-go"
+	gecko "github.com/superoo7/go-gecko/v3"
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
 	ginzap "github.com/gin-contrib/zap"
@@ -20,10 +25,22 @@ import (
 )
 
 type Server struct {
-	l  *zap.SugaredLogger
-	sh *store.Handler
-	g  *gin.Engine
-	c  *config.Config
+	l   *zap.SugaredLogger
+	sh  *store.Handler
+	g   *gin.Engine
+	c   *config.Config
+	gc  *gecko.Client
+	srv *http.Server
+
+	// ctx is the context of the backfill the server runs in the background,
+	// cancelled by Shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// backfillMu is held while a backfill runs, and while checking ctx before
+	// starting one.
+	backfillMu sync.Mutex
+	// ready is 1 once SetReady is called.
+	ready int32
 }
 
 type router struct {
@@ -42,7 +59,10 @@ func NewServer(sh *store.Handler, l *zap.SugaredLogger, c *config.Config) *Serve
 		g:  g,
 		sh: sh,
 		c:  c,
+		gc: gecko.NewClient(&http.Client{Timeout: c.HttpClientTimeout}),
 	}
+	s.srv = &http.Server{Handler: g}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	r := &router{s: s}
 
@@ -54,8 +74,19 @@ func NewServer(sh *store.Handler, l *zap.SugaredLogger, c *config.Config) *Serve
 	g.Use(sentryx.GinMiddleware)
 
 	g.GET(r.getAllPrices())
+	g.GET(r.getPricesAt())
 	g.GET(r.getChartData())
+	g.GET(r.getChartCacheStats())
 	g.GET(r.getGeckoId())
+	g.GET(r.getCandles())
+	g.GET(r.getExport())
+	g.GET(r.getBackfillProgress())
+	g.GET(r.getAudit())
+	g.GET(r.getMarkets())
+	g.GET(r.getReady())
+	g.GET(r.getWorkers())
+	g.POST(r.startBackfill())
+	g.POST(r.controlWorker())
 	g.POST(r.getTokensPriceAndSupplies())
 	g.POST(r.getFiatsPrices())
 
@@ -66,8 +97,40 @@ func NewServer(sh *store.Handler, l *zap.SugaredLogger, c *config.Config) *Serve
 	return s
 }
 
+// Serve serves the REST API on where, e.g. ":8000", until Shutdown is called,
+// it then returns nil.
 func (s *Server) Serve(where string) error {
-	return s.g.Run(where)
+	l, err := net.Listen("tcp", where)
+	if err != nil {
+		return err
+	}
+	if err := s.srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops serving the REST API, once the ongoing requests are answered,
+// cancels the backfill the server runs in the background, if any, and waits
+// for it to return. It returns early with the error of ctx when ctx is done.
+// No backfill starts after.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.backfillMu.Lock()
+		s.backfillMu.Unlock() //nolint:staticcheck // Waits for the backfill.
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 type restError struct {
@@ -111,6 +174,17 @@ func e(c *gin.Context, status int, err error) {
 	c.AbortWithStatusJSON(status, jsonErr)
 }
 
+// isWhitelistedFiat returns true if (param:<fiat>) is one of (param:<whitelisted>),
+// case insensitive.
+func isWhitelistedFiat(fiat string, whitelisted []string) bool {
+	for _, f := range whitelisted {
+		if strings.EqualFold(f, fiat) {
+			return true
+		}
+	}
+	return false
+}
+
 // isSubset returns true if all element of (param:<subList>) in found in (param:<globalList>)
 func isSubset(subList []string, globalList []string) bool {
 	// Turn globalList into a map
@@ -9,7 +9,6 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
-	"sync"
 	"testing"
 	"time"
 
@@ -50,8 +49,8 @@ func TestRest(t *testing.T) {
 			{Symbol: "USDKRW", Price: 5},
 		},
 		Tokens: []types.TokenPriceAndSupply{
-			{Price: 10, Symbol: "ATOMUSDT", Supply: 113563929433.0},
-			{Price: 10, Symbol: "LUNAUSDT", Supply: 113563929433.0},
+			{Price: 10, Symbol: "ATOMUSDT", Supply: floatPtr(113563929433.0), CirculatingSupply: floatPtr(113563929433.0)},
+			{Price: 10, Symbol: "LUNAUSDT", Supply: floatPtr(113563929433.0), CirculatingSupply: floatPtr(113563929433.0)},
 		},
 	}
 	err := insertWantData(router, wantData)
@@ -209,12 +208,9 @@ func setup(t *testing.T) (router, *gin.Context, *httptest.ResponseRecorder, func
 
 	// Cache 1 day chart data for bitcoin-eur combo. Used in route_chartData_test.go
 	chartData := generateChartData(12*24, 0, 0)
-	chartDataCache := store.ChartDataCache{
-		Data:            map[string]map[string]*geckoTypes.CoinsIDMarketChart{"5M": {"bitcoin-eur": chartData}},
-		Mu:              sync.RWMutex{},
-		RefreshInterval: 3 * time.Minute,
-	}
-	storeHandler, err := getStoreHandler(t, tServer, logger, cfg, &chartDataCache)
+	chartDataCache := &store.ChartDataCache{}
+	chartDataCache.Set(store.GranularityMinute, "bitcoin-eur", chartData)
+	storeHandler, err := getStoreHandler(t, tServer, logger, cfg, chartDataCache)
 	require.NoError(t, err)
 
 	// Put dummy data in cns DB
@@ -251,7 +247,7 @@ func getStoreHandler(t *testing.T, ts testserver.TestServer, logger *zap.Sugared
 		store.WithLogger(logger),
 		store.WithConfig(cfg),
 		store.WithSpotPriceCache(nil),
-		store.WithChartDataCache(chart, chart.RefreshInterval /*not used in this case as chart is not nil*/),
+		store.WithChartDataCache(chart, 0),
 	)
 	if err != nil {
 		return nil, err
@@ -317,7 +313,7 @@ func insertWantData(r router, wantData types.AllPriceResponse) error {
 			return err
 		}
 
-		if err := r.s.sh.Store.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, t.Symbol, t.Supply); err != nil {
+		if err := r.s.sh.Store.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, t.Symbol, *t.Supply); err != nil {
 			return err
 		}
 	}
@@ -325,6 +321,10 @@ func insertWantData(r router, wantData types.AllPriceResponse) error {
 	return nil
 }
 
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
 func getFreePort() (int, error) {
 	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
 	if err != nil {
@@ -19,8 +19,8 @@ func TestAllPricesHandler(t *testing.T) {
 			{Symbol: "USDKRW", Price: 5},
 		},
 		Tokens: []types.TokenPriceAndSupply{
-			{Price: 10, Symbol: "ATOMUSDT", Supply: 113563929433.0},
-			{Price: 10, Symbol: "LUNAUSDT", Supply: 113563929433.0},
+			{Price: 10, Symbol: "ATOMUSDT", Supply: floatPtr(113563929433.0), CirculatingSupply: floatPtr(113563929433.0)},
+			{Price: 10, Symbol: "LUNAUSDT", Supply: floatPtr(113563929433.0), CirculatingSupply: floatPtr(113563929433.0)},
 		},
 	}
 	err := insertWantData(router, wantData)
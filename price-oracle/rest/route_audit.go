@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const getAudit = "/audit/:symbol"
+
+// maxAuditWindow is the longest time window a single audit request can ask
+// for.
+const maxAuditWindow = 24 * time.Hour
+
+// auditHandler returns the audit log of a symbol, e.g. ATOMUSDT or USDEUR:
+// the raw quotes of the providers and the aggregation decisions.
+func (r *router) auditHandler(ctx *gin.Context) {
+	var reqQueries struct {
+		From int64 `form:"from"`
+		To   int64 `form:"to"`
+	}
+	if err := ctx.ShouldBindQuery(&reqQueries); err != nil {
+		r.s.l.Errorw("Invalid request query:", "error", err)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query"))
+		return
+	}
+
+	to := reqQueries.To // Optional query param, default now.
+	if to == 0 {
+		to = time.Now().Unix()
+	}
+	from := reqQueries.From // Optional query param, default an hour before to.
+	if from == 0 {
+		from = to - int64(time.Hour.Seconds())
+	}
+	if from > to {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: from is after to"))
+		return
+	}
+	if to-from > int64(maxAuditWindow.Seconds()) {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: window longer than %s", maxAuditWindow))
+		return
+	}
+
+	symbol := strings.ToUpper(ctx.Param("symbol"))
+	entries, err := r.s.sh.Store.GetAudit(ctx.Request.Context(), symbol, from, to)
+	if err != nil {
+		r.s.l.Errorw("Store.GetAudit()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+func (r *router) getAudit() (string, gin.HandlerFunc, gin.HandlerFunc) {
+	return getAudit, r.adminAuth, r.auditHandler
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	router, _, _, tDown := setup(t)
+	defer tDown()
+	router.s.c.AdminToken = "secret"
+
+	s := NewServer(router.s.sh, router.s.l, router.s.c)
+	ch := make(chan struct{})
+	go func() {
+		close(ch)
+		err := s.Serve(router.s.c.ListenAddr)
+		if err != nil {
+			require.Contains(t, err.Error(), "address already in use")
+		}
+	}()
+	<-ch // Wait for the goroutine to start. Still hack!!
+
+	entries := []types.AuditEntry{
+		{Symbol: "ATOMUSDT", CreatedAt: 100, Kind: types.AuditQuote, Source: store.BinanceStore, Price: 10, QuotedAt: 100},
+		{Symbol: "ATOMUSDT", CreatedAt: 110, Kind: types.AuditInput, Source: store.BinanceStore, Price: 10, QuotedAt: 100},
+		{Symbol: "ATOMUSDT", CreatedAt: 110, Kind: types.AuditOutput, Source: store.TokensStore, Price: 10},
+	}
+	require.NoError(t, router.s.sh.Store.AppendAudit(context.Background(), entries))
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		want       []types.AuditEntry
+	}{
+		{"no token", "/audit/atomusdt?from=0&to=200", "", http.StatusUnauthorized, nil},
+		{"from after to", "/audit/atomusdt?from=200&to=100", "secret", http.StatusBadRequest, nil},
+		{"window too long", "/audit/atomusdt?from=0&to=100000", "secret", http.StatusBadRequest, nil},
+		{"window", "/audit/atomusdt?from=105&to=200", "secret", http.StatusOK, entries[1:]},
+		{"unknown symbol", "/audit/nope?from=0&to=200", "secret", http.StatusOK, []types.AuditEntry{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s%s", router.s.c.ListenAddr, tt.path), nil)
+			require.NoError(t, err)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			require.Equal(t, tt.wantStatus, resp.StatusCode, string(body))
+			if tt.want == nil {
+				return
+			}
+
+			var got struct {
+				Data []types.AuditEntry `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(body, &got))
+			require.Equal(t, tt.want, got.Data)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const backfillRoute = "/backfill"
+
+var (
+	errBackfillRunning = errors.New("a backfill is already running")
+	errShuttingDown    = errors.New("server shutting down")
+)
+
+type backfillRequest struct {
+	Tokens []string `json:"tokens" binding:"required"`
+	From   int64    `json:"from" binding:"required"`
+	To     int64    `json:"to" binding:"required"`
+}
+
+// startBackfillHandler starts a backfill of the price history in the
+// background, until it is done or the server shuts down. Only one backfill
+// runs at a time, its progress is served by backfillProgressHandler.
+func (r *router) startBackfillHandler(ctx *gin.Context) {
+	var req backfillRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		r.s.l.Errorw("Backfill", "error", err.Error())
+		e(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if req.From > req.To {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: from is after to"))
+		return
+	}
+	if len(req.Tokens) == 0 {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", errZeroAsset))
+		return
+	}
+
+	// Check the tokens now, the caller won't see errors of the backfill.
+	geckoIDs, err := r.s.sh.GetGeckoIdForTokenNames(ctx.Request.Context(), append([]string(nil), req.Tokens...))
+	if err != nil {
+		r.s.l.Errorw("store.GetGeckoIdForTokenNames()", "error", err.Error())
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	var unknown []string
+	for name, id := range geckoIDs {
+		if id == "" {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("no gecko id for tokens %s", strings.Join(unknown, ", ")))
+		return
+	}
+
+	if !r.s.backfillMu.TryLock() {
+		e(ctx, http.StatusConflict, errBackfillRunning)
+		return
+	}
+	if r.s.ctx.Err() != nil {
+		r.s.backfillMu.Unlock()
+		e(ctx, http.StatusServiceUnavailable, errShuttingDown)
+		return
+	}
+	go func() {
+		defer r.s.backfillMu.Unlock()
+		if err := r.s.sh.Backfill(r.s.ctx, r.s.gc, req.Tokens, req.From, req.To); err != nil {
+			r.s.l.Errorw("Backfill", "error", err.Error())
+			return
+		}
+		r.s.l.Infow("Backfill", "tokens", req.Tokens, "from", req.From, "to", req.To, "status", "done")
+	}()
+
+	ctx.JSON(http.StatusAccepted, req)
+}
+
+// backfillProgressHandler returns the progress of all the backfills, running
+// or past.
+func (r *router) backfillProgressHandler(ctx *gin.Context) {
+	progress, err := r.s.sh.Store.GetBackfillProgress(ctx.Request.Context())
+	if err != nil {
+		r.s.l.Errorw("Store.GetBackfillProgress()", "error", err.Error())
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, progress)
+}
+
+func (r *router) startBackfill() (string, gin.HandlerFunc, gin.HandlerFunc) {
+	return backfillRoute, r.adminAuth, r.startBackfillHandler
+}
+
+func (r *router) getBackfillProgress() (string, gin.HandlerFunc, gin.HandlerFunc) {
+	return backfillRoute, r.adminAuth, r.backfillProgressHandler
+}
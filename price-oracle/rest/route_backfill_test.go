@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	router, _, _, tDown := setup(t)
+	defer tDown()
+	router.s.c.AdminToken = "secret"
+
+	s := NewServer(router.s.sh, router.s.l, router.s.c)
+	ch := make(chan struct{})
+	go func() {
+		close(ch)
+		err := s.Serve(router.s.c.ListenAddr)
+		if err != nil {
+			require.Contains(t, err.Error(), "address already in use")
+		}
+	}()
+	<-ch // Wait for the goroutine to start. Still hack!!
+
+	progress := types.BackfillProgress{Symbol: "ATOMUSDT", GeckoID: "cosmos", From: 100, To: 200, DoneUntil: 150, UpdatedAt: 10}
+	require.NoError(t, router.s.sh.Store.UpsertBackfillProgress(context.Background(), progress))
+
+	do := func(method string, body string, token string) (int, []byte) {
+		req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", router.s.c.ListenAddr, backfillRoute), strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, b
+	}
+
+	t.Run("progress", func(t *testing.T) {
+		status, body := do(http.MethodGet, "", "secret")
+		require.Equal(t, http.StatusOK, status, string(body))
+		var got []types.BackfillProgress
+		require.NoError(t, json.Unmarshal(body, &got))
+		require.Equal(t, []types.BackfillProgress{progress}, got)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		token      string
+		wantStatus int
+	}{
+		{"no token", `{"tokens":["atom"],"from":100,"to":200}`, "", http.StatusUnauthorized},
+		{"invalid body", `{"tokens":"atom"}`, "secret", http.StatusBadRequest},
+		{"from after to", `{"tokens":["atom"],"from":200,"to":100}`, "secret", http.StatusBadRequest},
+		{"unknown token", `{"tokens":["atom","nope"],"from":100,"to":200}`, "secret", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(http.MethodPost, tt.body, tt.token)
+			require.Equal(t, tt.wantStatus, status, string(body))
+		})
+	}
+
+	t.Run("already running", func(t *testing.T) {
+		s.backfillMu.Lock()
+		defer s.backfillMu.Unlock()
+		status, body := do(http.MethodPost, `{"tokens":["atom"],"from":100,"to":200}`, "secret")
+		require.Equal(t, http.StatusConflict, status, string(body))
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		require.NoError(t, s.Shutdown(context.Background()))
+		// The listener is closed, the requests already accepted are served.
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, backfillRoute, strings.NewReader(`{"tokens":["atom"],"from":100,"to":200}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		s.g.ServeHTTP(w, req)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+	})
+}
@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/gin-gonic/gin"
+)
+
+const getCandles = "/candles/:symbol"
+
+// maxCandles is the maximum number of candles a single request can ask for.
+const maxCandles = 1000
+
+var validIntervals = map[string]time.Duration{"5m": 5 * time.Minute, "1h": time.Hour, "1d": 24 * time.Hour}
+
+func (r *router) candlesHandler(ctx *gin.Context) {
+	var reqQueries struct {
+		Interval string `form:"interval"`
+		From     int64  `form:"from"`
+		To       int64  `form:"to"`
+		Currency string `form:"vs_currency"`
+	}
+	if err := ctx.ShouldBindQuery(&reqQueries); err != nil {
+		r.s.l.Errorw("Invalid request query:", "error", err)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query"))
+		return
+	}
+
+	interval, ok := validIntervals[reqQueries.Interval]
+	if !ok {
+		r.s.l.Errorw("Invalid request query:", "interval", reqQueries.Interval)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: interval must be one of 5m, 1h, 1d"))
+		return
+	}
+
+	to := reqQueries.To // Optional query param, default now.
+	if to == 0 {
+		to = time.Now().Unix()
+	}
+	from := reqQueries.From // Optional query param, default as many candles as allowed.
+	if from == 0 {
+		from = to - int64(interval.Seconds())*(maxCandles-1)
+	}
+	if from > to {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: from is after to"))
+		return
+	}
+	if (to-from)/int64(interval.Seconds()) >= maxCandles {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: more than %d candles requested", maxCandles))
+		return
+	}
+
+	vsCurrency := strings.ToLower(reqQueries.Currency) // Optional query param, default usd.
+	if vsCurrency == "" {
+		vsCurrency = "usd"
+	}
+	if !strings.EqualFold(vsCurrency, types.USD) && !isWhitelistedFiat(vsCurrency, r.s.c.WhitelistedFiats) {
+		r.s.l.Errorw("Invalid request query: fiat name not whitelisted", "fiat name:", vsCurrency)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: fiat name not whitelisted"))
+		return
+	}
+
+	symbol := strings.ToUpper(ctx.Param("symbol"))
+	whitelistedTokens, err := r.s.sh.GetCNSWhitelistedTokens(ctx.Request.Context())
+	if err != nil {
+		r.s.l.Errorw("Store.GetCNSWhitelistedTokens()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	if !isSubset([]string{symbol}, whitelistedTokens) {
+		e(ctx, http.StatusForbidden, errNotWhitelistedAsset)
+		return
+	}
+
+	candles, err := r.s.sh.GetCandles(ctx.Request.Context(), symbol, interval, from, to, vsCurrency)
+	if err != nil {
+		r.s.l.Errorw("Store.GetCandles()", "error", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrUnknownFiatRate) {
+			status = http.StatusNotFound
+		}
+		e(ctx, status, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    candles,
+		"message": nil,
+	})
+}
+
+func (r *router) getCandles() (string, gin.HandlerFunc) {
+	return getCandles, r.candlesHandler
+}
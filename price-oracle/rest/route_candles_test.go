@@ -0,0 +1,102 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandles(t *testing.T) {
+	router, _, _, tDown := setup(t)
+	defer tDown()
+
+	s := NewServer(router.s.sh, router.s.l, router.s.c)
+	ch := make(chan struct{})
+	go func() {
+		close(ch)
+		err := s.Serve(router.s.c.ListenAddr)
+		if err != nil {
+			require.Contains(t, err.Error(), "address already in use")
+		}
+	}()
+	<-ch // Wait for the goroutine to start. Still hack!!
+
+	// Two hours of ATOM history, one sample every 5 minutes, price going up by 1.
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Hour).Unix()
+	history := make([]types.HistoricalPrice, 0, 24)
+	for i := 0; i < 24; i++ {
+		history = append(history, types.HistoricalPrice{
+			Symbol:    "ATOMUSDT",
+			Price:     float64(i + 1),
+			Volume:    2400,
+			UpdatedAt: start + int64(i*5*60),
+		})
+	}
+	require.NoError(t, router.s.sh.Store.UpsertPriceHistory(context.Background(), history))
+	require.NoError(t, router.s.sh.Store.UpsertPrice(context.Background(), store.FiatsStore, 2, "USDEUR"))
+
+	tests := []struct {
+		name     string
+		currency string
+		want     []types.Candle
+	}{
+		{
+			"usd",
+			"usd",
+			[]types.Candle{
+				{Time: start, Open: 1, High: 12, Low: 1, Close: 12, Volume: 100},
+				{Time: start + 3600, Open: 13, High: 24, Low: 13, Close: 24, Volume: 100},
+			},
+		},
+		{
+			"eur",
+			"eur",
+			[]types.Candle{
+				{Time: start, Open: 2, High: 24, Low: 2, Close: 24, Volume: 200},
+				{Time: start + 3600, Open: 26, High: 48, Low: 26, Close: 48, Volume: 200},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(fmt.Sprintf("http://%s/candles/atom?interval=1h&from=%d&to=%d&vs_currency=%s",
+				router.s.c.ListenAddr, start, start+2*3600-1, tt.currency))
+			require.NoError(t, err)
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			err = resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+			var got struct {
+				Data []types.Candle `json:"data"`
+			}
+			err = json.Unmarshal(body, &got)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got.Data)
+		})
+	}
+
+	for name, query := range map[string]string{
+		"invalid interval": "interval=2h",
+		"too many candles": "interval=5m&from=1&to=1000000",
+		"not whitelisted":  "interval=1h&vs_currency=bdt",
+		"from is after to": "interval=1h&from=10&to=1",
+	} {
+		resp, err := http.Get(fmt.Sprintf("http://%s/candles/atom?%s", router.s.c.ListenAddr, query))
+		require.NoError(t, err, name)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"net/http"
 	"strings"
 
-	gecko "github.com/superoo7/go-gecko/v3"
-
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
 	"github.com/gin-gonic/gin"
 )
 
-const getChartData = "/chart/:id"
+const (
+	getChartData       = "/chart/:id"
+	getChartCacheStats = "/chartcache"
+)
 
 var validDays = map[string]struct{}{"1": {}, "7": {}, "14": {}, "30": {}, "90": {}, "365": {}, "max": {}}
 
@@ -35,14 +37,7 @@ func (r *router) chartDataHandler(ctx *gin.Context) {
 	if vsCurrency == "" {
 		vsCurrency = "usd"
 	}
-	ok := false
-	for _, fiat := range r.s.c.WhitelistedFiats {
-		if strings.EqualFold(fiat, vsCurrency) {
-			ok = true
-			break
-		}
-	}
-	if !ok {
+	if !strings.EqualFold(vsCurrency, types.USD) && !isWhitelistedFiat(vsCurrency, r.s.c.WhitelistedFiats) {
 		r.s.l.Errorw("Invalid request query: fiat name not whitelisted", "fiat name:", vsCurrency)
 		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: fiat name not whitelisted"))
 		return
@@ -54,8 +49,7 @@ func (r *router) chartDataHandler(ctx *gin.Context) {
 		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request id: coinID empty"))
 		return
 	}
-	geckoClient := gecko.NewClient(&http.Client{Timeout: r.s.c.HttpClientTimeout})
-	chartData, err := r.s.sh.GetChartData(ctx.Request.Context(), coinId, reqQueries.Days, reqQueries.Currency, geckoClient)
+	chartData, err := r.s.sh.GetChartData(ctx.Request.Context(), coinId, reqQueries.Days, vsCurrency, r.s.gc)
 	if err != nil {
 		r.s.l.Errorw("Store.GetChartData()", "error", err)
 		e(ctx, http.StatusInternalServerError, err)
@@ -72,3 +66,16 @@ func (r *router) chartDataHandler(ctx *gin.Context) {
 func (r *router) getChartData() (string, gin.HandlerFunc) {
 	return getChartData, r.chartDataHandler
 }
+
+// chartCacheStatsHandler returns the counters of the chart cache.
+func (r *router) chartCacheStatsHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    r.s.sh.ChartCache.Stats(),
+		"message": nil,
+	})
+}
+
+func (r *router) getChartCacheStats() (string, gin.HandlerFunc) {
+	return getChartCacheStats, r.chartCacheStatsHandler
+}
@@ -6,8 +6,12 @@ import (
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/gin-gonic/gin"
+	gecko "github.com/superoo7/go-gecko/v3"
 	geckoTypes "github.com/superoo7/go-gecko/v3/types"
 )
 
@@ -46,4 +50,50 @@ func TestChartData(t *testing.T) {
 
 	require.NotNil(t, got.Data.Prices)
 	require.Equal(t, got.Data, generateChartData(12*24, 0, 0))
+
+	resp, err = http.Get(fmt.Sprintf("http://%s%s", router.s.c.ListenAddr, getChartCacheStats))
+	require.NoError(t, err)
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	var stats struct {
+		Data store.ChartCacheStats `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(body, &stats))
+	require.EqualValues(t, 1, stats.Data.Hits)
+	require.Equal(t, 1, stats.Data.Entries)
+	require.Positive(t, stats.Data.Bytes)
+}
+
+func TestChartData_DefaultCurrency(t *testing.T) {
+	router, ctx, w, tDown := setup(t)
+	defer tDown()
+
+	// Only the usd chart is cached, Coingecko must not be asked for another one.
+	router.s.sh.ChartCache.Set(store.GranularityMinute, "bitcoin-usd", generateChartData(12*24, 0, 0))
+	var clientInvoked int
+	router.s.gc = gecko.NewClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		clientInvoked++
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody}
+	})})
+
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/chart/bitcoin?days=1", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: "bitcoin"}}
+	router.chartDataHandler(ctx)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 0, clientInvoked)
+
+	var got struct {
+		Data *geckoTypes.CoinsIDMarketChart `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, generateChartData(12*24, 0, 0), got.Data)
+}
+
+type roundTripFunc func(req *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
 }
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/export"
+	"github.com/gin-gonic/gin"
+)
+
+const getExport = "/export"
+
+func (r *router) exportHandler(ctx *gin.Context) {
+	var reqQueries struct {
+		Symbols string `form:"symbols"`
+		// Optional, see export.Range for the defaults.
+		From   *int64 `form:"from"`
+		To     *int64 `form:"to"`
+		Format string `form:"format"`
+	}
+	if err := ctx.ShouldBindQuery(&reqQueries); err != nil {
+		r.s.l.Errorw("Invalid request query:", "error", err)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query"))
+		return
+	}
+
+	var symbols []string
+	for _, s := range strings.Split(reqQueries.Symbols, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			symbols = append(symbols, strings.ToUpper(s))
+		}
+	}
+	if len(symbols) == 0 {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: %w", errZeroAsset))
+		return
+	}
+	from, to, err := export.Range(reqQueries.From, reqQueries.To, time.Now())
+	if err != nil {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: %w", err))
+		return
+	}
+
+	format := export.FormatCSV // Optional query param, default csv.
+	if reqQueries.Format != "" {
+		if format, err = export.ParseFormat(reqQueries.Format); err != nil {
+			e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: %w", err))
+			return
+		}
+	}
+
+	ctx.Header("Content-Type", format.ContentType())
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=pricehistory-%d-%d.%s", from, to, format))
+	ctx.Status(http.StatusOK)
+
+	err = export.Write(ctx.Request.Context(), r.s.sh.Store, ctx.Writer, export.Request{
+		Symbols: symbols,
+		From:    from,
+		To:      to,
+		Format:  format,
+	})
+	if err != nil {
+		r.s.l.Errorw("export.Write()", "error", err)
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.Writer.Header().Del("Content-Disposition")
+			e(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		// Part of the export is sent already, along with its status.
+		_ = ctx.Error(err)
+	}
+}
+
+func (r *router) getExport() (string, gin.HandlerFunc, gin.HandlerFunc) {
+	return getExport, r.adminAuth, r.exportHandler
+}
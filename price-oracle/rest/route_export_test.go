@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	router, _, _, tDown := setup(t)
+	defer tDown()
+	router.s.c.AdminToken = "secret"
+
+	s := NewServer(router.s.sh, router.s.l, router.s.c)
+	ch := make(chan struct{})
+	go func() {
+		close(ch)
+		err := s.Serve(router.s.c.ListenAddr)
+		if err != nil {
+			require.Contains(t, err.Error(), "address already in use")
+		}
+	}()
+	<-ch // Wait for the goroutine to start. Still hack!!
+
+	require.NoError(t, router.s.sh.Store.UpsertPriceHistory(context.Background(), []types.HistoricalPrice{
+		{Symbol: "ATOMUSDT", Price: 10, MarketCap: 100, Volume: 1000, UpdatedAt: 100},
+		{Symbol: "ATOMUSDT", Price: 11, MarketCap: 110, Volume: 1100, UpdatedAt: 200},
+		{Symbol: "OSMOUSDT", Price: 1, MarketCap: 10, Volume: 100, UpdatedAt: 100},
+	}))
+
+	tests := []struct {
+		name       string
+		query      string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"no token",
+			"symbols=atomusdt&from=0&to=200",
+			"",
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"wrong token",
+			"symbols=atomusdt&from=0&to=200",
+			"guess",
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"no symbols",
+			"from=0&to=200",
+			"secret",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"to is zero",
+			"symbols=atomusdt&to=0",
+			"secret",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"range too long",
+			"symbols=atomusdt&from=0&to=100000000",
+			"secret",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"unknown format",
+			"symbols=atomusdt&from=0&to=200&format=xlsx",
+			"secret",
+			http.StatusBadRequest,
+			"",
+		},
+		{
+			"csv",
+			"symbols=atomusdt,OSMOUSDT&from=0&to=150",
+			"secret",
+			http.StatusOK,
+			"symbol,price,marketcap,volume,updatedat\nATOMUSDT,10,100,1000,100\nOSMOUSDT,1,10,100,100\n",
+		},
+		{
+			"jsonl",
+			"symbols=atomusdt&from=150&to=200&format=jsonl",
+			"secret",
+			http.StatusOK,
+			`{"symbol":"ATOMUSDT","price":11,"marketcap":110,"volume":1100,"updatedat":200}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s%s?%s", router.s.c.ListenAddr, getExport, tt.query), nil)
+			require.NoError(t, err)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			err = resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, tt.wantStatus, resp.StatusCode, string(body))
+			if tt.wantBody != "" {
+				require.Equal(t, tt.wantBody, string(body))
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		router.s.c.AdminToken = ""
+		defer func() { router.s.c.AdminToken = "secret" }()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s%s?symbols=atomusdt", router.s.c.ListenAddr, getExport), nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer ")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/gin-gonic/gin"
+)
+
+const getMarketsRoute = "/markets"
+
+// marketsHandler returns the market data of the comma separated tokens, e.g.
+// ATOMUSDT,OSMOUSDT, or of all the whitelisted tokens when none is given.
+func (r *router) marketsHandler(ctx *gin.Context) {
+	var reqQueries struct {
+		Tokens string `form:"tokens"`
+	}
+	if err := ctx.ShouldBindQuery(&reqQueries); err != nil {
+		r.s.l.Errorw("Invalid request query:", "error", err)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query"))
+		return
+	}
+
+	whitelistedTokens, err := r.s.sh.GetCNSWhitelistedTokens(ctx.Request.Context())
+	if err != nil {
+		r.s.l.Errorw("Store.GetCNSWhitelistedTokens()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	whitelistedSymbols := make([]string, 0, len(whitelistedTokens))
+	for _, token := range whitelistedTokens {
+		whitelistedSymbols = append(whitelistedSymbols, token+types.USDT)
+	}
+
+	tokens := whitelistedSymbols
+	if reqQueries.Tokens != "" {
+		tokens = strings.Split(strings.ToUpper(reqQueries.Tokens), ",")
+		if len(tokens) > r.s.c.MaxAssetsReq {
+			e(ctx, http.StatusForbidden, errAssetLimitExceed)
+			return
+		}
+		if !isSubset(tokens, whitelistedSymbols) {
+			e(ctx, http.StatusForbidden, errNotWhitelistedAsset)
+			return
+		}
+	}
+
+	markets, err := r.s.sh.Store.GetMarkets(ctx.Request.Context(), tokens)
+	if err != nil {
+		r.s.l.Errorw("Store.GetMarkets()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    markets,
+		"message": nil,
+	})
+}
+
+func (r *router) getMarkets() (string, gin.HandlerFunc) {
+	return getMarketsRoute, r.marketsHandler
+}
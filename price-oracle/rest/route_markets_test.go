@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkets(t *testing.T) {
+	router, _, _, tDown := setup(t)
+	defer tDown()
+
+	s := NewServer(router.s.sh, router.s.l, router.s.c)
+	ch := make(chan struct{})
+	go func() {
+		close(ch)
+		err := s.Serve(router.s.c.ListenAddr)
+		if err != nil {
+			require.Contains(t, err.Error(), "address already in use")
+		}
+	}()
+	<-ch // Wait for the goroutine to start. Still hack!!
+
+	markets := []types.TokenMarket{
+		{Symbol: "ATOMUSDT", MarketCap: 3e9, Volume24h: 2e8, High24h: 11, Low24h: 9, PriceChange24h: 1, PriceChangePercentage24h: 10, UpdatedAt: 100},
+		{Symbol: "LUNAUSDT", MarketCap: 1e9, Volume24h: 1e8, High24h: 2, Low24h: 1, PriceChange24h: -0.5, PriceChangePercentage24h: -25, UpdatedAt: 100},
+	}
+	require.NoError(t, router.s.sh.Store.UpsertMarkets(context.Background(), markets))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []types.TokenMarket
+	}{
+		{"all whitelisted", "", http.StatusOK, markets},
+		{"some", "tokens=lunausdt", http.StatusOK, markets[1:]},
+		{"not whitelisted", "tokens=ATOMUSDT,DOGEUSDT", http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(fmt.Sprintf("http://%s%s?%s", router.s.c.ListenAddr, getMarketsRoute, tt.query))
+			require.NoError(t, err)
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			err = resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, tt.wantStatus, resp.StatusCode, string(body))
+			if tt.want == nil {
+				return
+			}
+
+			var got struct {
+				Data []types.TokenMarket `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(body, &got))
+			require.Equal(t, tt.want, got.Data)
+		})
+	}
+
+	t.Run("tokens with market", func(t *testing.T) {
+		err := insertWantData(router, types.AllPriceResponse{Tokens: []types.TokenPriceAndSupply{
+			{Price: 10, Symbol: "ATOMUSDT", Supply: floatPtr(300000000)},
+		}})
+		require.NoError(t, err)
+
+		jsonBytes, err := json.Marshal(types.Tokens{Tokens: []string{"ATOMUSDT"}})
+		require.NoError(t, err)
+		resp, err := http.Post(fmt.Sprintf("http://%s%s?market=true", router.s.c.ListenAddr, getTokensPricesRoute), "application/json", bytes.NewReader(jsonBytes))
+		require.NoError(t, err)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+		var got struct {
+			Data []struct {
+				Symbol string
+				Price  float64
+				Market *types.TokenMarket
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(body, &got))
+		require.Len(t, got.Data, 1)
+		require.Equal(t, "ATOMUSDT", got.Data[0].Symbol)
+		require.Equal(t, &markets[0], got.Data[0].Market)
+	})
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/gin-gonic/gin"
+)
+
+const getPricesAtRoute = "/prices/at"
+
+const (
+	defaultPriceAtTolerance = time.Hour
+	maxPriceAtTolerance     = 7 * 24 * time.Hour
+)
+
+func (r *router) pricesAtHandler(ctx *gin.Context) {
+	var reqQueries struct {
+		Tokens    string `form:"tokens"`
+		Fiats     string `form:"fiats"`
+		Timestamp int64  `form:"timestamp"`
+		Tolerance string `form:"tolerance"`
+	}
+	if err := ctx.ShouldBindQuery(&reqQueries); err != nil {
+		r.s.l.Errorw("Invalid request query:", "error", err)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query"))
+		return
+	}
+	if reqQueries.Timestamp <= 0 {
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: timestamp required"))
+		return
+	}
+
+	tolerance := defaultPriceAtTolerance // Optional query param, default 1 hour.
+	if reqQueries.Tolerance != "" {
+		var err error
+		tolerance, err = time.ParseDuration(reqQueries.Tolerance)
+		if err != nil || tolerance < 0 || tolerance > maxPriceAtTolerance {
+			e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query: tolerance must be a duration up to %s", maxPriceAtTolerance))
+			return
+		}
+	}
+
+	var tokens, fiats []string
+	if reqQueries.Tokens != "" {
+		tokens = strings.Split(strings.ToUpper(reqQueries.Tokens), ",")
+	}
+	if reqQueries.Fiats != "" {
+		fiats = strings.Split(strings.ToUpper(reqQueries.Fiats), ",")
+	}
+
+	if len(tokens)+len(fiats) == 0 || len(tokens)+len(fiats) > r.s.c.MaxAssetsReq {
+		err := errZeroAsset
+		if len(tokens)+len(fiats) > r.s.c.MaxAssetsReq {
+			err = errAssetLimitExceed
+		}
+		e(ctx, http.StatusForbidden, err)
+		return
+	}
+
+	whitelistedTokens, err := r.s.sh.GetCNSWhitelistedTokens(ctx.Request.Context())
+	if err != nil {
+		r.s.l.Errorw("Store.GetCNSWhitelistedTokens()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	whitelistedSymbols := make([]string, 0, len(whitelistedTokens)+len(r.s.c.WhitelistedFiats))
+	for _, token := range whitelistedTokens {
+		whitelistedSymbols = append(whitelistedSymbols, token+types.USDT)
+	}
+	for _, fiat := range r.s.c.WhitelistedFiats {
+		whitelistedSymbols = append(whitelistedSymbols, types.USD+fiat)
+	}
+	if !isSubset(append(append([]string(nil), tokens...), fiats...), whitelistedSymbols) {
+		e(ctx, http.StatusForbidden, errNotWhitelistedAsset)
+		return
+	}
+
+	prices, err := r.s.sh.GetPricesAt(ctx.Request.Context(), tokens, fiats, reqQueries.Timestamp, tolerance, r.s.gc)
+	if err != nil {
+		r.s.l.Errorw("Store.GetPricesAt()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    prices,
+		"message": nil,
+	})
+}
+
+func (r *router) getPricesAt() (string, gin.HandlerFunc) {
+	return getPricesAtRoute, r.pricesAtHandler
+}
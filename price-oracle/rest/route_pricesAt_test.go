@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPricesAt(t *testing.T) {
+	router, _, _, tDown := setup(t)
+	defer tDown()
+
+	s := NewServer(router.s.sh, router.s.l, router.s.c)
+	ch := make(chan struct{})
+	go func() {
+		close(ch)
+		err := s.Serve(router.s.c.ListenAddr)
+		if err != nil {
+			require.Contains(t, err.Error(), "address already in use")
+		}
+	}()
+	<-ch // Wait for the goroutine to start. Still hack!!
+
+	// 2020-09-13 12:26:40 UTC, far from midnight: no Coingecko fallback.
+	at := int64(1600000000)
+	err := router.s.sh.Store.UpsertPriceHistory(context.Background(), []types.HistoricalPrice{
+		{Symbol: "ATOMUSDT", Price: 5, UpdatedAt: at - 60},
+		{Symbol: "USDEUR", Price: 0.8, UpdatedAt: at + 30},
+	})
+	require.NoError(t, err)
+
+	resp, err := http.Get(fmt.Sprintf("http://%s%s?tokens=ATOMUSDT&fiats=USDEUR&timestamp=%d&tolerance=5m",
+		router.s.c.ListenAddr, getPricesAtRoute, at))
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	err = resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+	var got struct {
+		Data []types.PriceAt `json:"data"`
+	}
+	err = json.Unmarshal(body, &got)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []types.PriceAt{
+		{Symbol: "ATOMUSDT", Price: 5, Timestamp: at - 60, Offset: -60, Source: "local"},
+		{Symbol: "USDEUR", Price: 0.8, Timestamp: at + 30, Offset: 30, Source: "local"},
+	}, got.Data)
+
+	for name, want := range map[string]struct {
+		query  string
+		status int
+	}{
+		"No timestamp":      {"tokens=ATOMUSDT", http.StatusBadRequest},
+		"Invalid tolerance": {fmt.Sprintf("tokens=ATOMUSDT&timestamp=%d&tolerance=1y", at), http.StatusBadRequest},
+		"No asset":          {fmt.Sprintf("timestamp=%d", at), http.StatusForbidden},
+		"Not whitelisted":   {fmt.Sprintf("tokens=DOTUSDT&timestamp=%d", at), http.StatusForbidden},
+	} {
+		resp, err := http.Get(fmt.Sprintf("http://%s%s?%s", router.s.c.ListenAddr, getPricesAtRoute, want.query))
+		require.NoError(t, err, name)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, want.status, resp.StatusCode, name)
+	}
+}
@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const getReady = "/ready"
+
+// SetReady makes /ready succeed, once the caches of the server are warm.
+func (s *Server) SetReady() {
+	atomic.StoreInt32(&s.ready, 1)
+}
+
+// readyHandler tells whether the server is ready to serve requests. It is
+// not while a worker is terminated, i.e. its daemon gave up on it, until the
+// worker is restarted.
+func (r *router) readyHandler(ctx *gin.Context) {
+	for _, worker := range r.s.sh.Workers.All() {
+		if worker.Terminated {
+			err := fmt.Errorf("worker %s stopped: %s", worker.Name, worker.LastError)
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, restError{Error: err.Error()})
+			return
+		}
+	}
+	if atomic.LoadInt32(&r.s.ready) == 0 {
+		// Not an error worth reporting, the server is starting.
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, restError{Error: "warming up"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    "ready",
+		"message": nil,
+	})
+}
+
+func (r *router) getReady() (string, gin.HandlerFunc) {
+	return getReady, r.readyHandler
+}
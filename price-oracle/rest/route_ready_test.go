@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+func TestReady(t *testing.T) {
+	cfg := &config.Config{MaxAssetsReq: 10}
+	sh, err := store.NewStoreHandler(
+		store.WithDB(context.Background(), memory.NewDB()),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(cfg),
+	)
+	require.NoError(t, err)
+	s := NewServer(sh, zap.NewNop().Sugar(), cfg)
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		s.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, getReady, nil))
+		return w.Code
+	}
+	require.Equal(t, http.StatusServiceUnavailable, ready())
+	s.SetReady()
+	require.Equal(t, http.StatusOK, ready())
+
+	// A worker fails for good, only its first run fails.
+	var starts int32
+	failing := func(
+		ctx context.Context,
+		done chan struct{},
+		pulseInterval time.Duration,
+		logger *zap.SugaredLogger,
+		cfg *config.Config,
+		fn daemon.AggFunc,
+	) (chan interface{}, chan error) {
+		heartbeatCh := make(chan interface{})
+		errCh := make(chan error)
+		fail := atomic.AddInt32(&starts, 1) == 1
+		go func() {
+			defer close(errCh)
+			defer close(heartbeatCh)
+			if !fail {
+				<-done
+				return
+			}
+			select {
+			case errCh <- errors.New("db down"):
+			case <-done:
+			}
+		}()
+		return heartbeatCh, errCh
+	}
+	runAsDaemon := daemon.MakeDaemon(time.Minute, 0, failing, daemon.WithName("failing"), daemon.WithRegistry(sh.Workers))
+	done := make(chan struct{})
+	defer close(done)
+	runAsDaemon(context.Background(), done, time.Millisecond, zap.NewNop().Sugar(), cfg, func(context.Context) error { return nil })
+	require.Eventually(t, func() bool { return ready() == http.StatusServiceUnavailable }, 5*time.Second, 10*time.Millisecond)
+	w := httptest.NewRecorder()
+	s.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, getReady, nil))
+	require.Contains(t, w.Body.String(), "worker failing stopped: db down")
+
+	// Restarting it makes the server ready again.
+	require.NoError(t, sh.Workers.Control(context.Background(), "failing", daemon.ActionRestart))
+	require.Equal(t, http.StatusOK, ready())
+}
+
+func TestServeShutdown(t *testing.T) {
+	cfg := &config.Config{MaxAssetsReq: 10}
+	sh, err := store.NewStoreHandler(
+		store.WithDB(context.Background(), memory.NewDB()),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(cfg),
+	)
+	require.NoError(t, err)
+	s := NewServer(sh, zap.NewNop().Sugar(), cfg)
+	s.SetReady()
+
+	port, err := getFreePort()
+	require.NoError(t, err)
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(addr) }()
+	url := "http://" + addr + getReady
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.NoError(t, <-served)
+	_, err = http.Get(url)
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package rest
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
@@ -13,6 +14,13 @@ import (
 
 const getTokensPricesRoute = "/tokens"
 
+// tokenPriceAndMarket is a token of the /tokens response with its market
+// data, asked for with ?market=true. Market is omitted when unknown.
+type tokenPriceAndMarket struct {
+	types.TokenPriceAndSupply
+	Market *types.TokenMarket `json:",omitempty"`
+}
+
 func getTokenPriceAndSupplies(
 	ctx context.Context,
 	tokens []string,
@@ -42,6 +50,15 @@ func getTokenPriceAndSupplies(
 }
 
 func (r *router) tokensPriceAndSuppliesHandler(ctx *gin.Context) {
+	var reqQueries struct {
+		Market bool `form:"market"`
+	}
+	if err := ctx.ShouldBindQuery(&reqQueries); err != nil {
+		r.s.l.Errorw("Invalid request query:", "error", err)
+		e(ctx, http.StatusBadRequest, fmt.Errorf("invalid request query"))
+		return
+	}
+
 	var tokens types.Tokens
 	if err := ctx.BindJSON(&tokens); err != nil {
 		r.s.l.Errorw("TokenPriceAndSupplies", "error", err.Error())
@@ -66,9 +83,36 @@ func (r *router) tokensPriceAndSuppliesHandler(ctx *gin.Context) {
 		return
 	}
 
+	if !reqQueries.Market {
+		ctx.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"data":    &tokenPriceAndSupplies,
+			"message": nil,
+		})
+		return
+	}
+
+	markets, err := r.s.sh.Store.GetMarkets(ctx.Request.Context(), tokens.Tokens)
+	if err != nil {
+		r.s.l.Errorw("Store.GetMarkets()", "error", err)
+		e(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	marketBySymbol := make(map[string]types.TokenMarket, len(markets))
+	for _, m := range markets {
+		marketBySymbol[m.Symbol] = m
+	}
+	tokenPriceAndMarkets := make([]tokenPriceAndMarket, 0, len(tokenPriceAndSupplies))
+	for _, t := range tokenPriceAndSupplies {
+		token := tokenPriceAndMarket{TokenPriceAndSupply: t}
+		if m, ok := marketBySymbol[t.Symbol]; ok {
+			token.Market = &m
+		}
+		tokenPriceAndMarkets = append(tokenPriceAndMarkets, token)
+	}
 	ctx.JSON(http.StatusOK, gin.H{
 		"status":  http.StatusOK,
-		"data":    &tokenPriceAndSupplies,
+		"data":    &tokenPriceAndMarkets,
 		"message": nil,
 	})
 }
@@ -16,8 +16,8 @@ func TestSelectTokensPrices(t *testing.T) {
 	defer tDown()
 
 	want := []types.TokenPriceAndSupply{
-		{Price: 10, Symbol: "ATOMUSDT", Supply: 113563929433.0},
-		{Price: 10, Symbol: "LUNAUSDT", Supply: 113563929433.0},
+		{Price: 10, Symbol: "ATOMUSDT", Supply: floatPtr(113563929433.0), CirculatingSupply: floatPtr(113563929433.0)},
+		{Price: 10, Symbol: "LUNAUSDT", Supply: floatPtr(113563929433.0), CirculatingSupply: floatPtr(113563929433.0)},
 	}
 	err := insertWantData(router, types.AllPriceResponse{Tokens: want})
 	require.NoError(t, err)
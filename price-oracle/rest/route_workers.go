@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+)
+
+const (
+	getWorkers    = "/workers"
+	controlWorker = "/workers/:name/:action"
+)
+
+// workerControlTimeout bounds the wait for the daemon of a worker to apply
+// an action.
+const workerControlTimeout = 10 * time.Second
+
+// workersHandler returns the status of the aggregators and the
+// subscriptions.
+func (r *router) workersHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    r.s.sh.Workers.All(),
+		"message": nil,
+	})
+}
+
+// controlWorkerHandler pauses, resumes, triggers or restarts a worker, and
+// returns its status.
+func (r *router) controlWorkerHandler(ctx *gin.Context) {
+	name := ctx.Param("name")
+	action := daemon.Action(ctx.Param("action"))
+	controlCtx, cancel := context.WithTimeout(ctx.Request.Context(), workerControlTimeout)
+	defer cancel()
+	if err := r.s.sh.Workers.Control(controlCtx, name, action); err != nil {
+		switch {
+		case errors.Is(err, daemon.ErrUnknownWorker):
+			e(ctx, http.StatusNotFound, err)
+		case errors.Is(err, daemon.ErrUnknownAction):
+			e(ctx, http.StatusBadRequest, err)
+		case errors.Is(err, daemon.ErrWorkerStopped), errors.Is(err, daemon.ErrWorkerNotRunning):
+			e(ctx, http.StatusConflict, err)
+		default:
+			r.s.l.Errorw("Workers.Control()", "worker", name, "action", action, "error", err.Error())
+			e(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	r.s.l.Infow("Workers.Control()", "worker", name, "action", action)
+	status, _ := r.s.sh.Workers.Get(name)
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"data":    status,
+		"message": nil,
+	})
+}
+
+func (r *router) getWorkers() (string, gin.HandlerFunc, gin.HandlerFunc) {
+	return getWorkers, r.adminAuth, r.workersHandler
+}
+
+func (r *router) controlWorker() (string, gin.HandlerFunc, gin.HandlerFunc) {
+	return controlWorker, r.adminAuth, r.controlWorkerHandler
+}
@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+func TestWorkers(t *testing.T) {
+	cfg := &config.Config{MaxAssetsReq: 10, Interval: "10ms", WorkerPulse: 5 * time.Millisecond, RecoverCount: -1, AdminToken: "token"}
+	sh, err := store.NewStoreHandler(
+		store.WithDB(context.Background(), memory.NewDB()),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(cfg),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.StartAggregate(ctx, sh)
+	s := NewServer(sh, zap.NewNop().Sugar(), cfg)
+
+	w := httptest.NewRecorder()
+	s.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, getWorkers, nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	workers := func() []daemon.WorkerStatus {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, getWorkers, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		s.g.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data []daemon.WorkerStatus `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+	require.Eventually(t, func() bool {
+		ws := workers()
+		return len(ws) == 2 && ws[0].Runs > 0 && ws[1].Runs > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	ws := workers()
+	require.Equal(t, store.FiatAggregatorWorker, ws[0].Name)
+	require.Equal(t, store.TokenAggregatorWorker, ws[1].Name)
+	require.True(t, ws[0].Running)
+	require.False(t, ws[0].LastRunEnd.IsZero())
+}
+
+func TestControlWorker(t *testing.T) {
+	cfg := &config.Config{MaxAssetsReq: 10, Interval: "1h", WorkerPulse: time.Minute, RecoverCount: -1, AdminToken: "token"}
+	sh, err := store.NewStoreHandler(
+		store.WithDB(context.Background(), memory.NewDB()),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(cfg),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.StartAggregate(ctx, sh)
+	s := NewServer(sh, zap.NewNop().Sugar(), cfg)
+	require.Eventually(t, func() bool { return len(sh.Workers.All()) == 2 }, 5*time.Second, time.Millisecond)
+
+	control := func(path, token string) (int, daemon.WorkerStatus) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		s.g.ServeHTTP(w, req)
+		var resp struct {
+			Data daemon.WorkerStatus `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Data
+	}
+
+	code, _ := control("/workers/"+store.TokenAggregatorWorker+"/pause", "wrong")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, status := control("/workers/"+store.TokenAggregatorWorker+"/pause", "token")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, status.Paused)
+	code, _ = control("/workers/"+store.TokenAggregatorWorker+"/trigger", "token")
+	require.Equal(t, http.StatusConflict, code)
+	code, status = control("/workers/"+store.TokenAggregatorWorker+"/resume", "token")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, status.Running)
+
+	// An aggregator run, without waiting for the hourly tick.
+	code, _ = control("/workers/"+store.FiatAggregatorWorker+"/trigger", "token")
+	require.Equal(t, http.StatusOK, code)
+	require.Eventually(t, func() bool {
+		status, _ := sh.Workers.Get(store.FiatAggregatorWorker)
+		return status.Runs == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	code, _ = control("/workers/"+store.TokenAggregatorWorker+"/stop", "token")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = control("/workers/unknown/pause", "token")
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,120 @@
+package sql
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Dialect is the SQL flavour spoken by the database behind a SqlDB.
+//
+// Queries are written for CockroachDB and PostgreSQL, both of which understand
+// the same subset of SQL we use. Tables live in the oracle namespace, which is
+// a database in CockroachDB and a schema in PostgreSQL. SQLite has neither,
+// so tables are prefixed instead: oracle.binance becomes oracle_binance.
+type Dialect string
+
+const (
+	DialectCockroach Dialect = "cockroach"
+	DialectPostgres  Dialect = "postgres"
+	DialectSQLite    Dialect = "sqlite"
+)
+
+const (
+	DriverSQLite = "sqlite"
+)
+
+// namespaceRe matches the namespaces queries refer to, oracle for our own
+// tables and cns for the CNS ones.
+var namespaceRe = regexp.MustCompile(`\b(oracle|cns)\.`)
+
+// driver returns the name of the database/sql driver for d.
+func (d Dialect) driver() string {
+	if d == DialectSQLite {
+		return DriverSQLite
+	}
+	return DriverPGX
+}
+
+// createNamespace returns the statement creating the oracle namespace, empty
+// if d has no namespaces.
+func (d Dialect) createNamespace() string {
+	switch d {
+	case DialectPostgres:
+		return "CREATE SCHEMA IF NOT EXISTS oracle"
+	case DialectSQLite:
+		return ""
+	default:
+		return createDatabase
+	}
+}
+
+// rebind adapts a query written for CockroachDB to d.
+func (d Dialect) rebind(query string) string {
+	if d != DialectSQLite {
+		return query
+	}
+	return namespaceRe.ReplaceAllString(query, "${1}_")
+}
+
+// anyOf returns a condition true when column is one of the elements of the
+// array bound to param, see arrayArg.
+func (d Dialect) anyOf(column string, param string) string {
+	if d == DialectSQLite {
+		return column + " IN (SELECT value FROM json_each(" + param + "))"
+	}
+	return column + " = ANY(" + param + ")"
+}
+
+// arrayArg returns values as an argument anyOf can match against. SQLite has
+// no arrays, values are passed as a JSON array instead.
+func (d Dialect) arrayArg(values []string) (interface{}, error) {
+	if values == nil {
+		values = []string{}
+	}
+	if d != DialectSQLite {
+		return values, nil
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// cnsDenomsQuery returns the query selecting the given fields of every denom
+// of every CNS chain. Fields are returned as JSON values, strings are quoted
+// in CockroachDB and PostgreSQL, not in SQLite.
+func (d Dialect) cnsDenomsQuery(fields ...string) string {
+	selected := make([]string, 0, len(fields))
+	if d == DialectSQLite {
+		for _, f := range fields {
+			selected = append(selected, "json_extract(y.value, '$."+f+"')")
+		}
+		return d.rebind("SELECT " + strings.Join(selected, ",") + " FROM cns.chains jt, json_each(jt.denoms) y")
+	}
+	for _, f := range fields {
+		selected = append(selected, "y.x->'"+f+"'")
+	}
+	return "SELECT " + strings.Join(selected, ",") + " FROM cns.chains jt, LATERAL (SELECT jsonb_array_elements(jt.denoms) x) y"
+}
+
+// sqliteDSN adds the pragmas SqlDB needs to an SQLite data source name, unless
+// the caller set some. WAL lets readers proceed while the providers write, and
+// the busy timeout makes concurrent writers wait for each other instead of
+// failing.
+func sqliteDSN(dsn string) string {
+	if strings.Contains(dsn, "_pragma=") {
+		return dsn
+	}
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
@@ -2,79 +2,431 @@ package sql
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/v2/crdb"
 )
 
 const createDatabase = `
-CREATE DATABASE oracle;
+CREATE DATABASE IF NOT EXISTS oracle;
+`
+
+// Column types are spelled so that CockroachDB, PostgreSQL and SQLite all
+// understand them. In CockroachDB TEXT, DOUBLE PRECISION and BIGINT are the
+// same types as STRING, FLOAT and INT.
+
+const createTableSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS oracle.schema_migrations (version BIGINT PRIMARY KEY, name TEXT, appliedat BIGINT);
+`
+
+const createTableSchemaMigrationsLock = `
+CREATE TABLE IF NOT EXISTS oracle.schema_migrations_lock (id BIGINT PRIMARY KEY, owner TEXT, expiresat BIGINT);
 `
 
 const createTableBinance = `
-CREATE TABLE IF NOT EXISTS oracle.binance (symbol STRING PRIMARY KEY, price FLOAT, updatedat INT);
+CREATE TABLE IF NOT EXISTS oracle.binance (symbol TEXT PRIMARY KEY, price DOUBLE PRECISION, updatedat BIGINT);
 `
 const createTableCoinmarketcap = `
-CREATE TABLE IF NOT EXISTS oracle.coinmarketcap (symbol STRING PRIMARY KEY, price FLOAT, updatedat INT);
+CREATE TABLE IF NOT EXISTS oracle.coinmarketcap (symbol TEXT PRIMARY KEY, price DOUBLE PRECISION, updatedat BIGINT);
 `
 const createTableCoingecko = `
-CREATE TABLE IF NOT EXISTS oracle.coingecko (symbol STRING PRIMARY KEY, price FLOAT, updatedat INT);
+CREATE TABLE IF NOT EXISTS oracle.coingecko (symbol TEXT PRIMARY KEY, price DOUBLE PRECISION, updatedat BIGINT);
 `
 const createTableCoinmarketcapSupply = `
-CREATE TABLE IF NOT EXISTS oracle.coinmarketcapsupply (symbol STRING PRIMARY KEY, supply FLOAT);
+CREATE TABLE IF NOT EXISTS oracle.coinmarketcapsupply (symbol TEXT PRIMARY KEY, supply DOUBLE PRECISION);
 `
 const createTableCoingeckoSupply = `
-CREATE TABLE IF NOT EXISTS oracle.coingeckosupply (symbol STRING PRIMARY KEY, supply FLOAT);
+CREATE TABLE IF NOT EXISTS oracle.coingeckosupply (symbol TEXT PRIMARY KEY, supply DOUBLE PRECISION);
 `
 const createTableFixer = `
-CREATE TABLE IF NOT EXISTS oracle.fixer (symbol STRING PRIMARY KEY, price FLOAT, updatedat INT);
+CREATE TABLE IF NOT EXISTS oracle.fixer (symbol TEXT PRIMARY KEY, price DOUBLE PRECISION, updatedat BIGINT);
 `
 
-const createTableTokens = `CREATE TABLE IF NOT EXISTS oracle.tokens (symbol STRING PRIMARY KEY, price FLOAT);`
+const createTableTokens = `CREATE TABLE IF NOT EXISTS oracle.tokens (symbol TEXT PRIMARY KEY, price DOUBLE PRECISION);`
+
+const createTableFiats = `CREATE TABLE IF NOT EXISTS oracle.fiats (symbol TEXT PRIMARY KEY, price DOUBLE PRECISION);`
 
-const createTableFiats = `CREATE TABLE IF NOT EXISTS oracle.fiats (symbol STRING PRIMARY KEY, price FLOAT);`
+const createTablePriceHistory = `
+CREATE TABLE IF NOT EXISTS oracle.pricehistory (symbol TEXT, price DOUBLE PRECISION, marketcap DOUBLE PRECISION, volume DOUBLE PRECISION, updatedat BIGINT, PRIMARY KEY (symbol, updatedat));
+`
+
+const createTableBackfillProgress = `
+CREATE TABLE IF NOT EXISTS oracle.backfillprogress (symbol TEXT, fromts BIGINT, tots BIGINT, geckoid TEXT, doneuntil BIGINT, updatedat BIGINT, PRIMARY KEY (symbol, fromts, tots));
+`
 
-var migrationList = []string{
-	createTableBinance,
-	createTableCoinmarketcap,
-	createTableCoinmarketcapSupply,
-	createTableFixer,
-	createTableTokens,
-	createTableFiats,
-	createTableCoingecko,
-	createTableCoingeckoSupply,
+// oracle.priceaudit is append-only. A source has a single entry of a kind
+// per symbol and second, the primary key also serves the reads by symbol.
+const createTablePriceAudit = `
+CREATE TABLE IF NOT EXISTS oracle.priceaudit (symbol TEXT, createdat BIGINT, kind TEXT, source TEXT, price DOUBLE PRECISION, quotedat BIGINT, reason TEXT, PRIMARY KEY (symbol, createdat, kind, source));
+`
+
+const createIndexPriceAuditCreatedAt = `
+CREATE INDEX IF NOT EXISTS priceaudit_createdat ON oracle.priceaudit (createdat);
+`
+
+const createTableChainSupply = `
+CREATE TABLE IF NOT EXISTS oracle.chainsupply (symbol TEXT PRIMARY KEY, chainname TEXT, denom TEXT, supply DOUBLE PRECISION, updatedat BIGINT);
+`
+
+const createTableCoingeckoMarkets = `
+CREATE TABLE IF NOT EXISTS oracle.coingeckomarkets (symbol TEXT PRIMARY KEY, marketcap DOUBLE PRECISION, volume24h DOUBLE PRECISION, high24h DOUBLE PRECISION, low24h DOUBLE PRECISION, pricechange24h DOUBLE PRECISION, pricechangepercentage24h DOUBLE PRECISION, updatedat BIGINT);
+`
+
+// Migration is a numbered schema change. Up applies it, Down reverts it.
+//
+// Migrations are applied in ascending order of Version and recorded in
+// oracle.schema_migrations. Never edit or renumber a released migration,
+// add a new one instead.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
 }
 
-func (m *SqlDB) runMigrations(ctx context.Context) error {
-	if err := m.RunMigrations(ctx, migrationList); err != nil {
-		return err
+// migrationList is the list of all migrations in ascending order of version.
+//
+// The first migration uses CREATE TABLE IF NOT EXISTS so that databases
+// created before the migrations ledger existed are adopted as is.
+var migrationList = []Migration{
+	{
+		Version: 1,
+		Name:    "create provider and aggregate tables",
+		Up: []string{
+			createTableBinance,
+			createTableCoinmarketcap,
+			createTableCoinmarketcapSupply,
+			createTableFixer,
+			createTableTokens,
+			createTableFiats,
+			createTableCoingecko,
+			createTableCoingeckoSupply,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS oracle.binance",
+			"DROP TABLE IF EXISTS oracle.coinmarketcap",
+			"DROP TABLE IF EXISTS oracle.coinmarketcapsupply",
+			"DROP TABLE IF EXISTS oracle.fixer",
+			"DROP TABLE IF EXISTS oracle.tokens",
+			"DROP TABLE IF EXISTS oracle.fiats",
+			"DROP TABLE IF EXISTS oracle.coingecko",
+			"DROP TABLE IF EXISTS oracle.coingeckosupply",
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create price history",
+		Up:      []string{createTablePriceHistory},
+		Down:    []string{"DROP TABLE IF EXISTS oracle.pricehistory"},
+	},
+	{
+		Version: 3,
+		Name:    "create backfill progress",
+		Up:      []string{createTableBackfillProgress},
+		Down:    []string{"DROP TABLE IF EXISTS oracle.backfillprogress"},
+	},
+	{
+		Version: 4,
+		Name:    "create price audit",
+		Up:      []string{createTablePriceAudit, createIndexPriceAuditCreatedAt},
+		Down:    []string{"DROP TABLE IF EXISTS oracle.priceaudit"},
+	},
+	{
+		Version: 5,
+		Name:    "add total and max supply, create chain supply",
+		Up: []string{
+			"ALTER TABLE oracle.coingeckosupply ADD COLUMN totalsupply DOUBLE PRECISION",
+			"ALTER TABLE oracle.coingeckosupply ADD COLUMN maxsupply DOUBLE PRECISION",
+			"ALTER TABLE oracle.coinmarketcapsupply ADD COLUMN totalsupply DOUBLE PRECISION",
+			"ALTER TABLE oracle.coinmarketcapsupply ADD COLUMN maxsupply DOUBLE PRECISION",
+			createTableChainSupply,
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS oracle.chainsupply",
+			"ALTER TABLE oracle.coinmarketcapsupply DROP COLUMN maxsupply",
+			"ALTER TABLE oracle.coinmarketcapsupply DROP COLUMN totalsupply",
+			"ALTER TABLE oracle.coingeckosupply DROP COLUMN maxsupply",
+			"ALTER TABLE oracle.coingeckosupply DROP COLUMN totalsupply",
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create coingecko markets",
+		Up:      []string{createTableCoingeckoMarkets},
+		Down:    []string{"DROP TABLE IF EXISTS oracle.coingeckomarkets"},
+	},
+}
+
+// MigrationStatus is the state of a migration in a database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const (
+	// migrationLockLease is how long the migration lock is held without being
+	// refreshed. A replica dying while holding the lock blocks the others for
+	// at most that long.
+	migrationLockLease = 5 * time.Minute
+	// migrationLockRetry is the delay between two attempts to get the lock.
+	migrationLockRetry = time.Second
+)
+
+// ErrUnknownMigration is returned when the database has a migration applied
+// that this binary does not know about, most likely because a newer version
+// ran against it.
+var ErrUnknownMigration = errors.New("database has an unknown migration applied")
+
+// createDatabase creates the oracle namespace, a database in CockroachDB and
+// a schema in PostgreSQL.
+func (m *SqlDB) createDatabase(ctx context.Context) error {
+	q := m.dialect.createNamespace()
+	if q == "" {
+		return nil
+	}
+	if _, err := m.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("error while creating database : %w", err)
 	}
 	return nil
 }
 
-func (m *SqlDB) createDatabase(ctx context.Context) error {
-	m, err := NewDB(m.connString)
+// createMigrationTables creates the migrations ledger and its lock table.
+func (m *SqlDB) createMigrationTables(ctx context.Context) error {
+	for _, q := range []string{createTableSchemaMigrations, createTableSchemaMigrationsLock} {
+		if _, err := m.db.ExecContext(ctx, m.rebind(q)); err != nil {
+			return fmt.Errorf("error while creating migration tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies at most (param:<steps>) pending migrations, all of them
+// when steps <= 0. It returns the versions applied.
+//
+// Every migration is applied and recorded in the ledger in a single
+// transaction, so a failing migration leaves neither a half-applied schema
+// nor a ledger out of sync with it. PostgreSQL and SQLite have transactional
+// DDL. CockroachDB runs the schema changes of a transaction when it commits,
+// and rolls back the ones already done if one of them fails.
+func (m *SqlDB) MigrateUp(ctx context.Context, steps int) ([]int, error) {
+	var applied []int
+	err := m.withMigrationLock(ctx, func(refresh func() error) error {
+		done, err := m.appliedMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrationList {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+			if err := refresh(); err != nil {
+				return err
+			}
+			err := crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+				for i, q := range mig.Up {
+					if _, err := tx.ExecContext(ctx, m.rebind(q)); err != nil {
+						return fmt.Errorf("error while running migration %d (%s) statement #%d: %w", mig.Version, mig.Name, i, err)
+					}
+				}
+				if _, err := tx.ExecContext(ctx,
+					m.rebind("INSERT INTO oracle.schema_migrations (version, name, appliedat) VALUES (($1),($2),($3))"),
+					mig.Version, mig.Name, time.Now().Unix()); err != nil {
+					return fmt.Errorf("error while recording migration %d: %w", mig.Version, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			applied = append(applied, mig.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the last (param:<steps>) applied migrations, in
+// descending order of version. It returns the versions reverted.
+func (m *SqlDB) MigrateDown(ctx context.Context, steps int) ([]int, error) {
+	var reverted []int
+	err := m.withMigrationLock(ctx, func(refresh func() error) error {
+		done, err := m.appliedMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(migrationList) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := migrationList[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if err := refresh(); err != nil {
+				return err
+			}
+			err := crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+				for i, q := range mig.Down {
+					if _, err := tx.ExecContext(ctx, m.rebind(q)); err != nil {
+						return fmt.Errorf("error while reverting migration %d (%s) statement #%d: %w", mig.Version, mig.Name, i, err)
+					}
+				}
+				if _, err := tx.ExecContext(ctx, m.rebind("DELETE FROM oracle.schema_migrations WHERE version = ($1)"), mig.Version); err != nil {
+					return fmt.Errorf("error while recording migration %d revert: %w", mig.Version, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, mig.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationsStatus returns the status of every known migration, in ascending
+// order of version.
+func (m *SqlDB) MigrationsStatus(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.createDatabase(ctx); err != nil {
+		return nil, err
+	}
+	if err := m.createMigrationTables(ctx); err != nil {
+		return nil, err
+	}
+	done, err := m.appliedMigrations(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if _, err := m.db.ExecContext(ctx, createDatabase); err != nil {
-		return fmt.Errorf("error while creating database : %w", err)
+	ret := make([]MigrationStatus, 0, len(migrationList))
+	for _, mig := range migrationList {
+		status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if appliedAt, ok := done[mig.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = time.Unix(appliedAt, 0)
+		}
+		ret = append(ret, status)
+	}
+	return ret, nil
+}
+
+// appliedMigrations returns version -> applied at (unix seconds) of the
+// migrations recorded in the ledger.
+func (m *SqlDB) appliedMigrations(ctx context.Context) (map[int]int64, error) {
+	rows, err := m.db.QueryxContext(ctx, m.rebind("SELECT version, appliedat FROM oracle.schema_migrations"))
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]struct{}, len(migrationList))
+	for _, mig := range migrationList {
+		known[mig.Version] = struct{}{}
 	}
 
-	return m.db.Close()
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if _, ok := known[version]; !ok {
+			_ = rows.Close()
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return applied, nil
 }
 
-func (m *SqlDB) RunMigrations(ctx context.Context, migrations []string) error {
-	m, err := NewDB(m.connString)
+// withMigrationLock runs fn while holding the migration lock, so that
+// replicas starting together apply migrations one at a time. The lock is a
+// lease stored in oracle.schema_migrations_lock, fn must call refresh before
+// every long step to extend it.
+func (m *SqlDB) withMigrationLock(ctx context.Context, fn func(refresh func() error) error) error {
+	if err := m.createDatabase(ctx); err != nil {
+		return err
+	}
+	if err := m.createMigrationTables(ctx); err != nil {
+		return err
+	}
+
+	owner, err := migrationLockOwner()
 	if err != nil {
 		return err
 	}
 
-	for i, migration := range migrations {
+	acquire := func() (bool, error) {
+		now := time.Now()
+		res, err := m.db.ExecContext(ctx, m.rebind(
+			"INSERT INTO oracle.schema_migrations_lock (id, owner, expiresat) VALUES (1, ($1), ($2)) "+
+				"ON CONFLICT (id) DO UPDATE SET owner = excluded.owner, expiresat = excluded.expiresat "+
+				"WHERE oracle.schema_migrations_lock.owner = ($1) OR oracle.schema_migrations_lock.expiresat < ($3)"),
+			owner, now.Add(migrationLockLease).Unix(), now.Unix())
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		return n == 1, nil
+	}
+
+	for {
+		ok, err := acquire()
+		if err != nil {
+			return fmt.Errorf("error while acquiring migration lock: %w", err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(migrationLockRetry):
+		}
+	}
+	defer func() {
+		// Use a fresh context, the lock must be released even on cancellation.
+		_, _ = m.db.ExecContext(context.Background(), m.rebind("DELETE FROM oracle.schema_migrations_lock WHERE id = 1 AND owner = ($1)"), owner)
+	}()
 
-		if _, err := m.db.ExecContext(ctx, migration); err != nil {
-			return fmt.Errorf("error while running migration #%d, %w", i, err)
+	refresh := func() error {
+		ok, err := acquire()
+		if err != nil {
+			return fmt.Errorf("error while refreshing migration lock: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("migration lock lost")
 		}
+		return nil
 	}
+	return fn(refresh)
+}
 
-	return m.db.Close()
+// migrationLockOwner returns a unique name for this process.
+func migrationLockOwner() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(b)), nil
 }
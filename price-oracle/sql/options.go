@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// defaultMaxConns is the size of each connection pool unless WithMaxConns or
+// WithReadPool say otherwise.
+const defaultMaxConns = 25
+
+// Option configures a SqlDB.
+type Option func(*options) error
+
+type options struct {
+	maxConns       int
+	readConnString string
+	readMaxConns   int
+	followerReads  bool
+	staleness      time.Duration
+}
+
+// WithMaxConns sets the size of the pool used by writes and by the reads of the
+// aggregators and providers.
+func WithMaxConns(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("max conns must be positive, got %d", n)
+		}
+		o.maxConns = n
+		return nil
+	}
+}
+
+// WithReadPool points the pool used by the REST read paths at connString, and
+// sets its size. An empty connString keeps the DSN of the write pool, a zero
+// maxConns the default size.
+//
+// The read pool is always separate from the write pool, so that spikes of
+// REST traffic do not starve the providers of connections.
+func WithReadPool(connString string, maxConns int) Option {
+	return func(o *options) error {
+		if maxConns < 0 {
+			return fmt.Errorf("read max conns must not be negative, got %d", maxConns)
+		}
+		o.readConnString = connString
+		if maxConns > 0 {
+			o.readMaxConns = maxConns
+		}
+		return nil
+	}
+}
+
+// WithFollowerReads makes the REST read paths use CockroachDB follower reads,
+// which any replica can serve without going through the leaseholder. Reads
+// return data as of staleness ago, or as of follower_read_timestamp() if
+// staleness is zero. A staleness shorter than follower_read_timestamp() (about
+// 4.8s with default cluster settings) is served by the leaseholder.
+func WithFollowerReads(staleness time.Duration) Option {
+	return func(o *options) error {
+		if staleness < 0 {
+			return fmt.Errorf("follower read staleness must not be negative, got %s", staleness)
+		}
+		o.followerReads = true
+		o.staleness = staleness
+		return nil
+	}
+}
+
+// asOfSystemTime returns the AS OF SYSTEM TIME clause REST reads are made
+// with, empty when follower reads are disabled.
+func (o options) asOfSystemTime() string {
+	if !o.followerReads {
+		return ""
+	}
+	if o.staleness == 0 {
+		return " AS OF SYSTEM TIME follower_read_timestamp()"
+	}
+	// CockroachDB takes a negative interval relative to the statement time.
+	return " AS OF SYSTEM TIME '-" + strconv.FormatFloat(o.staleness.Seconds(), 'f', -1, 64) + "s'"
+}
@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+// Postgres tests run against the database pointed by
+// PRICE_ORACLE_TEST_POSTGRES_URL and are skipped when it is not set. They
+// drop the oracle and cns schemas of that database.
+const postgresURLEnv = "PRICE_ORACLE_TEST_POSTGRES_URL"
+
+func TestPostgresStore(t *testing.T) {
+	mDB := setupPostgres(t)
+
+	err := mDB.Init(context.Background())
+	require.NoError(t, err)
+
+	store.TestStore(t, mDB)
+}
+
+func TestPostgresCNS(t *testing.T) {
+	mDB := setupPostgres(t)
+	require.NoError(t, mDB.Init(context.Background()))
+
+	_, err := mDB.db.Exec("CREATE SCHEMA cns")
+	require.NoError(t, err)
+	_, err = mDB.db.Exec("CREATE TABLE cns.chains (chain_name TEXT PRIMARY KEY, public_node_endpoints JSONB, denoms JSONB)")
+	require.NoError(t, err)
+	_, err = mDB.db.Exec(`INSERT INTO cns.chains VALUES
+		('cosmos-hub', '{"cosmos_api": ["http://lcd.cosmos.hub"]}', '[{"name": "uatom", "ticker": "ATOM", "price_id": "cosmos", "precision": 6, "fetch_price": true}]'),
+		('osmosis', '{}', '[{"name": "uosmo", "ticker": "OSMO", "price_id": "osmosis", "fetch_price": true}, {"name": "uion", "ticker": "ION", "fetch_price": false}]')`)
+	require.NoError(t, err)
+
+	names, err := mDB.GetTokenNames(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"ATOM", "OSMO"}, names)
+
+	priceIDs, err := mDB.GetPriceIDToTicker(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"cosmos": "atom", "osmosis": "osmo"}, priceIDs)
+
+	// osmosis has no Cosmos SDK REST API endpoint.
+	denoms, err := mDB.GetCNSChainDenoms(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []types.ChainDenom{
+		{ChainName: "cosmos-hub", Endpoint: "http://lcd.cosmos.hub", Name: "uatom", Ticker: "ATOM", Precision: 6, FetchPrice: true},
+	}, denoms)
+}
+
+func setupPostgres(t *testing.T) *SqlDB {
+	t.Helper()
+
+	connStr := os.Getenv(postgresURLEnv)
+	if connStr == "" {
+		t.Skipf("%s not set", postgresURLEnv)
+	}
+
+	mDB, err := NewWithDialect(connStr, DialectPostgres)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, mDB.Close())
+	})
+
+	for _, schema := range []string{"oracle", "cns"} {
+		_, err = mDB.db.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+		require.NoError(t, err)
+	}
+	return mDB
+}
@@ -3,11 +3,13 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cockroachdb/cockroach-go/v2/crdb"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
 	"github.com/getsentry/sentry-go"
 
@@ -23,81 +25,54 @@ const (
 type SqlDB struct {
 	db         *sqlx.DB
 	connString string
+	dialect    Dialect
+
+	// readDB is the pool used by the REST read paths, with queries made
+	// AS OF SYSTEM TIME asOf when follower reads are enabled.
+	readDB *sqlx.DB
+	asOf   string
 }
 
 func (m *SqlDB) GetConnectionString() string {
 	return m.connString
 }
 
+// Init creates the oracle database if needed and applies all pending
+// migrations. Replicas calling Init concurrently wait for each other.
 func (m *SqlDB) Init(ctx context.Context) error {
-	q, err := m.db.QueryxContext(ctx, "SHOW TABLES FROM oracle")
-	if err != nil {
-		if strings.Contains(err.Error(), "target database or schema does not exist") {
-			if err = m.createDatabase(ctx); err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
-	}
-
-	if q != nil {
-		if err = q.Close(); err != nil {
-			return err
-		}
-	}
-
-	if err = m.runMigrations(ctx); err != nil {
-		return err
-	}
-
-	return nil
+	_, err := m.MigrateUp(ctx, 0)
+	return err
 }
 
+// GetTokenPriceAndSupplies returns the price, Coingecko and on-chain supplies
+// of the given tokens, in alphabetic order. Supply is the Coingecko circulating
+// supply. Tokens without a price are not returned, unknown supplies are nil.
 func (m *SqlDB) GetTokenPriceAndSupplies(ctx context.Context, tokens []string) ([]types.TokenPriceAndSupply, error) {
 	defer sentry.StartSpan(ctx, "db.GetTokenPriceAndSupplies").Finish()
 
-	query := "SELECT * FROM " + store.TokensStore + " WHERE symbol=$1"
-	for i := 2; i <= len(tokens); i++ {
-		query += " OR" + " symbol=$" + strconv.Itoa(i)
-	}
-
-	symbolList := make([]interface{}, 0, len(tokens))
-	for _, symbol := range tokens {
-		symbolList = append(symbolList, symbol)
+	symbols, err := m.dialect.arrayArg(tokens)
+	if err != nil {
+		return nil, err
 	}
+	query := "SELECT t.symbol, t.price, s.supply, s.supply AS circulatingsupply, s.totalsupply, s.maxsupply," +
+		" c.supply AS onchainsupply FROM " + store.TokensStore + " t" +
+		" LEFT JOIN " + store.CoingeckoSupplyStore + " s ON s.symbol = t.symbol" +
+		" LEFT JOIN " + store.ChainSupplyStore + " c ON c.symbol = t.symbol" + m.asOf +
+		" WHERE " + m.dialect.anyOf("t.symbol", "$1") +
+		" ORDER BY t.symbol"
 
 	var priceAndSupplies []types.TokenPriceAndSupply //nolint:prealloc
-	var symbol string
-	var price float64
-	var supply float64
-
-	rows, err := m.db.QueryxContext(ctx, query, symbolList...)
+	rows, err := m.readDB.QueryxContext(ctx, m.rebind(query), symbols)
 	if err != nil {
 		return nil, err
 	}
 	for rows.Next() {
-		if err := rows.Scan(&symbol, &price); err != nil {
+		var token types.TokenPriceAndSupply
+		if err := rows.StructScan(&token); err != nil {
+			_ = rows.Close()
 			return nil, err
 		}
-		rowGeckoSupply, err := m.db.QueryxContext(ctx, "SELECT * FROM "+store.CoingeckoSupplyStore+" WHERE symbol=$1", symbol)
-		if err != nil {
-			return nil, err
-		}
-		for rowGeckoSupply.Next() {
-			if err := rowGeckoSupply.Scan(&symbol, &supply); err != nil {
-				return nil, err
-			}
-		}
-		if err = rowGeckoSupply.Close(); err != nil {
-			return nil, err
-		}
-
-		priceAndSupplies = append(priceAndSupplies, types.TokenPriceAndSupply{
-			Symbol: symbol,
-			Price:  price,
-			Supply: supply,
-		})
+		priceAndSupplies = append(priceAndSupplies, token)
 	}
 	if err = rows.Close(); err != nil {
 		return nil, err
@@ -109,7 +84,7 @@ func (m *SqlDB) GetTokenPriceAndSupplies(ctx context.Context, tokens []string) (
 func (m *SqlDB) GetFiatPrices(ctx context.Context, fiats []string) ([]types.FiatPrice, error) {
 	defer sentry.StartSpan(ctx, "db.GetFiatPrices").Finish()
 
-	query := "SELECT * FROM " + store.FiatsStore + " WHERE symbol=$1"
+	query := "SELECT * FROM " + store.FiatsStore + m.asOf + " WHERE symbol=$1"
 	for i := 2; i <= len(fiats); i++ {
 		query += " OR" + " symbol=$" + strconv.Itoa(i)
 	}
@@ -121,7 +96,7 @@ func (m *SqlDB) GetFiatPrices(ctx context.Context, fiats []string) ([]types.Fiat
 
 	var fiatPrices []types.FiatPrice //nolint:prealloc
 	var price types.FiatPrice
-	rows, err := m.db.QueryxContext(ctx, query, symbolList...)
+	rows, err := m.readDB.QueryxContext(ctx, m.rebind(query), symbolList...)
 	if err != nil {
 		return nil, err
 	}
@@ -142,7 +117,7 @@ func (m *SqlDB) GetTokenNames(ctx context.Context) ([]string, error) {
 	defer sentry.StartSpan(ctx, "db.GetTokenNames").Finish()
 
 	var whitelists []string
-	q, err := m.db.QueryxContext(ctx, "SELECT  y.x->'ticker',y.x->'fetch_price' FROM cns.chains jt, LATERAL (SELECT json_array_elements(jt.denoms) x) y")
+	q, err := m.db.QueryxContext(ctx, m.dialect.cnsDenomsQuery("ticker", "fetch_price"))
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +144,7 @@ func (m *SqlDB) GetPriceIDToTicker(ctx context.Context) (map[string]string, erro
 
 	priceIDtoTicker := make(map[string]string)
 	seen := make(map[string]bool)
-	q, err := m.db.QueryxContext(ctx, "SELECT  y.x->'ticker',y.x->'price_id' FROM cns.chains jt, LATERAL (SELECT json_array_elements(jt.denoms) x) y")
+	q, err := m.db.QueryxContext(ctx, m.dialect.cnsDenomsQuery("ticker", "price_id"))
 	if err != nil {
 		return nil, err
 	}
@@ -203,12 +178,69 @@ func (m *SqlDB) GetPriceIDToTicker(ctx context.Context) (map[string]string, erro
 	return priceIDtoTicker, nil
 }
 
+// GetCNSChainDenoms returns the denoms of the CNS chains that have a Cosmos
+// SDK REST API endpoint in their public node endpoints. The first endpoint of
+// a chain is used.
+func (m *SqlDB) GetCNSChainDenoms(ctx context.Context) ([]types.ChainDenom, error) {
+	defer sentry.StartSpan(ctx, "db.GetCNSChainDenoms").Finish()
+
+	rows, err := m.db.QueryxContext(ctx, m.rebind("SELECT chain_name, public_node_endpoints, denoms FROM cns.chains"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var chainDenoms []types.ChainDenom
+	for rows.Next() {
+		var chainName string
+		var endpoints, denoms sql.NullString
+		if err := rows.Scan(&chainName, &endpoints, &denoms); err != nil {
+			return nil, err
+		}
+		if !endpoints.Valid || !denoms.Valid {
+			continue
+		}
+		var publicEndpoints struct {
+			CosmosAPI []string `json:"cosmos_api"`
+		}
+		if err := json.Unmarshal([]byte(endpoints.String), &publicEndpoints); err != nil {
+			return nil, fmt.Errorf("chain %s: public_node_endpoints: %w", chainName, err)
+		}
+		if len(publicEndpoints.CosmosAPI) == 0 {
+			continue
+		}
+		var chainDenomList []struct {
+			Name       string `json:"name"`
+			Ticker     string `json:"ticker"`
+			Precision  int64  `json:"precision"`
+			FetchPrice bool   `json:"fetch_price"`
+		}
+		if err := json.Unmarshal([]byte(denoms.String), &chainDenomList); err != nil {
+			return nil, fmt.Errorf("chain %s: denoms: %w", chainName, err)
+		}
+		for _, d := range chainDenomList {
+			chainDenoms = append(chainDenoms, types.ChainDenom{
+				ChainName:  chainName,
+				Endpoint:   publicEndpoints.CosmosAPI[0],
+				Name:       d.Name,
+				Ticker:     d.Ticker,
+				Precision:  d.Precision,
+				FetchPrice: d.FetchPrice,
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return chainDenoms, rows.Close()
+}
+
 func (m *SqlDB) GetPrices(ctx context.Context, from string) ([]types.Prices, error) {
 	defer sentry.StartSpan(ctx, "db.GetPrices").Finish()
 
 	var prices []types.Prices //nolint:prealloc
 	var price types.Prices
-	rows, err := m.db.QueryxContext(ctx, "SELECT * FROM "+from)
+	rows, err := m.db.QueryxContext(ctx, m.rebind("SELECT * FROM "+from))
 	if err != nil {
 		return nil, fmt.Errorf("fatal: GetPrices: %w", err)
 	}
@@ -234,7 +266,7 @@ func (m *SqlDB) UpsertPrice(ctx context.Context, to string, price float64, token
 	}
 	defer tx.Rollback() //nolint:errcheck
 
-	result, err := tx.ExecContext(ctx, "UPDATE "+to+" SET price = ($1) WHERE symbol = ($2)", price, token)
+	result, err := tx.ExecContext(ctx, m.rebind("UPDATE "+to+" SET price = ($1) WHERE symbol = ($2)"), price, token)
 	if err != nil {
 		return err
 	}
@@ -245,7 +277,7 @@ func (m *SqlDB) UpsertPrice(ctx context.Context, to string, price float64, token
 	// If you perform an update without a token column, it does not respond as an error; it responds with zero.
 	// So you have to insert a new one in the column.
 	if rowsAffected == 0 {
-		_, err := tx.ExecContext(ctx, "INSERT INTO "+to+" VALUES (($1),($2));", token, price)
+		_, err := tx.ExecContext(ctx, m.rebind("INSERT INTO "+to+" VALUES (($1),($2));"), token, price)
 		if err != nil {
 			return err
 		}
@@ -262,7 +294,7 @@ func (m *SqlDB) UpsertToken(ctx context.Context, to string, symbol string, price
 	}
 	defer tx.Rollback() //nolint:errcheck
 
-	result, err := tx.ExecContext(ctx, "UPDATE "+to+" SET price = ($1),updatedat = ($2) WHERE symbol = ($3)", price, time, symbol)
+	result, err := tx.ExecContext(ctx, m.rebind("UPDATE "+to+" SET price = ($1),updatedat = ($2) WHERE symbol = ($3)"), price, time, symbol)
 	if err != nil {
 		return err
 	}
@@ -272,7 +304,7 @@ func (m *SqlDB) UpsertToken(ctx context.Context, to string, symbol string, price
 		return err
 	}
 	if rowsAffected == 0 {
-		_, err := tx.ExecContext(ctx, "INSERT INTO "+to+" VALUES (($1),($2),($3));", symbol, price, time)
+		_, err := tx.ExecContext(ctx, m.rebind("INSERT INTO "+to+" VALUES (($1),($2),($3));"), symbol, price, time)
 		if err != nil {
 			return err
 		}
@@ -289,7 +321,7 @@ func (m *SqlDB) UpsertTokenSupply(ctx context.Context, to string, symbol string,
 	}
 	defer tx.Rollback() //nolint:errcheck
 
-	result, err := tx.ExecContext(ctx, "UPDATE "+to+" SET supply = ($1) WHERE symbol = ($2)", supply, symbol)
+	result, err := tx.ExecContext(ctx, m.rebind("UPDATE "+to+" SET supply = ($1) WHERE symbol = ($2)"), supply, symbol)
 	if err != nil {
 		return err
 	}
@@ -299,7 +331,7 @@ func (m *SqlDB) UpsertTokenSupply(ctx context.Context, to string, symbol string,
 		return err
 	}
 	if rowsAffected == 0 {
-		_, err := tx.ExecContext(ctx, "INSERT INTO "+to+" VALUES (($1),($2));", symbol, supply)
+		_, err := tx.ExecContext(ctx, m.rebind("INSERT INTO "+to+" (symbol, supply) VALUES (($1),($2));"), symbol, supply)
 		if err != nil {
 			return err
 		}
@@ -307,39 +339,465 @@ func (m *SqlDB) UpsertTokenSupply(ctx context.Context, to string, symbol string,
 	return tx.Commit()
 }
 
+// UpsertTokens writes the prices of a provider pass in to, in a single
+// transaction. Readers see either none or all of them.
+func (m *SqlDB) UpsertTokens(ctx context.Context, to string, tokens []types.Prices) error {
+	defer sentry.StartSpan(ctx, "db.UpsertTokens").Finish()
+
+	return m.UpsertTokensAndSupplies(ctx, to, tokens, "", nil)
+}
+
+// UpsertTokensAndSupplies writes the prices of a provider pass in to and its
+// supplies in supplyTo, in a single transaction. supplyTo may be empty when
+// there are no supplies.
+//
+// The transaction is retried on serialization failures, which CockroachDB
+// reports under contention instead of blocking.
+func (m *SqlDB) UpsertTokensAndSupplies(ctx context.Context, to string, tokens []types.Prices, supplyTo string, supplies []types.TokenSupply) error {
+	defer sentry.StartSpan(ctx, "db.UpsertTokensAndSupplies").Finish()
+
+	if len(tokens) == 0 && len(supplies) == 0 {
+		return nil
+	}
+
+	tokenRows := make([][]interface{}, 0, len(tokens))
+	for _, t := range tokens {
+		tokenRows = append(tokenRows, []interface{}{t.Symbol, t.Price, t.UpdatedAt})
+	}
+	supplyRows := make([][]interface{}, 0, len(supplies))
+	for _, s := range supplies {
+		supplyRows = append(supplyRows, []interface{}{s.Symbol, s.Supply, s.TotalSupply, s.MaxSupply})
+	}
+
+	return crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+		if err := m.upsertRows(ctx, tx, to, []string{"symbol", "price", "updatedat"}, 1, conflictUpdate, tokenRows); err != nil {
+			return err
+		}
+		return m.upsertRows(ctx, tx, supplyTo, []string{"symbol", "supply", "totalsupply", "maxsupply"}, 1, conflictUpdate, supplyRows)
+	})
+}
+
+// UpsertChainSupplies writes a batch of on-chain supplies in a single
+// transaction.
+func (m *SqlDB) UpsertChainSupplies(ctx context.Context, supplies []types.ChainSupply) error {
+	defer sentry.StartSpan(ctx, "db.UpsertChainSupplies").Finish()
+
+	if len(supplies) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, 0, len(supplies))
+	for _, s := range supplies {
+		rows = append(rows, []interface{}{s.Symbol, s.ChainName, s.Denom, s.Supply, s.UpdatedAt})
+	}
+	return crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+		return m.upsertRows(ctx, tx, store.ChainSupplyStore, []string{"symbol", "chainname", "denom", "supply", "updatedat"}, 1, conflictUpdate, rows)
+	})
+}
+
+// UpsertMarkets writes a batch of market data in a single transaction.
+func (m *SqlDB) UpsertMarkets(ctx context.Context, markets []types.TokenMarket) error {
+	defer sentry.StartSpan(ctx, "db.UpsertMarkets").Finish()
+
+	if len(markets) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, 0, len(markets))
+	for _, mk := range markets {
+		rows = append(rows, []interface{}{
+			mk.Symbol, mk.MarketCap, mk.Volume24h, mk.High24h, mk.Low24h, mk.PriceChange24h, mk.PriceChangePercentage24h, mk.UpdatedAt,
+		})
+	}
+	columns := []string{"symbol", "marketcap", "volume24h", "high24h", "low24h", "pricechange24h", "pricechangepercentage24h", "updatedat"}
+	return crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+		return m.upsertRows(ctx, tx, store.CoingeckoMarketStore, columns, 1, conflictUpdate, rows)
+	})
+}
+
+// GetMarkets returns the market data of the given tokens in alphabetic order.
+func (m *SqlDB) GetMarkets(ctx context.Context, tokens []string) ([]types.TokenMarket, error) {
+	defer sentry.StartSpan(ctx, "db.GetMarkets").Finish()
+
+	symbols, err := m.dialect.arrayArg(tokens)
+	if err != nil {
+		return nil, err
+	}
+	markets := []types.TokenMarket{}
+	err = m.readDB.SelectContext(ctx, &markets, m.rebind(
+		"SELECT symbol, marketcap, volume24h, high24h, low24h, pricechange24h, pricechangepercentage24h, updatedat FROM "+
+			store.CoingeckoMarketStore+m.asOf+" WHERE "+m.dialect.anyOf("symbol", "$1")+" ORDER BY symbol"), symbols)
+	if err != nil {
+		return nil, err
+	}
+	return markets, nil
+}
+
+// conflictAction is what upsertRows does with a row whose key is already in
+// the table.
+type conflictAction int
+
+const (
+	// conflictUpdate replaces the other columns of the existing row.
+	conflictUpdate conflictAction = iota
+	// conflictIgnore keeps the existing row.
+	conflictIgnore
+)
+
+// upsertRows writes rows in table with a multi-row INSERT ... ON CONFLICT.
+// The first keys columns are the conflict target, rows with the same key are
+// replaced or kept as they are according to action. When several rows have
+// the same key, the last one wins on update and the first one on ignore.
+func (m *SqlDB) upsertRows(ctx context.Context, tx *sql.Tx, table string, columns []string, keys int, action conflictAction, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// A single INSERT ... ON CONFLICT statement can not touch the same row twice.
+	index := make(map[string]int, len(rows))
+	deduped := make([][]interface{}, 0, len(rows))
+	for _, r := range rows {
+		key := fmt.Sprintf("%#v", r[:keys])
+		if i, ok := index[key]; ok {
+			if action == conflictUpdate {
+				deduped[i] = r
+			}
+			continue
+		}
+		index[key] = len(deduped)
+		deduped = append(deduped, r)
+	}
+	rows = deduped
+
+	conflict := " ON CONFLICT (" + strings.Join(columns[:keys], ", ") + ") DO NOTHING"
+	if action == conflictUpdate {
+		updates := make([]string, 0, len(columns)-keys)
+		for _, c := range columns[keys:] {
+			updates = append(updates, c+" = excluded."+c)
+		}
+		conflict = " ON CONFLICT (" + strings.Join(columns[:keys], ", ") + ") DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+
+	// Keep the number of placeholders of a single statement well below the
+	// postgres wire protocol limit.
+	const batchSize = 500
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, len(columns)*(end-start))
+		for _, r := range rows[start:end] {
+			placeholders := make([]string, 0, len(r))
+			for _, v := range r {
+				args = append(args, v)
+				placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+			}
+			values = append(values, "("+strings.Join(placeholders, ",")+")")
+		}
+		query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES " +
+			strings.Join(values, ",") + conflict
+		if _, err := tx.ExecContext(ctx, m.rebind(query), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPriceHistory returns the price history of symbol between from and to
+// (unix seconds, both inclusive) in ascending order of time.
+func (m *SqlDB) GetPriceHistory(ctx context.Context, symbol string, from int64, to int64) ([]types.HistoricalPrice, error) {
+	defer sentry.StartSpan(ctx, "db.GetPriceHistory").Finish()
+
+	var history []types.HistoricalPrice //nolint:prealloc
+	var sample types.HistoricalPrice
+	rows, err := m.readDB.QueryxContext(ctx, m.rebind(
+		"SELECT symbol, price, marketcap, volume, updatedat FROM "+store.PriceHistoryStore+m.asOf+
+			" WHERE symbol = ($1) AND updatedat >= ($2) AND updatedat <= ($3) ORDER BY updatedat"), symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		if err := rows.StructScan(&sample); err != nil {
+			return nil, err
+		}
+		history = append(history, sample)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// GetPriceHistoryAt returns, for every symbol, the history sample closest to
+// (param:<at>), looking at most (param:<tolerance>) seconds away from it.
+// Symbols without any sample in that window are not returned.
+func (m *SqlDB) GetPriceHistoryAt(ctx context.Context, symbols []string, at int64, tolerance int64) ([]types.HistoricalPrice, error) {
+	defer sentry.StartSpan(ctx, "db.GetPriceHistoryAt").Finish()
+
+	if len(symbols) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{at - tolerance, at + tolerance, at}
+	placeholders := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		args = append(args, symbol)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+	}
+	// On a tie, the older sample wins. SQLite has no DISTINCT ON, a window
+	// function works everywhere.
+	query := "SELECT symbol, price, marketcap, volume, updatedat FROM (" +
+		"SELECT symbol, price, marketcap, volume, updatedat," +
+		" ROW_NUMBER() OVER (PARTITION BY symbol ORDER BY abs(updatedat - ($3)), updatedat) AS rn" +
+		" FROM " + store.PriceHistoryStore +
+		" WHERE updatedat >= ($1) AND updatedat <= ($2) AND symbol IN (" + strings.Join(placeholders, ",") + ")" +
+		") AS closest" + m.asOf + " WHERE rn = 1"
+
+	var history []types.HistoricalPrice //nolint:prealloc
+	var sample types.HistoricalPrice
+	rows, err := m.readDB.QueryxContext(ctx, m.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		if err := rows.StructScan(&sample); err != nil {
+			return nil, err
+		}
+		history = append(history, sample)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// StreamPriceHistory calls fn with the price history of symbols between from
+// and to (unix seconds, both inclusive), ordered by symbol then time. Rows are
+// read one at a time, so the range can be larger than memory. It stops at the
+// first error returned by fn.
+func (m *SqlDB) StreamPriceHistory(ctx context.Context, symbols []string, from int64, to int64, fn func(types.HistoricalPrice) error) error {
+	defer sentry.StartSpan(ctx, "db.StreamPriceHistory").Finish()
+
+	symbolsArg, err := m.dialect.arrayArg(symbols)
+	if err != nil {
+		return err
+	}
+	query := "SELECT symbol, price, marketcap, volume, updatedat FROM " + store.PriceHistoryStore + m.asOf +
+		" WHERE " + m.dialect.anyOf("symbol", "$1") + " AND updatedat >= ($2) AND updatedat <= ($3)" +
+		" ORDER BY symbol, updatedat"
+
+	rows, err := m.readDB.QueryxContext(ctx, m.rebind(query), symbolsArg, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck
+
+	var sample types.HistoricalPrice
+	for rows.Next() {
+		if err := rows.StructScan(&sample); err != nil {
+			return err
+		}
+		if err := fn(sample); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// UpsertPriceHistory writes the given samples in the price history. A sample
+// with the same symbol and timestamp as an existing one replaces it, which makes
+// writing the same history twice harmless.
+func (m *SqlDB) UpsertPriceHistory(ctx context.Context, history []types.HistoricalPrice) error {
+	defer sentry.StartSpan(ctx, "db.UpsertPriceHistory").Finish()
+
+	if len(history) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, 0, len(history))
+	for _, h := range history {
+		rows = append(rows, []interface{}{h.Symbol, h.UpdatedAt, h.Price, h.MarketCap, h.Volume})
+	}
+	return crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+		return m.upsertRows(ctx, tx, store.PriceHistoryStore, []string{"symbol", "updatedat", "price", "marketcap", "volume"}, 2, conflictUpdate, rows)
+	})
+}
+
+// GetBackfillProgress returns the progress of every backfill ever started,
+// ordered by symbol and range.
+func (m *SqlDB) GetBackfillProgress(ctx context.Context) ([]types.BackfillProgress, error) {
+	defer sentry.StartSpan(ctx, "db.GetBackfillProgress").Finish()
+
+	progress := []types.BackfillProgress{}
+	err := m.db.SelectContext(ctx, &progress, m.rebind(
+		"SELECT symbol, geckoid, fromts, tots, doneuntil, updatedat FROM "+store.BackfillStore+" ORDER BY symbol, fromts, tots"))
+	if err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// UpsertBackfillProgress records the progress of the backfill of
+// progress.Symbol between progress.From and progress.To.
+func (m *SqlDB) UpsertBackfillProgress(ctx context.Context, progress types.BackfillProgress) error {
+	defer sentry.StartSpan(ctx, "db.UpsertBackfillProgress").Finish()
+
+	_, err := m.db.ExecContext(ctx, m.rebind(
+		"INSERT INTO "+store.BackfillStore+" (symbol, fromts, tots, geckoid, doneuntil, updatedat) VALUES ($1, $2, $3, $4, $5, $6)"+
+			" ON CONFLICT (symbol, fromts, tots) DO UPDATE SET geckoid = excluded.geckoid, doneuntil = excluded.doneuntil, updatedat = excluded.updatedat"),
+		progress.Symbol, progress.From, progress.To, progress.GeckoID, progress.DoneUntil, progress.UpdatedAt)
+	return err
+}
+
+// AppendAudit adds entries to the price audit log, in a single transaction.
+func (m *SqlDB) AppendAudit(ctx context.Context, entries []types.AuditEntry) error {
+	defer sentry.StartSpan(ctx, "db.AppendAudit").Finish()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	rows := make([][]interface{}, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, []interface{}{e.Symbol, e.CreatedAt, e.Kind, e.Source, e.Price, e.QuotedAt, e.Reason})
+	}
+	// An entry recorded twice in the same second is recorded once.
+	return crdb.ExecuteTx(ctx, m.db.DB, nil, func(tx *sql.Tx) error {
+		return m.upsertRows(ctx, tx, store.AuditStore, []string{"symbol", "createdat", "kind", "source", "price", "quotedat", "reason"}, 4, conflictIgnore, rows)
+	})
+}
+
+// GetAudit returns the audit entries of symbol created between from and to
+// (unix seconds, both inclusive), ordered by time, kind and source.
+func (m *SqlDB) GetAudit(ctx context.Context, symbol string, from int64, to int64) ([]types.AuditEntry, error) {
+	defer sentry.StartSpan(ctx, "db.GetAudit").Finish()
+
+	entries := []types.AuditEntry{}
+	err := m.readDB.SelectContext(ctx, &entries, m.rebind(
+		"SELECT symbol, createdat, kind, source, price, quotedat, reason FROM "+store.AuditStore+m.asOf+
+			" WHERE symbol = ($1) AND createdat >= ($2) AND createdat <= ($3) ORDER BY createdat, kind, source"), symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteAuditBefore deletes the audit entries created before (param:<before>)
+// and returns how many were deleted.
+func (m *SqlDB) DeleteAuditBefore(ctx context.Context, before int64) (int64, error) {
+	defer sentry.StartSpan(ctx, "db.DeleteAuditBefore").Finish()
+
+	res, err := m.db.ExecContext(ctx, m.rebind("DELETE FROM "+store.AuditStore+" WHERE createdat < ($1)"), before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (m *SqlDB) Query(query string, args ...interface{}) (*sqlx.Rows, error) {
-	return m.db.Queryx(query, args...)
+	return m.db.Queryx(m.rebind(query), args...)
 }
 
 // NewDB returns an Instance connected to the database pointed by connString.
-func NewDB(connString string) (*SqlDB, error) {
-	return NewWithDriver(connString, DriverPGX)
+func NewDB(connString string, opts ...Option) (*SqlDB, error) {
+	return NewWithDriver(connString, DriverPGX, opts...)
 }
 
-// NewWithDriver returns an Instance connected to the database pointed by connString with the given driver.
-func NewWithDriver(connString string, driver string) (*SqlDB, error) {
-	db, err := sqlx.Connect(driver, connString)
+// NewWithDriver returns an Instance connected to the CockroachDB database pointed by connString with the given driver.
+func NewWithDriver(connString string, driver string, opts ...Option) (*SqlDB, error) {
+	return newDB(connString, driver, DialectCockroach, opts)
+}
+
+// NewWithDialect returns an Instance connected to the database pointed by
+// connString, speaking the given dialect. For SQLite, connString is a file
+// path or a modernc.org/sqlite data source name.
+func NewWithDialect(connString string, dialect Dialect, opts ...Option) (*SqlDB, error) {
+	switch dialect {
+	case DialectCockroach, DialectPostgres:
+	case DialectSQLite:
+		connString = sqliteDSN(connString)
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %q", dialect)
+	}
+	return newDB(connString, dialect.driver(), dialect, opts)
+}
+
+func newDB(connString string, driver string, dialect Dialect, opts []Option) (*SqlDB, error) {
+	o := options{
+		maxConns:     defaultMaxConns,
+		readMaxConns: defaultMaxConns,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.followerReads && dialect != DialectCockroach {
+		return nil, fmt.Errorf("follower reads need CockroachDB, got %s", dialect)
+	}
+
+	readConnString := connString
+	if o.readConnString != "" {
+		readConnString = o.readConnString
+		if dialect == DialectSQLite {
+			readConnString = sqliteDSN(readConnString)
+		}
+	}
+
+	db, err := connect(driver, connString, o.maxConns)
 	if err != nil {
 		return nil, err
 	}
+	readDB, err := connect(driver, readConnString, o.readMaxConns)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("read pool: %w", err)
+	}
 
-	m := &SqlDB{
+	return &SqlDB{
 		db:         db,
 		connString: connString,
+		dialect:    dialect,
+		readDB:     readDB,
+		asOf:       o.asOfSystemTime(),
+	}, nil
+}
+
+// connect returns a pool of at most maxConns connections to connString.
+func connect(driver string, connString string, maxConns int) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(driver, connString)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := m.db.Ping(); err != nil {
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("cannot ping db, %w", err)
 	}
 
-	m.db.DB.SetMaxOpenConns(25)
-	m.db.DB.SetMaxIdleConns(25)
-	m.db.DB.SetConnMaxLifetime(5 * time.Minute)
+	db.DB.SetMaxOpenConns(maxConns)
+	db.DB.SetMaxIdleConns(maxConns)
+	db.DB.SetConnMaxLifetime(5 * time.Minute)
+
+	return db, nil
+}
 
-	return m, nil
+// rebind adapts a query to the dialect of m.
+func (m *SqlDB) rebind(query string) string {
+	return m.dialect.rebind(query)
 }
 
-// Close closes the connection held by m.
+// Close closes the connections held by m.
 func (m *SqlDB) Close() error {
+	if err := m.readDB.Close(); err != nil {
+		_ = m.db.Close()
+		return err
+	}
 	return m.db.Close()
 }
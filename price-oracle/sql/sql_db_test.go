@@ -48,83 +48,104 @@ func TestMigrations(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
+	ctx := context.Background()
+
 	// check for DB
 	_, err = mDB.Query("SHOW TABLES FROM oracle")
 	require.Contains(t, err.Error(), "target database or schema does not exist")
 
-	// create DB
-	err = mDB.createDatabase(context.Background())
-	require.NoError(t, err)
-
-	// check for tables
-	tables, err := mDB.Query("SHOW TABLES FROM oracle")
+	// nothing applied yet
+	status, err := mDB.MigrationsStatus(ctx)
 	require.NoError(t, err)
-
-	tableCountDB := 0
-	for tables.Next() {
-		tableCountDB++
+	require.Len(t, status, len(migrationList))
+	for _, s := range status {
+		require.False(t, s.Applied)
 	}
+	require.Equal(t, 2, countTables(t, mDB))
 
-	err = tables.Close()
+	// apply the first migration only
+	applied, err := mDB.MigrateUp(ctx, 1)
 	require.NoError(t, err)
+	require.Equal(t, []int{migrationList[0].Version}, applied)
+	require.Equal(t, 2+countCreateTables(migrationList[:1]), countTables(t, mDB))
 
-	require.Equal(t, 0, tableCountDB)
-
-	// create tables
-	err = mDB.runMigrations(context.Background())
+	// apply the rest
+	applied, err = mDB.MigrateUp(ctx, 0)
 	require.NoError(t, err)
+	require.Len(t, applied, len(migrationList)-1)
+	require.Equal(t, 2+countCreateTables(migrationList), countTables(t, mDB))
 
-	// check for tables
-	tables, err = mDB.Query("SHOW TABLES FROM oracle")
+	status, err = mDB.MigrationsStatus(ctx)
 	require.NoError(t, err)
-
-	tableCountDB = 0
-	for tables.Next() {
-		tableCountDB++
+	for _, s := range status {
+		require.True(t, s.Applied)
+		require.False(t, s.AppliedAt.IsZero())
 	}
 
-	err = tables.Close()
+	// nothing left to apply
+	applied, err = mDB.MigrateUp(ctx, 0)
 	require.NoError(t, err)
+	require.Empty(t, applied)
 
-	var tableCountMigration int
-	for _, migrationQuery := range migrationList {
-		if strings.HasPrefix(strings.TrimPrefix(migrationQuery, "\n"), "CREATE TABLE") {
-			tableCountMigration++
-		}
-	}
-
-	require.Equal(t, tableCountMigration, tableCountDB)
-
-	// drop a table
-	_, err = mDB.db.Exec("DROP TABLE oracle.coingecko")
+	// roll back the last migration
+	last := migrationList[len(migrationList)-1]
+	reverted, err := mDB.MigrateDown(ctx, 1)
 	require.NoError(t, err)
+	require.Equal(t, []int{last.Version}, reverted)
+	require.Equal(t, 2+countCreateTables(migrationList[:len(migrationList)-1]), countTables(t, mDB))
 
-	// count tables
-	tables, err = mDB.Query("SHOW TABLES FROM oracle")
+	status, err = mDB.MigrationsStatus(ctx)
 	require.NoError(t, err)
+	require.False(t, status[len(status)-1].Applied)
 
-	tableCountDB = 0
-	for tables.Next() {
-		tableCountDB++
-	}
-
-	require.Equal(t, tableCountMigration-1, tableCountDB)
-
-	// create tables
-	err = mDB.runMigrations(context.Background())
+	// and apply it again
+	applied, err = mDB.MigrateUp(ctx, 0)
 	require.NoError(t, err)
+	require.Equal(t, []int{last.Version}, applied)
 
-	// check for tables
-	tables, err = mDB.Query("SHOW TABLES FROM oracle")
+	// unknown migrations are reported
+	_, err = mDB.db.Exec("INSERT INTO oracle.schema_migrations (version, name, appliedat) VALUES (999, 'from the future', 0)")
 	require.NoError(t, err)
+	_, err = mDB.MigrateUp(ctx, 0)
+	require.ErrorIs(t, err, ErrUnknownMigration)
+}
+
+func TestMigrations_ConcurrentInit(t *testing.T) {
+	testServer := setup(t)
+	defer tearDown(testServer)
+
+	connStr := testServer.PGURL().String()
+	require.NotNil(t, connStr)
 
-	tableCountDB = 0
-	for tables.Next() {
-		tableCountDB++
+	const replicas = 3
+	dbs := make([]*SqlDB, 0, replicas)
+	for i := 0; i < replicas; i++ {
+		mDB, err := NewDB(connStr)
+		require.NoError(t, err)
+		dbs = append(dbs, mDB)
 	}
+	defer func() {
+		for _, mDB := range dbs {
+			require.NoError(t, mDB.Close())
+		}
+	}()
 
-	require.Equal(t, tableCountMigration, tableCountDB)
+	errs := make(chan error, replicas)
+	for _, mDB := range dbs {
+		go func(mDB *SqlDB) {
+			errs <- mDB.Init(context.Background())
+		}(mDB)
+	}
+	for i := 0; i < replicas; i++ {
+		require.NoError(t, <-errs)
+	}
 
+	status, err := dbs[0].MigrationsStatus(context.Background())
+	require.NoError(t, err)
+	for _, s := range status {
+		require.True(t, s.Applied)
+	}
+	require.Equal(t, 2+countCreateTables(migrationList), countTables(t, dbs[0]))
 }
 
 func TestInit(t *testing.T) {
@@ -145,28 +166,40 @@ func TestInit(t *testing.T) {
 	err = mDB.Init(context.Background())
 	require.NoError(t, err)
 
+	// migrations tables + tables created by the migrations
+	require.Equal(t, 2+countCreateTables(migrationList), countTables(t, mDB))
+
+	// Init is idempotent
+	err = mDB.Init(context.Background())
+	require.NoError(t, err)
+}
+
+func countTables(t *testing.T, mDB *SqlDB) int {
+	t.Helper()
+
 	rows, err := mDB.Query("SHOW TABLES FROM oracle")
 	require.NoError(t, err)
 	require.NotNil(t, rows)
 
-	var tableCountDB int
+	var count int
 	for rows.Next() {
-		tableCountDB++
+		count++
 	}
-	err = rows.Err()
-	require.NoError(t, err)
-
-	err = rows.Close()
-	require.NoError(t, err)
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	return count
+}
 
-	var tableCountMigration int
-	for _, migrationQuery := range migrationList {
-		if strings.HasPrefix(strings.TrimPrefix(migrationQuery, "\n"), "CREATE TABLE") {
-			tableCountMigration++
+func countCreateTables(migrations []Migration) int {
+	var count int
+	for _, mig := range migrations {
+		for _, q := range mig.Up {
+			if strings.HasPrefix(strings.TrimPrefix(q, "\n"), "CREATE TABLE") {
+				count++
+			}
 		}
 	}
-
-	require.Equal(t, tableCountMigration, tableCountDB)
+	return count
 }
 
 func TestGetTokens(t *testing.T) {
@@ -188,15 +221,16 @@ func TestGetTokens(t *testing.T) {
 	require.NoError(t, err)
 
 	token := types.TokenPriceAndSupply{
-		Symbol: "ATOM",
-		Price:  -50,
-		Supply: -100000,
+		Symbol:            "ATOM",
+		Price:             -50,
+		Supply:            floatPtr(-100000),
+		CirculatingSupply: floatPtr(-100000),
 	}
 
 	err = mDB.UpsertPrice(context.Background(), store.TokensStore, token.Price, token.Symbol)
 	require.NoError(t, err)
 
-	err = mDB.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, token.Symbol, token.Supply)
+	err = mDB.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, token.Symbol, *token.Supply)
 	require.NoError(t, err)
 
 	resp, err := mDB.GetTokenPriceAndSupplies(context.Background(), []string{"ATOM"})
@@ -449,13 +483,13 @@ func TestUpsertTokenSupply(t *testing.T) {
 
 	price := types.TokenPriceAndSupply{
 		Symbol: "ATOM",
-		Supply: -200,
+		Supply: floatPtr(-200),
 	}
 
-	err = mDB.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, price.Symbol, price.Supply)
+	err = mDB.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, price.Symbol, *price.Supply)
 	require.NoError(t, err)
 
-	rows, err := mDB.Query("SELECT * FROM " + store.CoingeckoSupplyStore)
+	rows, err := mDB.Query("SELECT symbol, supply FROM " + store.CoingeckoSupplyStore)
 	require.NoError(t, err)
 
 	var symbol string
@@ -465,7 +499,7 @@ func TestUpsertTokenSupply(t *testing.T) {
 	for rows.Next() {
 		err = rows.Scan(&symbol, &supply)
 		require.NoError(t, err)
-		prices = append(prices, types.TokenPriceAndSupply{Symbol: symbol, Supply: supply})
+		prices = append(prices, types.TokenPriceAndSupply{Symbol: symbol, Supply: floatPtr(supply)})
 	}
 	err = rows.Close()
 	require.NoError(t, err)
@@ -473,6 +507,10 @@ func TestUpsertTokenSupply(t *testing.T) {
 	require.Equal(t, price, prices[0])
 }
 
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
 func setup(t *testing.T) testserver.TestServer {
 	t.Helper()
 	ts, err := testserver.NewTestServer()
@@ -485,3 +523,38 @@ func setup(t *testing.T) testserver.TestServer {
 func tearDown(ts testserver.TestServer) {
 	ts.Stop()
 }
+
+func TestFollowerReads(t *testing.T) {
+	testServer := setup(t)
+	defer tearDown(testServer)
+
+	connStr := testServer.PGURL().String()
+	ctx := context.Background()
+
+	mDB, err := NewDB(connStr, WithFollowerReads(0))
+	require.NoError(t, err)
+	defer mDB.Close() //nolint:errcheck
+	require.NoError(t, mDB.Init(ctx))
+
+	// Follower reads are served as of a few seconds ago, the tables are older
+	// than that by the time they are read, rows written now are not.
+	time.Sleep(5 * time.Second)
+	require.NoError(t, mDB.UpsertPrice(ctx, store.TokensStore, 1, "ATOMUSDT"))
+	require.NoError(t, mDB.UpsertPrice(ctx, store.FiatsStore, 1, "USDEUR"))
+
+	tokens, err := mDB.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+	fiats, err := mDB.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Empty(t, fiats)
+	_, err = mDB.GetPriceHistory(ctx, "ATOMUSDT", 0, time.Now().Unix())
+	require.NoError(t, err)
+	_, err = mDB.GetPriceHistoryAt(ctx, []string{"ATOMUSDT"}, time.Now().Unix(), 60)
+	require.NoError(t, err)
+
+	// The aggregators read their own writes.
+	prices, err := mDB.GetPrices(ctx, store.TokensStore)
+	require.NoError(t, err)
+	require.Len(t, prices, 1)
+}
@@ -0,0 +1,183 @@
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	mDB := setupSQLite(t)
+
+	err := mDB.Init(context.Background())
+	require.NoError(t, err)
+
+	store.TestStore(t, mDB)
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	mDB := setupSQLite(t)
+	ctx := context.Background()
+
+	applied, err := mDB.MigrateUp(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrationList))
+
+	// Init is a no-op once everything is applied.
+	require.NoError(t, mDB.Init(ctx))
+
+	reverted, err := mDB.MigrateDown(ctx, len(migrationList))
+	require.NoError(t, err)
+	require.Len(t, reverted, len(migrationList))
+
+	status, err := mDB.MigrationsStatus(ctx)
+	require.NoError(t, err)
+	for _, s := range status {
+		require.False(t, s.Applied)
+	}
+
+	applied, err = mDB.MigrateUp(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrationList))
+}
+
+func TestSQLiteMigrations_FailureRollsBack(t *testing.T) {
+	mDB := setupSQLite(t)
+	ctx := context.Background()
+
+	defer func(migrations []Migration) { migrationList = migrations }(migrationList)
+	broken := Migration{
+		Version: migrationList[len(migrationList)-1].Version + 1,
+		Name:    "broken",
+		Up:      []string{"CREATE TABLE oracle.half (id BIGINT PRIMARY KEY)", "NOT SQL"},
+	}
+	migrationList = append(append([]Migration(nil), migrationList...), broken)
+
+	applied, err := mDB.MigrateUp(ctx, 0)
+	require.Error(t, err)
+	require.Len(t, applied, len(migrationList)-1)
+
+	status, err := mDB.MigrationsStatus(ctx)
+	require.NoError(t, err)
+	require.False(t, status[len(status)-1].Applied)
+	var tables int
+	require.NoError(t, mDB.db.GetContext(ctx, &tables, "SELECT count(*) FROM sqlite_master WHERE name = 'oracle_half'"))
+	require.Zero(t, tables)
+}
+
+func TestSQLiteMigrations_ConcurrentInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oracle.db")
+
+	const replicas = 3
+	errs := make(chan error, replicas)
+	for i := 0; i < replicas; i++ {
+		mDB, err := NewWithDialect(path, DialectSQLite)
+		require.NoError(t, err)
+		defer mDB.Close() //nolint:errcheck
+
+		go func(mDB *SqlDB) {
+			errs <- mDB.Init(context.Background())
+		}(mDB)
+	}
+	for i := 0; i < replicas; i++ {
+		require.NoError(t, <-errs)
+	}
+}
+
+func TestSQLiteCNS(t *testing.T) {
+	mDB := setupSQLite(t)
+	require.NoError(t, mDB.Init(context.Background()))
+
+	// The CNS tables are not ours, create the part we read.
+	_, err := mDB.db.Exec("CREATE TABLE cns_chains (chain_name TEXT PRIMARY KEY, public_node_endpoints TEXT, denoms TEXT)")
+	require.NoError(t, err)
+	_, err = mDB.db.Exec(`INSERT INTO cns_chains VALUES
+		('cosmos-hub', '{"cosmos_api": ["http://lcd.cosmos.hub"]}', '[{"name": "uatom", "ticker": "ATOM", "price_id": "cosmos", "precision": 6, "fetch_price": true}]'),
+		('osmosis', '{}', '[{"name": "uosmo", "ticker": "OSMO", "price_id": "osmosis", "fetch_price": true}, {"name": "uion", "ticker": "ION", "fetch_price": false}]')`)
+	require.NoError(t, err)
+
+	names, err := mDB.GetTokenNames(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"ATOM", "OSMO"}, names)
+
+	priceIDs, err := mDB.GetPriceIDToTicker(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"cosmos": "atom", "osmosis": "osmo"}, priceIDs)
+
+	// osmosis has no Cosmos SDK REST API endpoint.
+	denoms, err := mDB.GetCNSChainDenoms(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []types.ChainDenom{
+		{ChainName: "cosmos-hub", Endpoint: "http://lcd.cosmos.hub", Name: "uatom", Ticker: "ATOM", Precision: 6, FetchPrice: true},
+	}, denoms)
+}
+
+func TestSQLiteReadPool(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// The read pool points at another database, standing for a replica.
+	replica, err := NewWithDialect(filepath.Join(dir, "replica.db"), DialectSQLite)
+	require.NoError(t, err)
+	defer replica.Close() //nolint:errcheck
+	require.NoError(t, replica.Init(ctx))
+	require.NoError(t, replica.UpsertPrice(ctx, store.FiatsStore, 2, "USDEUR"))
+
+	mDB, err := NewWithDialect(filepath.Join(dir, "oracle.db"), DialectSQLite,
+		WithMaxConns(2), WithReadPool(filepath.Join(dir, "replica.db"), 4))
+	require.NoError(t, err)
+	defer mDB.Close() //nolint:errcheck
+	require.NoError(t, mDB.Init(ctx))
+	require.NoError(t, mDB.UpsertPrice(ctx, store.FiatsStore, 1, "USDEUR"))
+
+	require.Equal(t, 2, mDB.db.Stats().MaxOpenConnections)
+	require.Equal(t, 4, mDB.readDB.Stats().MaxOpenConnections)
+
+	fiats, err := mDB.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Equal(t, []types.FiatPrice{{Symbol: "USDEUR", Price: 2}}, fiats)
+
+	prices, err := mDB.GetPrices(ctx, store.FiatsStore)
+	require.NoError(t, err)
+	require.Equal(t, []types.Prices{{Symbol: "USDEUR", Price: 1}}, prices)
+}
+
+func TestOptions(t *testing.T) {
+	_, err := NewWithDialect(filepath.Join(t.TempDir(), "oracle.db"), DialectSQLite, WithFollowerReads(0))
+	require.Error(t, err)
+	_, err = NewWithDialect(filepath.Join(t.TempDir(), "oracle.db"), DialectSQLite, WithMaxConns(0))
+	require.Error(t, err)
+
+	var o options
+	require.Equal(t, "", o.asOfSystemTime())
+	require.NoError(t, WithFollowerReads(0)(&o))
+	require.Equal(t, " AS OF SYSTEM TIME follower_read_timestamp()", o.asOfSystemTime())
+	require.NoError(t, WithFollowerReads(4800*time.Millisecond)(&o))
+	require.Equal(t, " AS OF SYSTEM TIME '-4.8s'", o.asOfSystemTime())
+	require.Error(t, WithFollowerReads(-time.Second)(&o))
+}
+
+func TestRebind(t *testing.T) {
+	q := "SELECT * FROM oracle.tokens t JOIN cns.chains c ON t.symbol = $1 WHERE oracle.tokens.price > 0"
+	require.Equal(t, q, DialectCockroach.rebind(q))
+	require.Equal(t, q, DialectPostgres.rebind(q))
+	require.Equal(t,
+		"SELECT * FROM oracle_tokens t JOIN cns_chains c ON t.symbol = $1 WHERE oracle_tokens.price > 0",
+		DialectSQLite.rebind(q))
+}
+
+func setupSQLite(t *testing.T) *SqlDB {
+	t.Helper()
+
+	mDB, err := NewWithDialect(filepath.Join(t.TempDir(), "oracle.db"), DialectSQLite)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, mDB.Close())
+	})
+	return mDB
+}
@@ -11,6 +11,14 @@ import (
 	"go.uber.org/zap"
 )
 
+// Names of the aggregator workers in Handler.Workers.
+const (
+	TokenAggregatorWorker = "aggregator-token"
+	FiatAggregatorWorker  = "aggregator-fiat"
+)
+
+// StartAggregate runs the token and fiat aggregators as daemons until ctx is
+// done, and returns once the daemons have stopped.
 func StartAggregate(ctx context.Context, storeHandler *Handler) {
 	fetchInterval, err := time.ParseDuration(storeHandler.Cfg.Interval)
 	if err != nil {
@@ -18,29 +26,33 @@ func StartAggregate(ctx context.Context, storeHandler *Handler) {
 	}
 
 	var wg sync.WaitGroup
-	runAsDaemon := daemon.MakeDaemon(fetchInterval*3, storeHandler.Cfg.RecoverCount, AggregateManager)
 
 	workers := map[string]struct {
 		worker daemon.AggFunc
 		doneCh chan struct{}
 	}{
-		"token": {worker: storeHandler.PriceTokenAggregator, doneCh: make(chan struct{})},
-		"fiat":  {worker: storeHandler.PriceFiatAggregator, doneCh: make(chan struct{})},
+		TokenAggregatorWorker: {worker: storeHandler.PriceTokenAggregator, doneCh: make(chan struct{})},
+		FiatAggregatorWorker:  {worker: storeHandler.PriceFiatAggregator, doneCh: make(chan struct{})},
 	}
-	for _, properties := range workers {
+	for name, properties := range workers {
 		wg.Add(1)
+		runAsDaemon := daemon.MakeDaemon(fetchInterval*3, storeHandler.Cfg.RecoverCount, AggregateManager,
+			daemon.WithName(name), daemon.WithRegistry(storeHandler.Workers), daemon.WithRestartPolicy(storeHandler.RestartPolicy))
 		heartbeatCh, errCh := runAsDaemon(ctx, properties.doneCh, storeHandler.Cfg.WorkerPulse, storeHandler.Logger, storeHandler.Cfg, properties.worker)
 		go func(ctx context.Context, done chan struct{}, workerName string, lastLogTime time.Time) {
-			defer close(done)
 			defer wg.Done()
 			for {
 				select {
 				case <-ctx.Done():
+					close(done)
+					// The daemon closes its channels once stopped.
+					for range heartbeatCh {
+					}
 					return
 				case heartbeat := <-heartbeatCh:
 					// Reduce number of logs on std out. Without this we have a very busy std out.
 					if time.Since(lastLogTime) > 60*time.Second {
-						storeHandler.Logger.Infof("Heartbeat received: %v: %v", workerName, heartbeat)
+						storeHandler.Logger.Infow("Heartbeat received", "worker", workerName, "status", heartbeat)
 						lastLogTime = time.Now()
 					}
 				case err, ok := <-errCh:
@@ -48,12 +60,11 @@ func StartAggregate(ctx context.Context, storeHandler *Handler) {
 					if !ok {
 						return
 					}
-					storeHandler.Logger.Errorf("Error: %T : %v", workerName, err)
+					storeHandler.Logger.Errorw("Aggregator", "worker", workerName, "Error:", err)
 				}
 			}
-		}(ctx, properties.doneCh, daemon.GetFunctionName(properties.worker), time.Now().Add(-60*time.Second))
+		}(ctx, properties.doneCh, name, time.Now().Add(-60*time.Second))
 	}
-	// TODO: Handle signal. Start/stop worker.
 	wg.Wait()
 }
 
@@ -67,15 +78,20 @@ func AggregateManager(
 ) (chan interface{}, chan error) {
 	heartbeatCh := make(chan interface{})
 	errCh := make(chan error)
+	run := daemon.Recover(fn)
 	go func() {
 		defer close(heartbeatCh)
 		defer close(errCh)
 		fetchInterval, err := time.ParseDuration(cfg.Interval)
 		if err != nil {
 			logger.Errorw("AggregateManager", "Err:", err)
-			errCh <- err
+			select {
+			case errCh <- err:
+			case <-done:
+			}
 			return
 		}
+		var hb daemon.Heartbeat
 		ticker := time.NewTicker(fetchInterval)
 		defer ticker.Stop()
 		pulse := time.NewTicker(pulseInterval)
@@ -85,15 +101,29 @@ func AggregateManager(
 			case <-done:
 				return
 			case <-ticker.C:
-				if err := fn(ctx); err != nil {
-					logger.Errorw("AggregateManager", "Worker returned Err:", err)
-					errCh <- err
-				}
+			case <-daemon.Triggered(ctx):
 			case <-pulse.C:
 				select {
-				case heartbeatCh <- fmt.Sprintf("AggregateManager(%v)", daemon.GetFunctionName(fn)):
+				case heartbeatCh <- hb:
 				default:
 				}
+				continue
+			}
+			err := hb.Record(ctx, run)
+			// Report the run without waiting for the pulse, and before its
+			// error, which restarts the worker.
+			select {
+			case heartbeatCh <- hb:
+			case <-done:
+				return
+			}
+			if err != nil {
+				logger.Errorw("AggregateManager", "Worker returned Err:", err)
+				select {
+				case errCh <- err:
+				case <-done:
+					return
+				}
 			}
 		}
 	}()
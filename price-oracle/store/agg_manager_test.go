@@ -1,11 +1,14 @@
 package store_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
@@ -107,12 +110,17 @@ func TestAggregateManager_worker_restarts(t *testing.T) {
 	for i := 0; i < numRecover; i++ {
 		require.Contains(t, (<-errCh).Error(), "sql: database is closed")
 	}
+	// The next error terminates the worker, the daemon runs until done.
+	require.Eventually(t, func() bool {
+		hb, ok := (<-hbCh).(daemon.WorkerStatus)
+		return ok && hb.Terminated
+	}, 30*time.Second, time.Millisecond)
+	close(done)
 	// Ensure everything is closed
 	_, ok := <-errCh
 	require.Equal(t, false, ok)
-	close(done)
-	_, ok = <-hbCh
-	require.Equal(t, false, ok)
+	for range hbCh {
+	}
 }
 
 func TestAveraging(t *testing.T) {
@@ -135,3 +143,27 @@ func TestAveraging(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, fmt.Errorf("Store.Averaging(): empty price list received"), err)
 }
+
+func TestAggregateManager_countsFailuresAcrossRestarts(t *testing.T) {
+	registry := daemon.NewRegistry()
+	runAsDaemon := daemon.MakeDaemon(time.Second, -1, store.AggregateManager, daemon.WithName("failing"), daemon.WithRegistry(registry))
+	done := make(chan struct{})
+	defer close(done)
+	cfg := &config.Config{Interval: "10ms"}
+	failing := func(context.Context) error { return errors.New("db down") }
+	_, errCh := runAsDaemon(context.Background(), done, 5*time.Millisecond, zap.NewNop().Sugar(), cfg, failing)
+	go func() {
+		for range errCh {
+		}
+	}()
+
+	// Every run fails and restarts the worker, its failures still add up.
+	require.Eventually(t, func() bool {
+		status, _ := registry.Get("failing")
+		return status.Restarts >= 3 && status.Errors >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	status, _ := registry.Get("failing")
+	require.Equal(t, status.Runs, status.Errors)
+	require.GreaterOrEqual(t, status.ConsecutiveFailures, 3)
+	require.Equal(t, "db down", status.LastError)
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// auditPruneInterval is how often audit entries older than
+// Cfg.AuditRetention are deleted.
+const auditPruneInterval = time.Hour
+
+// reasonStale is why aggregators reject quotes that were not updated in the
+// last minute.
+const reasonStale = "stale"
+
+// auditLog remembers what was last recorded in the audit log for every key,
+// so that, with Cfg.AuditChangesOnly, the audit log only grows when something
+// changes. Without it every aggregator tick records a row per source plus one
+// per symbol.
+type auditLog struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+// changed returns the fingerprint of entries, their record times aside, and
+// whether it differs from the last one recorded for key.
+func (l *auditLog) changed(key string, entries []types.AuditEntry) (string, bool) {
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s|%s|%v|%d|%s;", e.Kind, e.Source, e.Price, e.QuotedAt, e.Reason)
+	}
+	fingerprint := b.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fingerprint, l.last[key] != fingerprint
+}
+
+// recorded remembers fingerprints, by key, as recorded in the audit log.
+func (l *auditLog) recorded(fingerprints map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last == nil {
+		l.last = make(map[string]string, len(fingerprints))
+	}
+	for key, fingerprint := range fingerprints {
+		l.last[key] = fingerprint
+	}
+}
+
+// AuditQuotes records the raw quotes just written by the provider store
+// (param:<provider>), e.g. BinanceStore, in the audit log. With
+// Cfg.AuditChangesOnly, a quote is only recorded when its price or its time
+// changed since the last one recorded. The audit log is best effort, errors
+// are only logged.
+func (h *Handler) AuditQuotes(ctx context.Context, provider string, quotes []types.Prices) {
+	now := time.Now().Unix()
+	entries := make([]types.AuditEntry, 0, len(quotes))
+	fingerprints := make(map[string]string, len(quotes))
+	for _, q := range quotes {
+		entry := types.AuditEntry{
+			Symbol:    q.Symbol,
+			CreatedAt: now,
+			Kind:      types.AuditQuote,
+			Source:    provider,
+			Price:     q.Price,
+			QuotedAt:  q.UpdatedAt,
+		}
+		if h.auditChangesOnly() {
+			key := types.AuditQuote + "/" + provider + "/" + q.Symbol
+			fingerprint, changed := h.auditLog.changed(key, []types.AuditEntry{entry})
+			if !changed {
+				continue
+			}
+			fingerprints[key] = fingerprint
+		}
+		entries = append(entries, entry)
+	}
+	h.appendAudit(ctx, entries, fingerprints)
+}
+
+// auditAggregation records the aggregation of every symbol of audit, its
+// inputs and its output, in the audit log. With Cfg.AuditChangesOnly, the
+// aggregation of a symbol is only recorded when its output, or the price, the
+// time or the status of an input, changed since the last one recorded.
+func (h *Handler) auditAggregation(ctx context.Context, audit map[string][]types.AuditEntry) {
+	entries := make([]types.AuditEntry, 0, len(audit))
+	fingerprints := make(map[string]string, len(audit))
+	for symbol, e := range audit {
+		if h.auditChangesOnly() {
+			fingerprint, changed := h.auditLog.changed(symbol, e)
+			if !changed {
+				continue
+			}
+			fingerprints[symbol] = fingerprint
+		}
+		entries = append(entries, e...)
+	}
+	h.appendAudit(ctx, entries, fingerprints)
+}
+
+// appendAudit records entries in the audit log, then their fingerprints once
+// they are written, so that entries failing to be written are retried.
+func (h *Handler) appendAudit(ctx context.Context, entries []types.AuditEntry, fingerprints map[string]string) {
+	if err := h.Store.AppendAudit(ctx, entries); err != nil {
+		h.Logger.Errorw("Audit", "AppendAudit Err:", err)
+		return
+	}
+	h.auditLog.recorded(fingerprints)
+}
+
+func (h *Handler) auditChangesOnly() bool {
+	return h.Cfg != nil && h.Cfg.AuditChangesOnly
+}
+
+// PruneAudit deletes the audit entries older than Cfg.AuditRetention. Entries
+// are kept forever when it is zero.
+func (h *Handler) PruneAudit(ctx context.Context) error {
+	if h.Cfg.AuditRetention <= 0 {
+		return nil
+	}
+	deleted, err := h.Store.DeleteAuditBefore(ctx, time.Now().Add(-h.Cfg.AuditRetention).Unix())
+	if err != nil {
+		return err
+	}
+	h.Logger.Infow("Audit", "pruned entries", deleted, "retention", h.Cfg.AuditRetention)
+	return nil
+}
+
+// StartAuditPruning runs PruneAudit at startup then every auditPruneInterval,
+// until ctx is done.
+func StartAuditPruning(ctx context.Context, storeHandler *Handler) {
+	ticker := time.NewTicker(auditPruneInterval)
+	defer ticker.Stop()
+	for {
+		if err := storeHandler.PruneAudit(ctx); err != nil {
+			storeHandler.Logger.Errorw("Audit", "PruneAudit Err:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
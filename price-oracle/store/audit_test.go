@@ -0,0 +1,141 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	h, db := newMemoryHandler(t)
+	now := time.Now().Unix()
+
+	binance := []types.Prices{{Symbol: "ATOMUSDT", Price: 10, UpdatedAt: now}}
+	require.NoError(t, db.UpsertTokens(ctx, store.BinanceStore, binance))
+	h.AuditQuotes(ctx, store.BinanceStore, binance)
+	// Too old to be aggregated.
+	coingecko := []types.Prices{{Symbol: "ATOMUSDT", Price: 12, UpdatedAt: now - 120}}
+	require.NoError(t, db.UpsertTokens(ctx, store.CoingeckoStore, coingecko))
+
+	require.NoError(t, h.PriceTokenAggregator(ctx))
+
+	entries, err := db.GetAudit(ctx, "ATOMUSDT", now-10, now+10)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	for i := range entries {
+		require.InDelta(t, now, entries[i].CreatedAt, 5)
+		entries[i].CreatedAt = 0
+	}
+	require.ElementsMatch(t, []types.AuditEntry{
+		{Symbol: "ATOMUSDT", Kind: types.AuditQuote, Source: store.BinanceStore, Price: 10, QuotedAt: now},
+		{Symbol: "ATOMUSDT", Kind: types.AuditInput, Source: store.BinanceStore, Price: 10, QuotedAt: now},
+		{Symbol: "ATOMUSDT", Kind: types.AuditRejected, Source: store.CoingeckoStore, Price: 12, QuotedAt: now - 120, Reason: "stale"},
+		{Symbol: "ATOMUSDT", Kind: types.AuditOutput, Source: store.TokensStore, Price: 10},
+	}, entries)
+
+	t.Run("retention", func(t *testing.T) {
+		require.NoError(t, db.AppendAudit(ctx, []types.AuditEntry{
+			{Symbol: "ATOMUSDT", CreatedAt: now - 7200, Kind: types.AuditQuote, Source: store.BinanceStore, Price: 9},
+		}))
+
+		// Kept forever by default.
+		require.NoError(t, h.PruneAudit(ctx))
+		entries, err := db.GetAudit(ctx, "ATOMUSDT", 0, now+10)
+		require.NoError(t, err)
+		require.Len(t, entries, 5)
+
+		h.Cfg.AuditRetention = time.Hour
+		require.NoError(t, h.PruneAudit(ctx))
+		entries, err = db.GetAudit(ctx, "ATOMUSDT", 0, now+10)
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+	})
+}
+
+func TestAudit_EveryQuote(t *testing.T) {
+	ctx := context.Background()
+	h, db := newMemoryHandler(t)
+	quotes := []types.Prices{{Symbol: "ATOMUSDT", Price: 10, UpdatedAt: time.Now().Unix()}}
+	require.NoError(t, db.UpsertTokens(ctx, store.BinanceStore, quotes))
+
+	h.AuditQuotes(ctx, store.BinanceStore, quotes)
+	require.NoError(t, h.PriceTokenAggregator(ctx))
+	// Recorded again a second later although nothing changed.
+	time.Sleep(time.Second)
+	h.AuditQuotes(ctx, store.BinanceStore, quotes)
+	require.NoError(t, h.PriceTokenAggregator(ctx))
+
+	entries, err := db.GetAudit(ctx, "ATOMUSDT", 0, time.Now().Unix()+10)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+}
+
+func TestAudit_ChangesOnly(t *testing.T) {
+	ctx := context.Background()
+	h, db := newMemoryHandler(t, store.WithConfig(&config.Config{AuditChangesOnly: true}))
+	quotedAt := time.Now().Unix()
+	aggregate := func(price float64) []types.AuditEntry {
+		t.Helper()
+		quotes := []types.Prices{{Symbol: "ATOMUSDT", Price: price, UpdatedAt: quotedAt}}
+		require.NoError(t, db.UpsertTokens(ctx, store.BinanceStore, quotes))
+		h.AuditQuotes(ctx, store.BinanceStore, quotes)
+		require.NoError(t, h.PriceTokenAggregator(ctx))
+		entries, err := db.GetAudit(ctx, "ATOMUSDT", 0, time.Now().Unix()+10)
+		require.NoError(t, err)
+		return entries
+	}
+
+	require.Len(t, aggregate(10), 3)
+	// Unchanged, nothing more is recorded.
+	time.Sleep(time.Second)
+	require.Len(t, aggregate(10), 3)
+	// A new quote of the same price is recorded, along with its aggregation.
+	time.Sleep(time.Second)
+	quotedAt++
+	require.Len(t, aggregate(10), 6)
+	// The quote and the aggregation changed.
+	time.Sleep(time.Second)
+	entries := aggregate(11)
+	require.Len(t, entries, 9)
+	for _, e := range entries[6:] {
+		require.Equal(t, 11.0, e.Price)
+	}
+}
+
+// failingAuditDB fails to append audit entries while fail is set.
+type failingAuditDB struct {
+	*memory.DB
+	fail bool
+}
+
+func (db *failingAuditDB) AppendAudit(ctx context.Context, entries []types.AuditEntry) error {
+	if db.fail {
+		return errors.New("append failed")
+	}
+	return db.DB.AppendAudit(ctx, entries)
+}
+
+func TestAudit_ChangesOnlyRetriesFailedWrites(t *testing.T) {
+	ctx := context.Background()
+	h, mem := newMemoryHandler(t, store.WithConfig(&config.Config{AuditChangesOnly: true}))
+	db := &failingAuditDB{DB: mem, fail: true}
+	h.Store = db
+	quotes := []types.Prices{{Symbol: "ATOMUSDT", Price: 10, UpdatedAt: time.Now().Unix()}}
+
+	h.AuditQuotes(ctx, store.BinanceStore, quotes)
+	db.fail = false
+	h.AuditQuotes(ctx, store.BinanceStore, quotes)
+
+	entries, err := db.GetAudit(ctx, "ATOMUSDT", 0, time.Now().Unix()+10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
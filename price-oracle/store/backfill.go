@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gecko "github.com/superoo7/go-gecko/v3"
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// geckoBaseURL is the Coingecko API go-gecko talks to, for the endpoints it
+// does not implement.
+const geckoBaseURL = "https://api.coingecko.com/api/v3"
+
+// backfillWindow is the range of history fetched by a single Coingecko
+// request. Coingecko returns hourly samples for ranges up to 90 days within
+// the last 90 days, daily samples beyond.
+const backfillWindow = 90 * 24 * time.Hour
+
+// backfillRetries is how many times a failed Coingecko request is retried,
+// waiting twice as long every time, before the backfill gives up.
+const backfillRetries = 3
+
+// Backfill fills the price history of the given tokens (e.g. atom, osmo)
+// between from and to (unix seconds, both inclusive) with Coingecko market
+// charts. Tokens are resolved to Coingecko IDs with GetGeckoIdForTokenNames.
+//
+// Coingecko requests are at least Cfg.BackfillRequestInterval apart. The
+// progress of every token is recorded after each request. A backfill starts
+// after the history already backfilled from from on, by any backfill, so one
+// interrupted and started again resumes where it stopped, even when the range
+// moved, e.g. the default range of the backfill subcommand, ending now.
+// Writing the same history twice is harmless.
+func (h *Handler) Backfill(ctx context.Context, geckoClient *gecko.Client, tokens []string, from int64, to int64) error {
+	if from > to {
+		return fmt.Errorf("from is after to")
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("no token to backfill")
+	}
+
+	geckoIDs, err := h.GetGeckoIdForTokenNames(ctx, append([]string(nil), tokens...))
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(geckoIDs))
+	var unknown []string
+	for name, id := range geckoIDs {
+		if id == "" {
+			unknown = append(unknown, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("no gecko id for tokens %s", strings.Join(unknown, ", "))
+	}
+	sort.Strings(names)
+
+	progress, err := h.Store.GetBackfillProgress(ctx)
+	if err != nil {
+		return err
+	}
+	// covered[symbol] are the ranges of history of symbol already backfilled.
+	covered := make(map[string][]timeRange, len(progress))
+	for _, p := range progress {
+		covered[p.Symbol] = append(covered[p.Symbol], timeRange{from: p.From, to: p.DoneUntil})
+	}
+
+	limiter := newRateLimiter(h.Cfg.BackfillRequestInterval)
+	for _, name := range names {
+		symbol := strings.ToUpper(name) + types.USDT
+		start := uncoveredFrom(covered[symbol], from)
+		if start > to {
+			h.Logger.Infow("Backfill", "symbol", symbol, "status", "already done")
+			continue
+		}
+		if err := h.backfillToken(ctx, geckoClient, limiter, symbol, geckoIDs[name], start, types.BackfillProgress{
+			Symbol:  symbol,
+			GeckoID: geckoIDs[name],
+			From:    from,
+			To:      to,
+		}); err != nil {
+			return fmt.Errorf("backfill %s: %w", symbol, err)
+		}
+	}
+	return nil
+}
+
+// uncoveredFrom returns the first time from start on that none of the
+// ranges covers.
+func uncoveredFrom(covered []timeRange, start int64) int64 {
+	for extended := true; extended; {
+		extended = false
+		for _, r := range covered {
+			if r.contains(start) {
+				start = r.to + 1
+				extended = true
+			}
+		}
+	}
+	return start
+}
+
+// backfillToken fetches the history of symbol from start to progress.To one
+// window at a time, recording progress after each.
+func (h *Handler) backfillToken(
+	ctx context.Context,
+	geckoClient *gecko.Client,
+	limiter *rateLimiter,
+	symbol string,
+	geckoID string,
+	start int64,
+	progress types.BackfillProgress,
+) error {
+	window := int64(backfillWindow.Seconds())
+	for start <= progress.To {
+		end := start + window - 1
+		if end > progress.To {
+			end = progress.To
+		}
+
+		data, err := h.fetchMarketChartRange(ctx, geckoClient, limiter, geckoID, start, end)
+		if err != nil {
+			return err
+		}
+		history := chartDataToHistory(symbol, filterChartData(data, []timeRange{{from: start, to: end}}))
+		if err := h.Store.UpsertPriceHistory(ctx, history); err != nil {
+			return err
+		}
+
+		progress.DoneUntil = end
+		progress.UpdatedAt = time.Now().Unix()
+		if err := h.Store.UpsertBackfillProgress(ctx, progress); err != nil {
+			return err
+		}
+		h.Logger.Infow("Backfill", "symbol", symbol, "from", start, "to", end, "samples", len(history))
+		start = end + 1
+	}
+	return nil
+}
+
+// fetchMarketChartRange returns the USD market chart of geckoID between from
+// and to, retrying failed requests.
+func (h *Handler) fetchMarketChartRange(
+	ctx context.Context,
+	geckoClient *gecko.Client,
+	limiter *rateLimiter,
+	geckoID string,
+	from int64,
+	to int64,
+) (*geckoTypes.CoinsIDMarketChart, error) {
+	params := url.Values{}
+	params.Add("vs_currency", "usd")
+	params.Add("from", strconv.FormatInt(from, 10))
+	params.Add("to", strconv.FormatInt(to, 10))
+	u := fmt.Sprintf("%s/coins/%s/market_chart/range?%s", geckoBaseURL, url.PathEscape(geckoID), params.Encode())
+
+	var lastErr error
+	for attempt := 0; attempt <= backfillRetries; attempt++ {
+		// Failed requests are most likely rate limited, back off.
+		if err := limiter.wait(ctx, attempt); err != nil {
+			return nil, err
+		}
+		resp, err := geckoClient.MakeReq(u)
+		if err != nil {
+			lastErr = err
+			h.Logger.Warnw("Backfill", "gecko id", geckoID, "attempt", attempt+1, "error", err)
+			continue
+		}
+		var data geckoTypes.CoinsIDMarketChart
+		if err := json.Unmarshal(resp, &data); err != nil {
+			return nil, fmt.Errorf("unmarshal market chart: %w", err)
+		}
+		return &data, nil
+	}
+	return nil, fmt.Errorf("coingecko market chart %s: %w", geckoID, lastErr)
+}
+
+// rateLimiter spaces calls by at least interval.
+type rateLimiter struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func newRateLimiter(interval time.Duration) *rateLimiter {
+	return &rateLimiter{interval: interval}
+}
+
+// wait blocks until interval, multiplied by 2^backoff, has elapsed since the
+// previous call, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, backoff int) error {
+	d := time.Until(l.last.Add(l.interval << backoff))
+	if d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	l.last = time.Now()
+	return nil
+}
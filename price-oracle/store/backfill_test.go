@@ -0,0 +1,160 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	gecko "github.com/superoo7/go-gecko/v3"
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+const day = int64(24 * 60 * 60)
+
+// geckoRangeServer answers Coingecko market chart range requests with one
+// sample a day, failing the requests whose from is in failFrom. onRequest,
+// when set, is called on every request.
+type geckoRangeServer struct {
+	mu        sync.Mutex
+	requests  []string
+	failFrom  map[int64]bool
+	onRequest func()
+}
+
+func (s *geckoRangeServer) client() *gecko.Client {
+	return gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, req.URL.Path+"?"+req.URL.RawQuery)
+		if s.onRequest != nil {
+			s.onRequest()
+		}
+
+		q := req.URL.Query()
+		from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+		to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+		if s.failFrom[from] {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"error":"rate limited"}`))),
+			}
+		}
+		var prices, marketCaps, volumes []geckoTypes.ChartItem
+		// Coingecko may return a bit more than asked for.
+		for ts := from - from%day; ts <= to+day; ts += day {
+			prices = append(prices, geckoTypes.ChartItem{float32(ts * 1000), 10})
+			marketCaps = append(marketCaps, geckoTypes.ChartItem{float32(ts * 1000), 100})
+			volumes = append(volumes, geckoTypes.ChartItem{float32(ts * 1000), 1000})
+		}
+		b, _ := json.Marshal(geckoTypes.CoinsIDMarketChart{Prices: &prices, MarketCaps: &marketCaps, TotalVolumes: &volumes})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		}
+	}, time.Second))
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	// 200 days, 3 requests of at most 90 days.
+	from := 1000 * day
+	to := from + 200*day - 1
+
+	t.Run("fills the history", func(t *testing.T) {
+		h, db := newMemoryHandler(t)
+		srv := &geckoRangeServer{}
+
+		require.NoError(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from, to))
+		require.Equal(t, []string{
+			"/api/v3/coins/cosmos/market_chart/range?from=86400000&to=94175999&vs_currency=usd",
+			"/api/v3/coins/cosmos/market_chart/range?from=94176000&to=101951999&vs_currency=usd",
+			"/api/v3/coins/cosmos/market_chart/range?from=101952000&to=103679999&vs_currency=usd",
+		}, srv.requests)
+
+		history, err := db.GetPriceHistory(ctx, "ATOMUSDT", 0, 2*to)
+		require.NoError(t, err)
+		require.Len(t, history, 200)
+		require.Equal(t, types.HistoricalPrice{Symbol: "ATOMUSDT", Price: 10, MarketCap: 100, Volume: 1000, UpdatedAt: from}, history[0])
+
+		progress, err := db.GetBackfillProgress(ctx)
+		require.NoError(t, err)
+		require.Len(t, progress, 1)
+		require.Equal(t, "cosmos", progress[0].GeckoID)
+		require.Equal(t, to, progress[0].DoneUntil)
+
+		// A finished backfill does nothing.
+		srv.requests = nil
+		require.NoError(t, h.Backfill(ctx, srv.client(), []string{"atom"}, from, to))
+		require.Empty(t, srv.requests)
+	})
+
+	t.Run("resumes after a failure", func(t *testing.T) {
+		h, db := newMemoryHandler(t)
+		srv := &geckoRangeServer{failFrom: map[int64]bool{from + 90*day: true}}
+
+		require.Error(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from, to))
+		// The first request, then the second one and its retries.
+		require.Len(t, srv.requests, 5)
+		progress, err := db.GetBackfillProgress(ctx)
+		require.NoError(t, err)
+		require.Len(t, progress, 1)
+		require.Equal(t, from+90*day-1, progress[0].DoneUntil)
+
+		srv = &geckoRangeServer{}
+		require.NoError(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from, to))
+		require.Len(t, srv.requests, 2)
+		history, err := db.GetPriceHistory(ctx, "ATOMUSDT", 0, 2*to)
+		require.NoError(t, err)
+		require.Len(t, history, 200)
+	})
+
+	t.Run("resumes with another range", func(t *testing.T) {
+		h, db := newMemoryHandler(t)
+		srv := &geckoRangeServer{failFrom: map[int64]bool{from + 90*day: true}}
+		require.Error(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from, to))
+
+		// Started again later, e.g. with a default range ending now.
+		srv = &geckoRangeServer{}
+		require.NoError(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from+10*day, to+10*day))
+		require.Equal(t, []string{
+			"/api/v3/coins/cosmos/market_chart/range?from=94176000&to=101951999&vs_currency=usd",
+			"/api/v3/coins/cosmos/market_chart/range?from=101952000&to=104543999&vs_currency=usd",
+		}, srv.requests)
+		progress, err := db.GetBackfillProgress(ctx)
+		require.NoError(t, err)
+		require.Len(t, progress, 2)
+		require.Equal(t, to+10*day, progress[1].DoneUntil)
+
+		// Both ranges are covered.
+		srv.requests = nil
+		require.NoError(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from, to+10*day))
+		require.Empty(t, srv.requests)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		h, _ := newMemoryHandler(t)
+		srv := &geckoRangeServer{}
+		require.Error(t, h.Backfill(ctx, srv.client(), []string{"ATOM", "NOPE"}, from, to))
+		require.Empty(t, srv.requests)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		h, _ := newMemoryHandler(t)
+		h.Cfg.BackfillRequestInterval = time.Hour
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		srv := &geckoRangeServer{onRequest: cancel}
+		// Cancelled during the first request, the second waits for the interval.
+		require.ErrorIs(t, h.Backfill(ctx, srv.client(), []string{"ATOM"}, from, to), context.Canceled)
+		require.Len(t, srv.requests, 1)
+	})
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CacheBackend is a cache shared by the replicas of the oracle, e.g. Redis.
+// When the handler has one, the spot prices and the chart data loaded by a
+// replica are written to it, and the other replicas read them from it rather
+// than from the DB and Coingecko. The in-memory caches of the handler stay in
+// front of it.
+type CacheBackend interface {
+	// GetMany returns the cached values of keys. Keys that are not cached are
+	// left out.
+	GetMany(ctx context.Context, keys []string) (map[string][]byte, error)
+	// SetMany caches values, by key, for ttl.
+	SetMany(ctx context.Context, values map[string][]byte, ttl time.Duration) error
+	// DeleteMany removes keys from the cache.
+	DeleteMany(ctx context.Context, keys []string) error
+}
+
+// WithCacheBackend shares the caches of the handler through backend. The
+// caches are only in memory when no backend is set.
+func WithCacheBackend(backend CacheBackend) func(*Handler) error {
+	return func(handler *Handler) error {
+		handler.CacheBackend = backend
+		return nil
+	}
+}
+
+// Key prefixes of the values in the cache backend.
+const (
+	tokenCacheKeyPrefix = "spot:token:"
+	fiatCacheKeyPrefix  = "spot:fiat:"
+	chartCacheKeyPrefix = "chart:"
+)
+
+// sharedLoad returns a loadFunc reading the values from the cache backend,
+// and calling load for the keys it does not have, which are then cached for
+// ttl. The cache backend is only an optimisation: when it fails, the error is
+// logged and load is called.
+func sharedLoad[V any](h *Handler, prefix string, ttl time.Duration, load loadFunc[V]) loadFunc[V] {
+	if h.CacheBackend == nil {
+		return load
+	}
+	return func(ctx context.Context, keys []string) (map[string]V, error) {
+		values := make(map[string]V, len(keys))
+		missing := keys
+		shared := h.sharedGet(ctx, prefix, keys)
+		if len(shared) > 0 {
+			missing = make([]string, 0, len(keys)-len(shared))
+			for _, key := range keys {
+				var v V
+				if raw, ok := shared[key]; ok && json.Unmarshal(raw, &v) == nil {
+					values[key] = v
+					continue
+				}
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) == 0 {
+			return values, nil
+		}
+
+		loaded, err := load(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		sharedSet(ctx, h, prefix, loaded, ttl)
+		for key, v := range loaded {
+			values[key] = v
+		}
+		return values, nil
+	}
+}
+
+// sharedGet returns the values of keys from the cache backend, by key
+// without prefix.
+func (h *Handler) sharedGet(ctx context.Context, prefix string, keys []string) map[string][]byte {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = prefix + key
+	}
+	raw, err := h.CacheBackend.GetMany(ctx, prefixed)
+	if err != nil {
+		h.Logger.Warnw("CacheBackend.GetMany()", "prefix", prefix, "error", err)
+		return nil
+	}
+	values := make(map[string][]byte, len(raw))
+	for key, v := range raw {
+		values[key[len(prefix):]] = v
+	}
+	return values
+}
+
+// sharedSet caches values, by key without prefix, in the cache backend for
+// ttl.
+func sharedSet[V any](ctx context.Context, h *Handler, prefix string, values map[string]V, ttl time.Duration) {
+	if len(values) == 0 {
+		return
+	}
+	raw := make(map[string][]byte, len(values))
+	for key, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			h.Logger.Warnw("marshal shared cache value", "key", prefix+key, "error", err)
+			continue
+		}
+		raw[prefix+key] = b
+	}
+	if err := h.CacheBackend.SetMany(ctx, raw, ttl); err != nil {
+		h.Logger.Warnw("CacheBackend.SetMany()", "prefix", prefix, "error", err)
+	}
+}
+
+// sharedUpdate caches the updated spot prices, by symbol, in the cache
+// backend, and removes the other symbols from it.
+func sharedUpdate[V any](ctx context.Context, h *Handler, prefix string, symbols []string, updated map[string]V) {
+	if h.CacheBackend == nil {
+		return
+	}
+	sharedSet(ctx, h, prefix, updated, h.SpotCache.RefreshInterval)
+	var removed []string
+	for _, symbol := range symbols {
+		if _, ok := updated[symbol]; !ok {
+			removed = append(removed, prefix+symbol)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	if err := h.CacheBackend.DeleteMany(ctx, removed); err != nil {
+		h.Logger.Warnw("CacheBackend.DeleteMany()", "prefix", prefix, "error", err)
+	}
+}
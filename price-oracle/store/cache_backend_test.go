@@ -0,0 +1,123 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+	gecko "github.com/superoo7/go-gecko/v3"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/rediscache"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+// newReplica returns a handler sharing its caches through the Redis server
+// at addr, in front of a DB where ATOMUSDT and USDEUR are worth price.
+func newReplica(t *testing.T, addr string, price float64) *store.Handler {
+	t.Helper()
+	backend, err := rediscache.NewFromURL("redis://" + addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = backend.Close() })
+
+	h, db := newMemoryHandler(t, store.WithChartDataCache(nil, 0), store.WithCacheBackend(backend))
+	ctx := context.Background()
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, price, "ATOMUSDT"))
+	require.NoError(t, db.UpsertPrice(ctx, store.FiatsStore, price, "USDEUR"))
+	return h
+}
+
+func TestCacheBackend_SpotPrices(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	// The DB of the second replica lags behind.
+	first := newReplica(t, mr.Addr(), 10)
+	second := newReplica(t, mr.Addr(), 9)
+
+	tokens, err := first.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 10.0, tokens[0].Price)
+	fiats, err := first.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Equal(t, 10.0, fiats[0].Price)
+
+	// Both replicas serve the same prices.
+	tokens, err = second.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 10.0, tokens[0].Price)
+	fiats, err = second.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Equal(t, 10.0, fiats[0].Price)
+
+	// Until the shared prices expire.
+	mr.FastForward(time.Minute)
+	third := newReplica(t, mr.Addr(), 9)
+	tokens, err = third.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 9.0, tokens[0].Price)
+}
+
+func TestCacheBackend_ChartData(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	data := generateChartData(2, float32(time.Now().Unix()), 0)
+	var calls int32
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		atomic.AddInt32(&calls, 1)
+		return chartResponse(t, data)
+	}, time.Second))
+
+	for _, h := range []*store.Handler{newReplica(t, mr.Addr(), 10), newReplica(t, mr.Addr(), 10)} {
+		got, err := h.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+	// Only the first replica asked Coingecko.
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestCacheBackend_ChartDataExpiry(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		return chartResponse(t, generateChartData(2, float32(time.Now().Unix()), 0))
+	}, time.Second))
+	first, second := newReplica(t, mr.Addr(), 10), newReplica(t, mr.Addr(), 10)
+	_, err := first.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.NoError(t, err)
+
+	// The shared chart is about to expire.
+	keys := mr.Keys()
+	require.Len(t, keys, 1)
+	raw, err := mr.Get(keys[0])
+	require.NoError(t, err)
+	var chart map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(raw), &chart))
+	chart["expires_at"] = json.RawMessage(strconv.FormatInt(time.Now().Add(time.Second).UnixMilli(), 10))
+	b, err := json.Marshal(chart)
+	require.NoError(t, err)
+	require.NoError(t, mr.Set(keys[0], string(b)))
+
+	// So is the copy of the replica reading it.
+	_, err = second.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.NoError(t, err)
+	require.Equal(t, 1, second.PrefetchCharts(ctx, 10, time.Minute, geckoClient))
+	require.Zero(t, first.PrefetchCharts(ctx, 10, time.Minute, geckoClient))
+}
+
+func TestCacheBackend_Down(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	h := newReplica(t, mr.Addr(), 10)
+	mr.Close()
+
+	// Prices are still served from the DB.
+	tokens, err := h.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 10.0, tokens[0].Price)
+}
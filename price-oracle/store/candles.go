@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// ErrUnknownFiatRate is returned when a price is requested in a currency we
+// have no rate for.
+var ErrUnknownFiatRate = errors.New("no rate known for the requested currency")
+
+// GetCandles returns the OHLC candles of (param:<token>), a ticker like ATOM,
+// between from and to (unix seconds, both inclusive). Every candle covers
+// (param:<interval>), periods without any sample in the local price history
+// have no candle.
+//
+// The history is USD denominated, candles in any other currency are converted
+// with the latest rate we have in oracle.fiats.
+//
+// The history records the rolling 24 hours volume given by Coingecko, not the
+// volume traded in between two samples. So the volume of a candle is estimated
+// from the mean 24 hours volume over its period, scaled down to the interval.
+func (h *Handler) GetCandles(
+	ctx context.Context,
+	token string,
+	interval time.Duration,
+	from int64,
+	to int64,
+	currency string,
+) ([]types.Candle, error) {
+	if interval < HistoryResolution {
+		return nil, fmt.Errorf("interval %s shorter than history resolution %s", interval, HistoryResolution)
+	}
+
+	rate, ok, err := h.usdRate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFiatRate, currency)
+	}
+
+	history, err := h.Store.GetPriceHistory(ctx, strings.ToUpper(token)+types.USDT, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return buildCandles(history, interval, rate), nil
+}
+
+// buildCandles groups the history in (param:<interval>) long candles. All the
+// values are multiplied by (param:<rate>). The history must be in ascending
+// order of time.
+func buildCandles(history []types.HistoricalPrice, interval time.Duration, rate float64) []types.Candle {
+	intervalSec := int64(interval.Seconds())
+	volumeScale := interval.Hours() / 24
+
+	var (
+		candles       []types.Candle
+		volumeSum     float64
+		volumeSamples int
+	)
+	closeVolume := func() {
+		if volumeSamples > 0 {
+			candles[len(candles)-1].Volume = volumeSum / float64(volumeSamples) * volumeScale * rate
+		}
+		volumeSum, volumeSamples = 0, 0
+	}
+
+	for _, sample := range history {
+		price := sample.Price * rate
+		start := sample.UpdatedAt - sample.UpdatedAt%intervalSec
+		if n := len(candles); n == 0 || candles[n-1].Time != start {
+			if n > 0 {
+				closeVolume()
+			}
+			candles = append(candles, types.Candle{
+				Time:  start,
+				Open:  price,
+				High:  price,
+				Low:   price,
+				Close: price,
+			})
+		} else {
+			c := &candles[n-1]
+			if price > c.High {
+				c.High = price
+			}
+			if price < c.Low {
+				c.Low = price
+			}
+			c.Close = price
+		}
+		// Aggregated prices have no volume, only Coingecko samples have one.
+		if sample.Volume > 0 {
+			volumeSum += sample.Volume
+			volumeSamples++
+		}
+	}
+	if len(candles) > 0 {
+		closeVolume()
+	}
+	return candles
+}
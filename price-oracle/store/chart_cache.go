@@ -0,0 +1,342 @@
+package store
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultChartCacheMaxBytes is the default ChartDataCache.MaxBytes.
+const DefaultChartCacheMaxBytes = 256 << 20
+
+// chartErrorTTL is the default ChartDataCache.ErrorTTL.
+const chartErrorTTL = 10 * time.Second
+
+// chartFetchTimeout bounds a chart fetch. Fetches are shared by concurrent
+// requests, so they do not use the context of any of them.
+const chartFetchTimeout = time.Minute
+
+// maxChartRequests bounds the number of charts whose requests are counted to
+// pick the ones to prefetch.
+const maxChartRequests = 10000
+
+// chartEntryOverhead estimates the bytes used by a cache entry besides its
+// chart items: list element, map entry and chart struct.
+const chartEntryOverhead = 256
+
+// defaultChartTTLs are the default ChartDataCache.TTLs. Coingecko has a new
+// data point every 5 minutes for 1 day charts, every hour up to 90 days and
+// every day beyond.
+var defaultChartTTLs = map[string]time.Duration{
+	GranularityMinute: 5 * time.Minute,
+	GranularityHour:   time.Hour,
+	GranularityDay:    24 * time.Hour,
+}
+
+// ChartDataCache is an in-memory cache of the charts served by GetChartData,
+// keyed by granularity and coinId-currency, e.g. [5M][cosmos-usd].
+//
+// A chart is cached for the TTL of its granularity. The size of a chart is
+// estimated from its number of items, and the least recently used charts are
+// evicted when the cache is above MaxBytes. The zero value is an empty cache
+// with the default settings.
+//
+// A chart is fetched once however many requests miss it at the same time,
+// and a failed fetch is remembered for ErrorTTL so that requests for a
+// failing chart do not all hit Coingecko.
+type ChartDataCache struct {
+	// MaxBytes is the estimated size the cached charts can use,
+	// DefaultChartCacheMaxBytes when zero.
+	MaxBytes int64
+	// TTLs is how long a chart is cached per granularity, the default TTL of
+	// the granularity when missing.
+	TTLs map[string]time.Duration
+	// ErrorTTL is how long a failed fetch is remembered, chartErrorTTL when
+	// zero.
+	ErrorTTL time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       list.List // Of *chartEntry, the most recently used first.
+	bytes     int64
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	requests  map[string]*chartRequest
+
+	failures map[string]chartFailure
+	// failuresPrunedAt is when the expired failures were last removed.
+	failuresPrunedAt time.Time
+
+	fetches singleflight.Group
+}
+
+type chartEntry struct {
+	key       string
+	data      *geckoTypes.CoinsIDMarketChart
+	bytes     int64
+	expiresAt time.Time
+}
+
+// sharedChart is a chart in the cache backend. ExpiresAt, in unix
+// milliseconds, is when it expires there, so that the replicas reading it
+// cache it until then rather than for a full TTL.
+type sharedChart struct {
+	Data      *geckoTypes.CoinsIDMarketChart `json:"data"`
+	ExpiresAt int64                          `json:"expires_at"`
+}
+
+// chartFailure is a failed chart fetch, returned until expiresAt.
+type chartFailure struct {
+	err       error
+	expiresAt time.Time
+}
+
+// chartRequest is a chart asked to GetChartData, and how many times it was
+// asked since the counts last decayed.
+type chartRequest struct {
+	coinId      string
+	currency    string
+	granularity string
+	fetchDays   string
+	count       uint64
+}
+
+func (r chartRequest) coinIDCurrency() string {
+	return r.coinId + "-" + r.currency
+}
+
+func (r chartRequest) key() string {
+	return chartCacheKey(r.granularity, r.coinIDCurrency())
+}
+
+// ChartCacheStats are the counters of a ChartDataCache.
+type ChartCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+}
+
+func chartCacheKey(granularity, coinIDCurrency string) string {
+	return granularity + "/" + coinIDCurrency
+}
+
+// Get returns the cached chart of coinIDCurrency, e.g. cosmos-usd, at the
+// given granularity.
+func (c *ChartDataCache) Get(granularity, coinIDCurrency string) (*geckoTypes.CoinsIDMarketChart, bool) {
+	key := chartCacheKey(granularity, coinIDCurrency)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if ok && time.Now().After(elem.Value.(*chartEntry).expiresAt) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*chartEntry).data, true
+}
+
+// Set caches the chart of coinIDCurrency, e.g. cosmos-usd, at the given
+// granularity, evicting the least recently used charts if needed. A chart
+// larger than MaxBytes is not cached.
+func (c *ChartDataCache) Set(granularity, coinIDCurrency string, data *geckoTypes.CoinsIDMarketChart) {
+	c.setUntil(granularity, coinIDCurrency, data, time.Now().Add(c.ttl(granularity)))
+}
+
+// setUntil caches data until expiresAt.
+func (c *ChartDataCache) setUntil(granularity, coinIDCurrency string, data *geckoTypes.CoinsIDMarketChart, expiresAt time.Time) {
+	key := chartCacheKey(granularity, coinIDCurrency)
+	entry := &chartEntry{
+		key:       key,
+		data:      data,
+		bytes:     chartBytes(key, data),
+		expiresAt: expiresAt,
+	}
+	maxBytes := c.maxBytes()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if entry.bytes > maxBytes {
+		return
+	}
+	for c.bytes+entry.bytes > maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.bytes
+}
+
+// Stats returns the counters of the cache.
+func (c *ChartDataCache) Stats() ChartCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ChartCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   c.lru.Len(),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes(),
+	}
+}
+
+// expiresIn returns how long the cached chart of coinIDCurrency at the given
+// granularity is still fresh, or false if it is not cached.
+func (c *ChartDataCache) expiresIn(granularity, coinIDCurrency string) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[chartCacheKey(granularity, coinIDCurrency)]
+	if !ok {
+		return 0, false
+	}
+	return time.Until(elem.Value.(*chartEntry).expiresAt), true
+}
+
+// recordRequest counts a request of the chart of req. When maxChartRequests
+// charts are counted already, the counts decay first to make room.
+func (c *ChartDataCache) recordRequest(req chartRequest) {
+	key := req.key()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.requests[key]; ok {
+		r.count++
+		return
+	}
+	if c.requests == nil {
+		c.requests = map[string]*chartRequest{}
+	}
+	if len(c.requests) >= maxChartRequests {
+		c.decayRequests()
+		if len(c.requests) >= maxChartRequests {
+			return
+		}
+	}
+	req.count = 1
+	c.requests[key] = &req
+}
+
+// mostRequested returns the n most requested charts, the most requested
+// first, then decays the request counts.
+func (c *ChartDataCache) mostRequested(n int) []chartRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	requests := make([]chartRequest, 0, len(c.requests))
+	for _, r := range c.requests {
+		requests = append(requests, *r)
+	}
+	c.decayRequests()
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].count != requests[j].count {
+			return requests[i].count > requests[j].count
+		}
+		return requests[i].key() < requests[j].key()
+	})
+	if len(requests) > n {
+		requests = requests[:n]
+	}
+	return requests
+}
+
+// decayRequests halves the request counts so that they reflect the recent
+// requests. Charts no longer requested are forgotten. c.mu must be held.
+func (c *ChartDataCache) decayRequests() {
+	for key, r := range c.requests {
+		r.count /= 2
+		if r.count == 0 {
+			delete(c.requests, key)
+		}
+	}
+}
+
+// failure returns the error of the last fetch of key if it failed less than
+// ErrorTTL ago.
+func (c *ChartDataCache) failure(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.failures[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(f.expiresAt) {
+		delete(c.failures, key)
+		return nil
+	}
+	return f.err
+}
+
+// setFailure remembers that the fetch of key failed with err. The expired
+// failures are removed at most once per ErrorTTL, so that the failures of
+// charts that are not asked for again do not pile up.
+func (c *ChartDataCache) setFailure(key string, err error) {
+	errorTTL := c.ErrorTTL
+	if errorTTL == 0 {
+		errorTTL = chartErrorTTL
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures == nil {
+		c.failures = map[string]chartFailure{}
+	}
+	if now.Sub(c.failuresPrunedAt) >= errorTTL {
+		for k, f := range c.failures {
+			if now.After(f.expiresAt) {
+				delete(c.failures, k)
+			}
+		}
+		c.failuresPrunedAt = now
+	}
+	c.failures[key] = chartFailure{err: err, expiresAt: now.Add(errorTTL)}
+}
+
+// remove removes elem from the cache, c.mu must be held.
+func (c *ChartDataCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*chartEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.bytes
+}
+
+func (c *ChartDataCache) ttl(granularity string) time.Duration {
+	if ttl, ok := c.TTLs[granularity]; ok {
+		return ttl
+	}
+	return defaultChartTTLs[granularity]
+}
+
+func (c *ChartDataCache) maxBytes() int64 {
+	if c.MaxBytes == 0 {
+		return DefaultChartCacheMaxBytes
+	}
+	return c.MaxBytes
+}
+
+// chartBytes estimates the memory used by the cache entry of data.
+func chartBytes(key string, data *geckoTypes.CoinsIDMarketChart) int64 {
+	const itemBytes = 8 // geckoTypes.ChartItem is a [2]float32.
+	n := chartEntryOverhead + len(key)
+	for _, items := range []*[]geckoTypes.ChartItem{data.Prices, data.MarketCaps, data.TotalVolumes} {
+		if items != nil {
+			n += cap(*items) * itemBytes
+		}
+	}
+	return int64(n)
+}
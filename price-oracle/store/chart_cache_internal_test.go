@@ -0,0 +1,25 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChartDataCache_PrunesFailures(t *testing.T) {
+	c := &ChartDataCache{ErrorTTL: 50 * time.Millisecond}
+	errFetch := errors.New("not found")
+	for i := 0; i < 10; i++ {
+		c.setFailure("unknown-"+strconv.Itoa(i), errFetch)
+	}
+	require.ErrorIs(t, c.failure("unknown-0"), errFetch)
+
+	// Expired failures are removed even if never asked for again.
+	time.Sleep(60 * time.Millisecond)
+	c.setFailure("other", errFetch)
+	require.Len(t, c.failures, 1)
+	require.ErrorIs(t, c.failure("other"), errFetch)
+}
@@ -0,0 +1,192 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+	"github.com/stretchr/testify/require"
+	gecko "github.com/superoo7/go-gecko/v3"
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+)
+
+func newChartCacheHandler(t *testing.T) *store.Handler {
+	t.Helper()
+	h, _ := newMemoryHandler(t, store.WithChartDataCache(&store.ChartDataCache{ErrorTTL: 100 * time.Millisecond}, 0))
+	return h
+}
+
+func chartResponse(t *testing.T, data *geckoTypes.CoinsIDMarketChart) *http.Response {
+	b, err := json.Marshal(data)
+	require.NoError(t, err)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(b)),
+	}
+}
+
+func TestGetChartData_CoalescesMisses(t *testing.T) {
+	h := newChartCacheHandler(t)
+	data := generateChartData(2, float32(time.Now().Unix()), 0)
+	var calls int32
+	release := make(chan struct{})
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return chartResponse(t, data)
+	}, 10*time.Second))
+
+	const requests = 10
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := h.GetChartData(context.Background(), "bitcoin", "1", "usd", geckoClient)
+			require.NoError(t, err)
+			require.Equal(t, data, got)
+		}()
+	}
+	// Let the requests pile up on the first fetch.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestGetChartData_CachesErrors(t *testing.T) {
+	h := newChartCacheHandler(t)
+	data := generateChartData(2, float32(time.Now().Unix()), 0)
+	var calls, failing int32 = 0, 1
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"error":"rate limited"}`)),
+			}
+		}
+		return chartResponse(t, data)
+	}, time.Second))
+	ctx := context.Background()
+
+	_, err := h.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.Error(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	// The error is returned without asking Coingecko again.
+	atomic.StoreInt32(&failing, 0)
+	_, err2 := h.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.Equal(t, err, err2)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	// Other charts are not affected.
+	_, err = h.GetChartData(ctx, "bitcoin", "max", "usd", geckoClient)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// Until the error expires.
+	time.Sleep(150 * time.Millisecond)
+	got, err := h.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestGetChartData_SlowFetchDoesNotBlock(t *testing.T) {
+	h := newChartCacheHandler(t)
+	data := generateChartData(2, float32(time.Now().Unix()), 0)
+	release := make(chan struct{})
+	defer close(release)
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		if strings.Contains(req.URL.Path, "bitcoin") {
+			<-release
+		}
+		return chartResponse(t, data)
+	}, 10*time.Second))
+
+	// A request gives up on a slow fetch when its context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := h.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Other charts are served meanwhile.
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.GetChartData(context.Background(), "cosmos", "1", "usd", geckoClient)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("blocked by the bitcoin fetch")
+	}
+}
+
+func chartOfSize(n int) *geckoTypes.CoinsIDMarketChart {
+	return generateChartData(n, 0, 0)
+}
+
+func TestChartDataCache(t *testing.T) {
+	// Room for 2 charts of 100 items.
+	c := &store.ChartDataCache{MaxBytes: 2*3*100*8 + 2*300}
+
+	_, ok := c.Get(store.GranularityDay, "bitcoin-usd")
+	require.False(t, ok)
+
+	bitcoin, cosmos, osmosis := chartOfSize(100), chartOfSize(100), chartOfSize(100)
+	c.Set(store.GranularityDay, "bitcoin-usd", bitcoin)
+	c.Set(store.GranularityDay, "cosmos-usd", cosmos)
+	got, ok := c.Get(store.GranularityDay, "bitcoin-usd")
+	require.True(t, ok)
+	require.Equal(t, bitcoin, got)
+
+	// cosmos is the least recently used.
+	c.Set(store.GranularityDay, "osmosis-usd", osmosis)
+	_, ok = c.Get(store.GranularityDay, "cosmos-usd")
+	require.False(t, ok)
+	_, ok = c.Get(store.GranularityDay, "bitcoin-usd")
+	require.True(t, ok)
+	_, ok = c.Get(store.GranularityDay, "osmosis-usd")
+	require.True(t, ok)
+
+	// Too large to be cached.
+	c.Set(store.GranularityDay, "bitcoin-eur", chartOfSize(1000))
+	_, ok = c.Get(store.GranularityDay, "bitcoin-eur")
+	require.False(t, ok)
+
+	stats := c.Stats()
+	require.Equal(t, store.ChartCacheStats{
+		Hits:      3,
+		Misses:    3,
+		Evictions: 1,
+		Entries:   2,
+		Bytes:     stats.Bytes,
+		MaxBytes:  c.MaxBytes,
+	}, stats)
+	require.LessOrEqual(t, stats.Bytes, c.MaxBytes)
+}
+
+func TestChartDataCache_TTLs(t *testing.T) {
+	c := &store.ChartDataCache{TTLs: map[string]time.Duration{store.GranularityMinute: 50 * time.Millisecond}}
+	data := chartOfSize(10)
+	c.Set(store.GranularityMinute, "bitcoin-usd", data)
+	c.Set(store.GranularityHour, "bitcoin-usd", data)
+
+	time.Sleep(100 * time.Millisecond)
+	_, ok := c.Get(store.GranularityMinute, "bitcoin-usd")
+	require.False(t, ok)
+	_, ok = c.Get(store.GranularityHour, "bitcoin-usd")
+	require.True(t, ok)
+	require.Equal(t, 1, c.Stats().Entries)
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// PriceChange tells that the aggregated prices changed in Table, TokensStore
+// or FiatsStore. Prices is the new price of each changed symbol.
+type PriceChange struct {
+	Table  string
+	Prices map[string]float64
+}
+
+// knownPrices is the last published price of every symbol, by table.
+type knownPrices struct {
+	mu     sync.Mutex
+	prices map[string]map[string]float64
+}
+
+// changed returns the prices of table that differ from the known ones.
+func (k *knownPrices) changed(table string, prices map[string]float64) map[string]float64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	changed := make(map[string]float64, len(prices))
+	for symbol, price := range prices {
+		if known, ok := k.prices[table][symbol]; !ok || known != price {
+			changed[symbol] = price
+		}
+	}
+	return changed
+}
+
+// record remembers the prices of change.
+func (k *knownPrices) record(change PriceChange) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.prices == nil {
+		k.prices = map[string]map[string]float64{}
+	}
+	if k.prices[change.Table] == nil {
+		k.prices[change.Table] = map[string]float64{}
+	}
+	for symbol, price := range change.Prices {
+		k.prices[change.Table][symbol] = price
+	}
+}
+
+// EventBus delivers the price changes to its subscribers, in process. Changes
+// written by other replicas are published by StartChangePolling.
+type EventBus struct {
+	mu          sync.RWMutex
+	nextID      int
+	subscribers map[int]func(PriceChange)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[int]func(PriceChange){}}
+}
+
+// Subscribe calls fn with every published change until unsubscribe is
+// called. fn is called by the publisher, thus must be quick.
+func (b *EventBus) Subscribe(fn func(PriceChange)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish calls the subscribers with change.
+func (b *EventBus) Publish(change PriceChange) {
+	if len(change.Prices) == 0 {
+		return
+	}
+	b.mu.RLock()
+	subscribers := make([]func(PriceChange), 0, len(b.subscribers))
+	for _, fn := range b.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	b.mu.RUnlock()
+	for _, fn := range subscribers {
+		fn(change)
+	}
+}
+
+// publishPrices publishes the aggregated prices of table that changed since
+// they were last published.
+func (h *Handler) publishPrices(table string, prices map[string]float64) {
+	h.Events.Publish(PriceChange{Table: table, Prices: h.knownPrices.changed(table, prices)})
+}
+
+// cacheUpdateTimeout bounds the update of changed prices in the cache
+// backend.
+const cacheUpdateTimeout = 5 * time.Second
+
+// updatePrices sets the changed prices in the spot cache and the cache
+// backend, rather than reading them again from the DB, which may lag behind
+// with follower reads. Prices that are not in the spot cache are removed from
+// the cache backend.
+func (h *Handler) updatePrices(change PriceChange) {
+	h.knownPrices.record(change)
+	if h.SpotCache == nil {
+		return
+	}
+	symbols := make([]string, 0, len(change.Prices))
+	for symbol := range change.Prices {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	ctx, cancel := context.WithTimeout(context.Background(), cacheUpdateTimeout)
+	defer cancel()
+	switch change.Table {
+	case TokensStore:
+		updated := h.SpotCache.tokenPriceAndSupplies.update(symbols, func(symbol string, token types.TokenPriceAndSupply) types.TokenPriceAndSupply {
+			token.Price = change.Prices[symbol]
+			return token
+		})
+		sharedUpdate(ctx, h, tokenCacheKeyPrefix, symbols, updated)
+	case FiatsStore:
+		updated := h.SpotCache.fiatPrices.update(symbols, func(symbol string, fiat types.FiatPrice) types.FiatPrice {
+			fiat.Price = change.Prices[symbol]
+			return fiat
+		})
+		sharedUpdate(ctx, h, fiatCacheKeyPrefix, symbols, updated)
+	}
+}
+
+// StartChangePolling publishes on Events the changes of the aggregated
+// prices, including the ones written by other replicas, by reading them
+// every Cfg.ChangePollInterval, until ctx is done.
+func StartChangePolling(ctx context.Context, storeHandler *Handler) {
+	interval := storeHandler.Cfg.ChangePollInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// last[table][symbol] is the price of symbol at the previous poll.
+	last := map[string]map[string]float64{}
+	for {
+		for _, table := range []string{TokensStore, FiatsStore} {
+			prices, err := storeHandler.Store.GetPrices(ctx, table)
+			if err != nil {
+				storeHandler.Logger.Errorw("ChangePolling", "GetPrices Err:", err, "table", table)
+				continue
+			}
+			current := make(map[string]float64, len(prices))
+			for _, p := range prices {
+				current[p.Symbol] = p.Price
+			}
+			previous, polled := last[table]
+			last[table] = current
+			if !polled {
+				continue
+			}
+			changed := make(map[string]float64)
+			for symbol, price := range current {
+				if old, ok := previous[symbol]; !ok || old != price {
+					changed[symbol] = price
+				}
+			}
+			storeHandler.Events.Publish(PriceChange{Table: table, Prices: changed})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
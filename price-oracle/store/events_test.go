@@ -0,0 +1,122 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/rediscache"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := store.NewEventBus()
+	var got []store.PriceChange
+	unsubscribe := bus.Subscribe(func(c store.PriceChange) { got = append(got, c) })
+
+	change := store.PriceChange{Table: store.TokensStore, Prices: map[string]float64{"ATOMUSDT": 10}}
+	bus.Publish(change)
+	bus.Publish(store.PriceChange{Table: store.TokensStore})
+	unsubscribe()
+	bus.Publish(change)
+	require.Equal(t, []store.PriceChange{change}, got)
+}
+
+// newEventsHandler returns a memory handler with cfg, whose cached prices are
+// fresh for a minute.
+func newEventsHandler(t *testing.T, cfg *config.Config, options ...func(*store.Handler) error) (*store.Handler, *memory.DB) {
+	t.Helper()
+	return newMemoryHandler(t, append([]func(*store.Handler) error{
+		store.WithConfig(cfg),
+		store.WithSpotPriceCache(&store.TokenAndFiatCache{RefreshInterval: time.Minute}),
+	}, options...)...)
+}
+
+func tokenPrice(t *testing.T, h *store.Handler, symbol string) float64 {
+	t.Helper()
+	tokens, err := h.GetTokenPriceAndSupplies(context.Background(), []string{symbol})
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	return tokens[0].Price
+}
+
+func TestAggregatorUpdatesPrices(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	backend, err := rediscache.NewFromURL("redis://" + mr.Addr())
+	require.NoError(t, err)
+	h, db := newEventsHandler(t, &config.Config{WhitelistedFiats: []string{"EUR"}}, store.WithCacheBackend(backend))
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+	require.NoError(t, db.UpsertPrice(ctx, store.FiatsStore, 0.9, "USDEUR"))
+	var changes []store.PriceChange
+	h.Events.Subscribe(func(c store.PriceChange) { changes = append(changes, c) })
+
+	require.Equal(t, 10.0, tokenPrice(t, h, "ATOMUSDT"))
+	fiats, err := h.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Equal(t, 0.9, fiats[0].Price)
+
+	now := time.Now().Unix()
+	require.NoError(t, db.UpsertToken(ctx, store.BinanceStore, "ATOMUSDT", 12, now))
+	require.NoError(t, db.UpsertToken(ctx, store.FixerStore, "USDEUR", 0.8, now))
+	require.NoError(t, h.PriceTokenAggregator(ctx))
+	require.NoError(t, h.PriceFiatAggregator(ctx))
+	require.Equal(t, []store.PriceChange{
+		{Table: store.TokensStore, Prices: map[string]float64{"ATOMUSDT": 12}},
+		{Table: store.FiatsStore, Prices: map[string]float64{"USDEUR": 0.8}},
+	}, changes)
+
+	// The caches are updated in place, not read again from a DB that may lag
+	// behind.
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+	require.Equal(t, 12.0, tokenPrice(t, h, "ATOMUSDT"))
+	fiats, err = h.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Equal(t, 0.8, fiats[0].Price)
+	replica, _ := newEventsHandler(t, &config.Config{}, store.WithCacheBackend(backend))
+	require.Equal(t, 12.0, tokenPrice(t, replica, "ATOMUSDT"))
+
+	// Unchanged prices are not published again.
+	require.NoError(t, h.PriceTokenAggregator(ctx))
+	require.NoError(t, h.PriceFiatAggregator(ctx))
+	require.Len(t, changes, 2)
+}
+
+func TestStartChangePolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h, db := newEventsHandler(t, &config.Config{ChangePollInterval: 10 * time.Millisecond})
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 1, "OSMOUSDT"))
+
+	changes := make(chan store.PriceChange, 10)
+	h.Events.Subscribe(func(c store.PriceChange) { changes <- c })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		store.StartChangePolling(ctx, h)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Equal(t, 10.0, tokenPrice(t, h, "ATOMUSDT"))
+	require.Equal(t, 1.0, tokenPrice(t, h, "OSMOUSDT"))
+
+	// Written by another replica.
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 11, "ATOMUSDT"))
+	select {
+	case c := <-changes:
+		require.Equal(t, store.PriceChange{Table: store.TokensStore, Prices: map[string]float64{"ATOMUSDT": 11}}, c)
+	case <-time.After(time.Second):
+		t.Fatal("change not published")
+	}
+	require.Equal(t, 11.0, tokenPrice(t, h, "ATOMUSDT"))
+	require.Equal(t, 1.0, tokenPrice(t, h, "OSMOUSDT"))
+}
@@ -0,0 +1,373 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gecko "github.com/superoo7/go-gecko/v3"
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// HistoryResolution is the resolution of the price history written by the
+// aggregators, for both tokens (ATOMUSDT) and fiats (USDEUR). Aggregated
+// prices are recorded at most once per HistoryResolution and symbol, the
+// latest price of a period wins.
+const HistoryResolution = 5 * time.Minute
+
+// maxRangeDays is the longest fixed range served by /chart/:id. Local history
+// going further back than that is considered complete for "max" requests.
+const maxRangeDays = 365
+
+// granularitySteps maps a chart granularity to the duration between two
+// samples of a chart series.
+var granularitySteps = map[string]time.Duration{
+	GranularityMinute: 5 * time.Minute,
+	GranularityHour:   time.Hour,
+	GranularityDay:    24 * time.Hour,
+}
+
+// timeRange is a closed interval of unix timestamps in seconds.
+type timeRange struct {
+	from, to int64
+}
+
+func (r timeRange) contains(ts int64) bool {
+	return ts >= r.from && ts <= r.to
+}
+
+// historyChartData builds the chart series of coinId for the last fetchDays
+// days from the local price history. The ranges not covered by the history
+// are fetched from Coingecko, and written back in the history, so the next
+// request can be served locally.
+//
+// Local history is USD denominated. For any other currency the history is
+// converted with the latest fiat rate we have, and Coingecko data is not
+// written back since it is denominated in that currency.
+//
+// When nothing is known locally about the coin (no CNS price_id, no fiat
+// rate, no sample in the range) the Coingecko response is returned as is.
+func (h *Handler) historyChartData(
+	ctx context.Context,
+	coinId string,
+	fetchDays string,
+	granularity string,
+	currency string,
+	geckoClient *gecko.Client,
+) (*geckoTypes.CoinsIDMarketChart, error) {
+	fetchFromGecko := func() (*geckoTypes.CoinsIDMarketChart, error) {
+		return geckoClient.CoinsIDMarketChart(coinId, currency, fetchDays)
+	}
+
+	pidToTicker, err := h.GetCNSPriceIdsToTicker(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ticker := pidToTicker[strings.ToLower(coinId)]
+	if ticker == "" {
+		return fetchFromGecko()
+	}
+	symbol := strings.ToUpper(ticker) + types.USDT
+
+	isUSD := strings.EqualFold(currency, types.USD)
+	rate, ok, err := h.usdRate(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return fetchFromGecko()
+	}
+
+	step := granularitySteps[granularity]
+	now := time.Now().Unix()
+	from := int64(0)
+	if fetchDays != "max" {
+		days, err := daysToDuration(fetchDays)
+		if err != nil {
+			return nil, err
+		}
+		from = now - int64(days.Seconds())
+	}
+
+	history, err := h.Store.GetPriceHistory(ctx, symbol, from, now)
+	if err != nil {
+		return nil, err
+	}
+	history = downsample(history, step)
+
+	if fetchDays == "max" && len(history) > 0 {
+		// We can not know when a coin started trading, but if the history goes
+		// further back than any fixed range we consider it complete.
+		if history[0].UpdatedAt <= now-int64((maxRangeDays*24*time.Hour).Seconds()) {
+			from = history[0].UpdatedAt
+		}
+	}
+
+	missing := missingRanges(history, from, now, step)
+	if len(missing) == 0 {
+		return historyToChartData(history, rate), nil
+	}
+
+	geckoData, err := fetchFromGecko()
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		if isUSD {
+			h.writeBackChartData(ctx, symbol, geckoData)
+		}
+		return geckoData, nil
+	}
+
+	fill := filterChartData(geckoData, missing)
+	if isUSD {
+		h.writeBackChartData(ctx, symbol, fill)
+	}
+	return mergeChartData(historyToChartData(history, rate), fill), nil
+}
+
+// usdRate returns the latest USD to (param:<currency>) rate we have, false if
+// we don't know any.
+func (h *Handler) usdRate(ctx context.Context, currency string) (float64, bool, error) {
+	if strings.EqualFold(currency, types.USD) {
+		return 1, true, nil
+	}
+	fiatSymbol := types.USD + strings.ToUpper(currency)
+	fiats, err := h.GetFiatPrices(ctx, []string{fiatSymbol})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(fiats) == 0 || fiats[0].Symbol != fiatSymbol || fiats[0].Price == 0 {
+		return 0, false, nil
+	}
+	return fiats[0].Price, true, nil
+}
+
+// writeBackChartData records Coingecko chart data in the price history.
+// Failing to write is not fatal for the caller, thus only logged.
+func (h *Handler) writeBackChartData(ctx context.Context, symbol string, data *geckoTypes.CoinsIDMarketChart) {
+	history := chartDataToHistory(symbol, data)
+	if len(history) == 0 {
+		return
+	}
+	if err := h.Store.UpsertPriceHistory(ctx, history); err != nil {
+		h.Logger.Errorw("writeBackChartData", "symbol", symbol, "error", err)
+	}
+}
+
+// addMarketCaps sets the market cap of the token history samples from their
+// supply, so charts served from the history have them too. Samples of tokens
+// without known supply are left as is. Failing to read the supplies is not
+// fatal, thus only logged.
+func (h *Handler) addMarketCaps(ctx context.Context, history []types.HistoricalPrice) {
+	if len(history) == 0 {
+		return
+	}
+	symbols := make([]string, 0, len(history))
+	for _, p := range history {
+		symbols = append(symbols, p.Symbol)
+	}
+	supplies, err := h.Store.GetTokenPriceAndSupplies(ctx, symbols)
+	if err != nil {
+		h.Logger.Errorw("addMarketCaps", "GetTokenPriceAndSupplies Err:", err)
+		return
+	}
+	bySymbol := make(map[string]float64, len(supplies))
+	for _, s := range supplies {
+		if s.Supply != nil {
+			bySymbol[s.Symbol] = *s.Supply
+		}
+	}
+	for i, p := range history {
+		if supply, ok := bySymbol[p.Symbol]; ok {
+			history[i].MarketCap = p.Price * supply
+		}
+	}
+}
+
+// addMarketData sets the market cap and the volume of the token history
+// samples from the latest Coingecko market data, so charts served from the
+// history have them too. Samples of tokens without market data are left as is.
+// Failing to read the market data is not fatal, thus only logged.
+func (h *Handler) addMarketData(ctx context.Context, history []types.HistoricalPrice) {
+	if len(history) == 0 {
+		return
+	}
+	symbols := make([]string, 0, len(history))
+	for _, p := range history {
+		symbols = append(symbols, p.Symbol)
+	}
+	markets, err := h.Store.GetMarkets(ctx, symbols)
+	if err != nil {
+		h.Logger.Errorw("addMarketData", "GetMarkets Err:", err)
+		return
+	}
+	bySymbol := make(map[string]types.TokenMarket, len(markets))
+	for _, m := range markets {
+		bySymbol[m.Symbol] = m
+	}
+	for i, p := range history {
+		if market, ok := bySymbol[p.Symbol]; ok {
+			history[i].MarketCap = market.MarketCap
+			history[i].Volume = market.Volume24h
+		}
+	}
+}
+
+// daysToDuration converts a Coingecko "days" parameter to a duration.
+func daysToDuration(days string) (time.Duration, error) {
+	n, err := strconv.Atoi(days)
+	if err != nil {
+		return 0, fmt.Errorf("invalid days %q: %w", days, err)
+	}
+	return time.Duration(n) * 24 * time.Hour, nil
+}
+
+// downsample keeps the latest sample of every (param:<step>) long period.
+// The history must be in ascending order of time.
+func downsample(history []types.HistoricalPrice, step time.Duration) []types.HistoricalPrice {
+	stepSec := int64(step.Seconds())
+	ret := make([]types.HistoricalPrice, 0, len(history))
+	for _, sample := range history {
+		if n := len(ret); n > 0 && ret[n-1].UpdatedAt/stepSec == sample.UpdatedAt/stepSec {
+			ret[n-1] = sample
+			continue
+		}
+		ret = append(ret, sample)
+	}
+	return ret
+}
+
+// missingRanges returns the parts of [from, to] the history does not cover.
+// Two consecutive samples more than 3 steps apart leave a gap between them.
+// The tolerance absorbs the downsampling and the precision loss of Coingecko
+// timestamps, which are float32 milliseconds, about 2 minutes nowadays.
+func missingRanges(history []types.HistoricalPrice, from int64, to int64, step time.Duration) []timeRange {
+	maxGap := int64((3 * step).Seconds())
+	if len(history) == 0 {
+		return []timeRange{{from: from, to: to}}
+	}
+
+	var ret []timeRange
+	if history[0].UpdatedAt-from > maxGap {
+		ret = append(ret, timeRange{from: from, to: history[0].UpdatedAt - 1})
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].UpdatedAt-history[i-1].UpdatedAt > maxGap {
+			ret = append(ret, timeRange{from: history[i-1].UpdatedAt + 1, to: history[i].UpdatedAt - 1})
+		}
+	}
+	if last := history[len(history)-1].UpdatedAt; to-last > maxGap {
+		ret = append(ret, timeRange{from: last + 1, to: to})
+	}
+	return ret
+}
+
+// historyToChartData converts the price history to the Coingecko chart format,
+// multiplying every value by (param:<rate>). Coingecko timestamps are in
+// milliseconds.
+func historyToChartData(history []types.HistoricalPrice, rate float64) *geckoTypes.CoinsIDMarketChart {
+	prices := make([]geckoTypes.ChartItem, 0, len(history))
+	marketCaps := make([]geckoTypes.ChartItem, 0, len(history))
+	volumes := make([]geckoTypes.ChartItem, 0, len(history))
+	for _, sample := range history {
+		ts := float32(sample.UpdatedAt * 1000)
+		prices = append(prices, geckoTypes.ChartItem{ts, float32(sample.Price * rate)})
+		marketCaps = append(marketCaps, geckoTypes.ChartItem{ts, float32(sample.MarketCap * rate)})
+		volumes = append(volumes, geckoTypes.ChartItem{ts, float32(sample.Volume * rate)})
+	}
+	return &geckoTypes.CoinsIDMarketChart{
+		Prices:       &prices,
+		MarketCaps:   &marketCaps,
+		TotalVolumes: &volumes,
+	}
+}
+
+// chartDataToHistory converts Coingecko chart data to price history samples.
+// Market caps and volumes are matched with prices by timestamp.
+func chartDataToHistory(symbol string, data *geckoTypes.CoinsIDMarketChart) []types.HistoricalPrice {
+	if data == nil || data.Prices == nil {
+		return nil
+	}
+	valuesByTime := func(items *[]geckoTypes.ChartItem) map[int64]float64 {
+		ret := map[int64]float64{}
+		if items == nil {
+			return ret
+		}
+		for _, item := range *items {
+			ret[chartItemTime(item)] = float64(item[1])
+		}
+		return ret
+	}
+	marketCaps := valuesByTime(data.MarketCaps)
+	volumes := valuesByTime(data.TotalVolumes)
+
+	history := make([]types.HistoricalPrice, 0, len(*data.Prices))
+	for _, item := range *data.Prices {
+		ts := chartItemTime(item)
+		history = append(history, types.HistoricalPrice{
+			Symbol:    symbol,
+			Price:     float64(item[1]),
+			MarketCap: marketCaps[ts],
+			Volume:    volumes[ts],
+			UpdatedAt: ts,
+		})
+	}
+	return history
+}
+
+// filterChartData returns the items of data that fall in one of the ranges.
+func filterChartData(data *geckoTypes.CoinsIDMarketChart, ranges []timeRange) *geckoTypes.CoinsIDMarketChart {
+	filter := func(items *[]geckoTypes.ChartItem) *[]geckoTypes.ChartItem {
+		ret := []geckoTypes.ChartItem{}
+		if items == nil {
+			return &ret
+		}
+		for _, item := range *items {
+			if inRanges(chartItemTime(item), ranges) {
+				ret = append(ret, item)
+			}
+		}
+		return &ret
+	}
+	return &geckoTypes.CoinsIDMarketChart{
+		Prices:       filter(data.Prices),
+		MarketCaps:   filter(data.MarketCaps),
+		TotalVolumes: filter(data.TotalVolumes),
+	}
+}
+
+// mergeChartData merges two chart series in ascending order of timestamp.
+func mergeChartData(a, b *geckoTypes.CoinsIDMarketChart) *geckoTypes.CoinsIDMarketChart {
+	merge := func(x, y *[]geckoTypes.ChartItem) *[]geckoTypes.ChartItem {
+		ret := make([]geckoTypes.ChartItem, 0, len(*x)+len(*y))
+		ret = append(ret, *x...)
+		ret = append(ret, *y...)
+		sort.SliceStable(ret, func(i, j int) bool { return ret[i][0] < ret[j][0] })
+		return &ret
+	}
+	return &geckoTypes.CoinsIDMarketChart{
+		Prices:       merge(a.Prices, b.Prices),
+		MarketCaps:   merge(a.MarketCaps, b.MarketCaps),
+		TotalVolumes: merge(a.TotalVolumes, b.TotalVolumes),
+	}
+}
+
+// chartItemTime returns the timestamp of a Coingecko chart item in seconds.
+func chartItemTime(item geckoTypes.ChartItem) int64 {
+	return int64(item[0]) / 1000
+}
+
+func inRanges(ts int64, ranges []timeRange) bool {
+	for _, r := range ranges {
+		if r.contains(ts) {
+			return true
+		}
+	}
+	return false
+}
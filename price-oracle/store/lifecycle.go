@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	gecko "github.com/superoo7/go-gecko/v3"
+)
+
+// ErrAlreadyStarted is returned by Handler.Start when the handler already
+// runs its background tasks.
+var ErrAlreadyStarted = errors.New("store: handler already started")
+
+// lifecycle is the state of the background tasks of a Handler.
+type lifecycle struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Start runs the background tasks of the handler: the aggregators, the audit
+// pruning, the change polling which updates the caches, and the chart
+// prefetch. They run until ctx is done or Close is called, Done is closed once
+// they have all returned.
+//
+// A handler is started at most once.
+func (h *Handler) Start(ctx context.Context) error {
+	h.lifecycle.mu.Lock()
+	defer h.lifecycle.mu.Unlock()
+	if h.lifecycle.done != nil {
+		return ErrAlreadyStarted
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	h.lifecycle.cancel = cancel
+	h.lifecycle.done = done
+
+	geckoClient := gecko.NewClient(&http.Client{Timeout: h.Cfg.HttpClientTimeout})
+	tasks := []func(context.Context){
+		func(ctx context.Context) { StartAggregate(ctx, h) },
+		func(ctx context.Context) { StartAuditPruning(ctx, h) },
+		func(ctx context.Context) { StartChangePolling(ctx, h) },
+		func(ctx context.Context) { StartChartPrefetch(ctx, h, geckoClient) },
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(tasks))
+	for _, task := range tasks {
+		go func(task func(context.Context)) {
+			defer wg.Done()
+			task(ctx)
+		}(task)
+	}
+	go func() {
+		wg.Wait()
+		h.SpotCache.close()
+		close(done)
+	}()
+	return nil
+}
+
+// Done returns a channel closed once the background tasks started by Start
+// have returned, nil if the handler was not started.
+func (h *Handler) Done() <-chan struct{} {
+	h.lifecycle.mu.Lock()
+	defer h.lifecycle.mu.Unlock()
+	return h.lifecycle.done
+}
+
+// Close stops the background tasks of the handler and waits for them to
+// return, including the background reloads of SpotCache, which no longer
+// starts any. The Store is left open, it belongs to the caller of WithDB.
+func (h *Handler) Close() error {
+	h.lifecycle.mu.Lock()
+	cancel, done := h.lifecycle.cancel, h.lifecycle.done
+	h.lifecycle.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	h.SpotCache.close()
+	return nil
+}
+
+// close stops the background reloads of the cache and waits for the ongoing
+// ones. A nil cache has none.
+func (c *TokenAndFiatCache) close() {
+	if c == nil || c.priceIDToTicker == nil {
+		return
+	}
+	c.priceIDToTicker.close()
+	c.whitelistedTickers.close()
+	c.tokenPriceAndSupplies.close()
+	c.fiatPrices.close()
+}
@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+func lifecycleConfig() *config.Config {
+	return &config.Config{
+		Interval:           "10ms",
+		WorkerPulse:        5 * time.Millisecond,
+		RecoverCount:       -1,
+		ChangePollInterval: 5 * time.Millisecond,
+		WhitelistedFiats:   []string{"EUR"},
+	}
+}
+
+func TestHandlerLifecycle_StartClose(t *testing.T) {
+	ctx := context.Background()
+	h, db := newEventsHandler(t, lifecycleConfig())
+	require.Nil(t, h.Done())
+
+	changes := make(chan store.PriceChange, 10)
+	h.Events.Subscribe(func(change store.PriceChange) {
+		select {
+		case changes <- change:
+		default:
+		}
+	})
+
+	require.NoError(t, h.Start(ctx))
+	require.ErrorIs(t, h.Start(ctx), store.ErrAlreadyStarted)
+
+	// The change polling runs.
+	require.Eventually(t, func() bool {
+		require.NoError(t, db.UpsertPrice(ctx, store.FiatsStore, float64(time.Now().UnixNano()), "USDEUR"))
+		select {
+		case change := <-changes:
+			return change.Table == store.FiatsStore
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The aggregators run under their daemons.
+	require.Eventually(t, func() bool {
+		status, ok := h.Workers.Get(store.TokenAggregatorWorker)
+		return ok && status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, h.Close())
+	select {
+	case <-h.Done():
+	default:
+		t.Fatal("background tasks still running after Close")
+	}
+	for _, status := range h.Workers.All() {
+		require.False(t, status.Running, status.Name)
+	}
+	// Close is idempotent.
+	require.NoError(t, h.Close())
+}
+
+func TestHandlerLifecycle_StartStopsOnCancel(t *testing.T) {
+	h, _ := newEventsHandler(t, lifecycleConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, h.Start(ctx))
+
+	cancel()
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("background tasks not stopped after the context was cancelled")
+	}
+}
+
+func TestHandlerLifecycle_CloseNotStarted(t *testing.T) {
+	h, _ := newEventsHandler(t, lifecycleConfig())
+	require.NoError(t, h.Close())
+	require.Nil(t, h.Done())
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gecko "github.com/superoo7/go-gecko/v3"
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+const (
+	SourceLocal     = "local"
+	SourceCoingecko = "coingecko"
+
+	// geckoFiatReferenceId is the coin used to derive past fiat rates from
+	// Coingecko, which has no fiat history: the USDEUR rate is the ratio of
+	// its EUR and USD prices.
+	geckoFiatReferenceId = "bitcoin"
+
+	// maxGeckoLookups bounds the Coingecko requests of a single GetPricesAt,
+	// geckoLookupInterval spaces them to stay within the Coingecko rate limit.
+	maxGeckoLookups     = 10
+	geckoLookupInterval = 200 * time.Millisecond
+)
+
+// GetPricesAt returns the prices of (param:<tokens>) (e.g. ATOMUSDT) and
+// (param:<fiats>) (e.g. USDEUR) closest to the unix timestamp (param:<at>),
+// not further away than (param:<tolerance>).
+//
+// Prices come from the local price history first. Symbols missing there are
+// looked up on Coingecko, which only knows the price of a coin at 00:00 UTC of
+// a given day, so the fallback only helps when the closest midnight is within
+// tolerance. Prices found on Coingecko are written back in the history.
+//
+// Symbols without a price within tolerance are not part of the response.
+func (h *Handler) GetPricesAt(
+	ctx context.Context,
+	tokens []string,
+	fiats []string,
+	at int64,
+	tolerance time.Duration,
+	geckoClient *gecko.Client,
+) ([]types.PriceAt, error) {
+	toleranceSec := int64(tolerance.Seconds())
+	symbols := append(append([]string(nil), tokens...), fiats...)
+
+	history, err := h.Store.GetPriceHistoryAt(ctx, symbols, at, toleranceSec)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]struct{}, len(history))
+	prices := make([]types.PriceAt, 0, len(symbols))
+	for _, sample := range history {
+		found[sample.Symbol] = struct{}{}
+		prices = append(prices, types.PriceAt{
+			Symbol:    sample.Symbol,
+			Price:     sample.Price,
+			Timestamp: sample.UpdatedAt,
+			Offset:    sample.UpdatedAt - at,
+			Source:    SourceLocal,
+		})
+	}
+
+	// Coingecko has one sample a day at midnight, take the closest one.
+	midnight := time.Unix(at, 0).UTC().Add(12 * time.Hour).Truncate(24 * time.Hour)
+	if abs(midnight.Unix()-at) > toleranceSec {
+		return prices, nil
+	}
+
+	var missingTokens, missingFiats []string
+	for _, t := range tokens {
+		if _, ok := found[t]; !ok {
+			missingTokens = append(missingTokens, t)
+		}
+	}
+	for _, f := range fiats {
+		if _, ok := found[f]; !ok {
+			missingFiats = append(missingFiats, f)
+		}
+	}
+
+	geckoHistory, err := h.geckoPricesAt(ctx, missingTokens, missingFiats, midnight, geckoClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range geckoHistory {
+		prices = append(prices, types.PriceAt{
+			Symbol:    sample.Symbol,
+			Price:     sample.Price,
+			Timestamp: sample.UpdatedAt,
+			Offset:    sample.UpdatedAt - at,
+			Source:    SourceCoingecko,
+		})
+	}
+	if err := h.Store.UpsertPriceHistory(ctx, geckoHistory); err != nil {
+		h.Logger.Errorw("GetPricesAt", "UpsertPriceHistory Err:", err)
+	}
+	return prices, nil
+}
+
+// geckoPricesAt fetches the prices of tokens and fiats on (param:<day>) from
+// Coingecko. Tokens unknown to CNS or Coingecko, or whose lookup fails, are
+// skipped; an error is returned only when every lookup fails. Lookups are
+// spaced by geckoLookupInterval, at most maxGeckoLookups of them are made, and
+// they stop when ctx is done.
+func (h *Handler) geckoPricesAt(
+	ctx context.Context,
+	tokens []string,
+	fiats []string,
+	day time.Time,
+	geckoClient *gecko.Client,
+) ([]types.HistoricalPrice, error) {
+	if len(tokens) == 0 && len(fiats) == 0 {
+		return nil, nil
+	}
+	date := day.Format("02-01-2006")
+
+	var lookups, failures int
+	var lastErr error
+	lookup := func(id string) (*geckoTypes.CoinsIDHistory, error) {
+		if lookups == maxGeckoLookups {
+			h.Logger.Infow("geckoPricesAt", "Lookup limit reached, skipping", id)
+			return nil, fmt.Errorf("more than %d lookups", maxGeckoLookups)
+		}
+		if lookups > 0 {
+			timer := time.NewTimer(geckoLookupInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		lookups++
+		coin, err := geckoClient.CoinsIDHistory(id, date, false)
+		if err != nil {
+			failures++
+			lastErr = fmt.Errorf("CoinsIDHistory(%s, %s): %w", id, date, err)
+			h.Logger.Errorw("geckoPricesAt", "Err:", lastErr)
+			return nil, lastErr
+		}
+		return coin, nil
+	}
+
+	var history []types.HistoricalPrice
+	if len(tokens) > 0 {
+		names := make([]string, 0, len(tokens))
+		for _, t := range tokens {
+			names = append(names, strings.TrimSuffix(t, types.USDT))
+		}
+		geckoIds, err := h.GetGeckoIdForTokenNames(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tokens {
+			id := geckoIds[strings.ToLower(strings.TrimSuffix(t, types.USDT))]
+			if id == "" {
+				continue
+			}
+			coin, err := lookup(id)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil || coin.MarketData == nil {
+				continue // Best effort, look up as much as we can.
+			}
+			price, ok := coin.MarketData.CurrentPrice["usd"]
+			if !ok {
+				continue
+			}
+			history = append(history, types.HistoricalPrice{
+				Symbol:    t,
+				Price:     price,
+				MarketCap: coin.MarketData.MarketCap["usd"],
+				Volume:    coin.MarketData.TotalVolume["usd"],
+				UpdatedAt: day.Unix(),
+			})
+		}
+	}
+
+	if len(fiats) > 0 {
+		coin, err := lookup(geckoFiatReferenceId)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil && coin.MarketData != nil && coin.MarketData.CurrentPrice["usd"] != 0 {
+			usdPrice := coin.MarketData.CurrentPrice["usd"]
+			for _, f := range fiats {
+				fiatPrice, ok := coin.MarketData.CurrentPrice[strings.ToLower(strings.TrimPrefix(f, types.USD))]
+				if !ok {
+					continue
+				}
+				history = append(history, types.HistoricalPrice{
+					Symbol:    f,
+					Price:     fiatPrice / usdPrice,
+					UpdatedAt: day.Unix(),
+				})
+			}
+		}
+	}
+
+	if lookups > 0 && failures == lookups {
+		return nil, lastErr
+	}
+	return history, nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -3,7 +3,7 @@ package store
 import (
 	"context"
 	"fmt"
-	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,9 +13,11 @@ import (
 	geckoTypes "github.com/superoo7/go-gecko/v3/types"
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/daemon"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
 	"github.com/emerishq/emeris-utils/sentryx"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 
 	"time"
 )
@@ -31,6 +33,35 @@ type Store interface {
 	UpsertPrice(ctx context.Context, to string, price float64, token string) error
 	UpsertToken(ctx context.Context, to string, symbol string, price float64, time int64) error
 	UpsertTokenSupply(ctx context.Context, to string, symbol string, supply float64) error
+	// UpsertTokens writes a whole provider batch in a single transaction.
+	UpsertTokens(ctx context.Context, to string, tokens []types.Prices) error
+	// UpsertTokensAndSupplies writes a provider batch of prices in to and of
+	// supplies in supplyTo in a single transaction.
+	UpsertTokensAndSupplies(ctx context.Context, to string, tokens []types.Prices, supplyTo string, supplies []types.TokenSupply) error
+	// UpsertChainSupplies writes a batch of on-chain supplies in a single
+	// transaction.
+	UpsertChainSupplies(ctx context.Context, supplies []types.ChainSupply) error
+	// GetCNSChainDenoms returns the denoms of the CNS chains that have a
+	// Cosmos SDK REST API endpoint.
+	GetCNSChainDenoms(ctx context.Context) ([]types.ChainDenom, error)
+	UpsertMarkets(ctx context.Context, markets []types.TokenMarket) error
+	// GetMarkets returns the market data of the given tokens, e.g. ATOMUSDT,
+	// in alphabetic order. Tokens without market data are not returned.
+	GetMarkets(ctx context.Context, tokens []string) ([]types.TokenMarket, error)
+	GetPriceHistory(ctx context.Context, symbol string, from int64, to int64) ([]types.HistoricalPrice, error)
+	UpsertPriceHistory(ctx context.Context, history []types.HistoricalPrice) error
+	GetPriceHistoryAt(ctx context.Context, symbols []string, at int64, tolerance int64) ([]types.HistoricalPrice, error)
+	// StreamPriceHistory calls fn with the price history of symbols between
+	// from and to, ordered by symbol then time, without loading it in memory.
+	StreamPriceHistory(ctx context.Context, symbols []string, from int64, to int64, fn func(types.HistoricalPrice) error) error
+	GetBackfillProgress(ctx context.Context) ([]types.BackfillProgress, error)
+	UpsertBackfillProgress(ctx context.Context, progress types.BackfillProgress) error
+	// AppendAudit adds entries to the price audit log, which is append-only.
+	AppendAudit(ctx context.Context, entries []types.AuditEntry) error
+	GetAudit(ctx context.Context, symbol string, from int64, to int64) ([]types.AuditEntry, error)
+	// DeleteAuditBefore deletes the audit entries created before (param:<before>)
+	// and returns how many were deleted.
+	DeleteAuditBefore(ctx context.Context, before int64) (int64, error)
 }
 
 const (
@@ -40,6 +71,11 @@ const (
 	TokensStore          = "oracle.tokens"
 	FiatsStore           = "oracle.fiats"
 	CoingeckoSupplyStore = "oracle.coingeckosupply"
+	ChainSupplyStore     = "oracle.chainsupply"
+	CoingeckoMarketStore = "oracle.coingeckomarkets"
+	PriceHistoryStore    = "oracle.pricehistory"
+	BackfillStore        = "oracle.backfillprogress"
+	AuditStore           = "oracle.priceaudit"
 
 	GranularityMinute = "5M"
 	GranularityHour   = "1H"
@@ -52,47 +88,47 @@ type Handler struct {
 	Cfg        *config.Config
 	SpotCache  *TokenAndFiatCache
 	ChartCache *ChartDataCache
+	// CacheBackend, when not nil, shares SpotCache and ChartCache with the
+	// other replicas.
+	CacheBackend CacheBackend
 
 	// token gecko symbol aka ticker aka name -> gecko id
 	GeckoIdCache *sync.Map
-}
 
-type TokenAndFiatCache struct {
-	// cosmos -> atom; osmosis -> osmo ...
-	PriceIDtoTicker       map[string]string
-	WhitelistedTickers    []string
-	TokenPriceAndSupplies map[string]types.TokenPriceAndSupply
-	FiatPrices            map[string]types.FiatPrice
+	// Events publishes the changes of the aggregated prices.
+	Events *EventBus
 
-	RefreshInterval time.Duration
-	Mu              sync.RWMutex
+	// Workers holds the status of the aggregators and the subscriptions.
+	Workers *daemon.Registry
+	// RestartPolicy is how the daemons of the aggregators and the
+	// subscriptions restart them, it must be set before Start.
+	RestartPolicy daemon.RestartPolicy
+
+	lifecycle   lifecycle
+	auditLog    auditLog
+	knownPrices knownPrices
 }
 
-// ChartDataCache is holder of chart data in a map and evacuating the cache
-// in every 5M, 1H and 1D depending on what data it's holding. Data is a map
-// that holds another map that holds a geckoTypes.CoinsIDMarketChart type.
-//
-// Couple of example of ChartDataCache can be:
-// [5M][cosmos-usd] -> geckoTypes.CoinsIDMarketChart{...}
-// [1D][bitcoin-eur] -> geckoTypes.CoinsIDMarketChart{...}
-// [1D][cosmos-usd] -> geckoTypes.CoinsIDMarketChart{...}
-// Where 1D means it's a one-day granularity data. bitcoin/cosmos is the key
-// for the second map, which holds geckoTypes.CoinsIDMarketChart as value.
-// geckoTypes.CoinsIDMarketChart holds 3 lists of geckoTypes.ChartItems
-// which is a native coinGecko type that is basically a [2]float32, where
-// the zero index represent the unix timestamp and the first index is the value.
-//
-// Discussion can be found in this GH issue:
-// https://github.com/emerishq/demeris-backend/issues/109#issuecomment-993513347
-//
-// RefreshInterval is always 5 minutes. To know why, follow the description of
-// GetChartData function.
-type ChartDataCache struct {
-	Data            map[string]map[string]*geckoTypes.CoinsIDMarketChart
-	Mu              sync.RWMutex
+// TokenAndFiatCache sits in front of the DB for the spot prices and the CNS
+// data they depend on. Every token, fiat, and the CNS data, is cached on its
+// own and is fresh for RefreshInterval. A stale entry is still served for up
+// to MaxStaleness more while it is reloaded in the background, so requests do
+// not wait for the DB when entries expire. Concurrent misses are coalesced
+// into a single DB query.
+type TokenAndFiatCache struct {
 	RefreshInterval time.Duration
+	MaxStaleness    time.Duration
+
+	// cosmos -> atom; osmosis -> osmo ...
+	priceIDToTicker       *ttlCache[map[string]string]
+	whitelistedTickers    *ttlCache[[]string]
+	tokenPriceAndSupplies *ttlCache[types.TokenPriceAndSupply]
+	fiatPrices            *ttlCache[types.FiatPrice]
 }
 
+// CNS data has a single cache entry.
+const cnsCacheKey = "cns"
+
 type option func(*Handler) error
 
 func WithDB(ctx context.Context, store Store) func(*Handler) error {
@@ -125,76 +161,49 @@ func WithConfig(cfg *config.Config) func(*Handler) error {
 	}
 }
 
+// WithSpotPriceCache sets the cache in front of the DB for spot prices. A nil
+// cache is a cache whose entries are fresh for 5 seconds and served stale for
+// 30 seconds more.
 func WithSpotPriceCache(cache *TokenAndFiatCache) func(*Handler) error {
 	return func(handler *Handler) error {
 		if cache == nil {
 			cache = &TokenAndFiatCache{
-				PriceIDtoTicker:       nil,
-				WhitelistedTickers:    nil,
-				TokenPriceAndSupplies: nil,
-				FiatPrices:            nil,
-				RefreshInterval:       time.Second * 5,
-				Mu:                    sync.RWMutex{},
+				RefreshInterval: time.Second * 5,
+				MaxStaleness:    time.Second * 30,
 			}
 		}
-		handler.SpotCache = cache
-		// Invalidate in-memory cache after RefreshInterval
-		go func(cache *TokenAndFiatCache) {
-			randomInt := rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(5) + 5 //nolint:gosec
-			d := cache.RefreshInterval + (cache.RefreshInterval / time.Duration(randomInt))
-			//nolint
-			for {
-				select {
-				case <-time.Tick(d):
-					cache.Mu.Lock()
-					cache.PriceIDtoTicker = nil
-					cache.WhitelistedTickers = nil
-					cache.FiatPrices = nil
-					cache.TokenPriceAndSupplies = nil
-					cache.Mu.Unlock()
-				}
+		onRefreshError := func(err error) {
+			// The logger may be set by a later option.
+			if handler.Logger != nil {
+				handler.Logger.Warnw("SpotCache", "refresh error", err)
 			}
-		}(handler.SpotCache)
+		}
+		cache.priceIDToTicker = newTTLCache[map[string]string](cache.RefreshInterval, cache.MaxStaleness, onRefreshError)
+		cache.whitelistedTickers = newTTLCache[[]string](cache.RefreshInterval, cache.MaxStaleness, onRefreshError)
+		cache.tokenPriceAndSupplies = newTTLCache[types.TokenPriceAndSupply](cache.RefreshInterval, cache.MaxStaleness, onRefreshError)
+		cache.fiatPrices = newTTLCache[types.FiatPrice](cache.RefreshInterval, cache.MaxStaleness, onRefreshError)
+		handler.SpotCache = cache
 		return nil
 	}
 }
 
-func WithChartDataCache(cache *ChartDataCache, refresh time.Duration) func(*Handler) error {
+// WithChartDataCache sets the chart cache of the handler. When cache is nil,
+// a cache of maxBytes, or DefaultChartCacheMaxBytes if zero, is created.
+func WithChartDataCache(cache *ChartDataCache, maxBytes int64) func(*Handler) error {
 	return func(handler *Handler) error {
 		if cache == nil {
-			cache = &ChartDataCache{
-				Data:            map[string]map[string]*geckoTypes.CoinsIDMarketChart{},
-				Mu:              sync.RWMutex{},
-				RefreshInterval: refresh,
-			}
+			cache = &ChartDataCache{MaxBytes: maxBytes}
 		}
 		handler.ChartCache = cache
+		return nil
+	}
+}
 
-		// Invalidate in-memory cache for chart data after RefreshInterval
-		go func(cache *ChartDataCache) {
-			//nolint
-			for {
-				select {
-				case tm := <-time.Tick(cache.RefreshInterval):
-					cache.Mu.Lock()
-					cache.Data[GranularityMinute] = nil
-					// Minute return an int value in [0, 59]
-					// Ticker is 5 minutes, let's say we start at minute 33
-					// Tick cycle will be:
-					// 38, 43, 48, 53, 58, 3, 8, 13, 18, 23, 28, 33, 38 ...
-					// so, <5 means it's the beginning of the hour.
-					if tm.Minute() < 5 {
-						cache.Data[GranularityHour] = nil
-					}
-					// Hour returns an int in [0, 23]
-					// so, 0 means beginning of the day.
-					if tm.Hour() == 0 && tm.Minute() < 5 {
-						cache.Data[GranularityDay] = nil
-					}
-					cache.Mu.Unlock()
-				}
-			}
-		}(handler.ChartCache)
+// WithRestartPolicy sets how the aggregators and the subscriptions are
+// restarted by their daemons.
+func WithRestartPolicy(policy daemon.RestartPolicy) func(*Handler) error {
+	return func(handler *Handler) error {
+		handler.RestartPolicy = policy
 		return nil
 	}
 }
@@ -212,8 +221,18 @@ func WithChartDataCache(cache *ChartDataCache, refresh time.Duration) func(*Hand
 // SpotCache    : This is the cache sits in front the DB. Some functions of
 //                Store interface queries this caches first.
 // ChartCache   : Historical price data.
+// CacheBackend : Optional cache shared by the replicas, e.g. Redis. Set by
+//                WithCacheBackend(backend).
 // GeckoIdCache : Coin Gecko used coin id to query them. Others use coin ticker.
 //                So we cache coin ids.
+// Events       : Changes of the aggregated prices, which update the
+//                SpotCache entries of the changed prices.
+// Workers      : Status of the aggregators and subscriptions, kept up to date
+//                by their daemons.
+// RestartPolicy: How their daemons restart them, e.g. with a backoff. Set by
+//                WithRestartPolicy(policy).
+//
+// The background tasks of the handler are run by Start and stopped by Close.
 func NewStoreHandler(options ...option) (*Handler, error) {
 	handler := &Handler{
 		Store:      nil,
@@ -223,12 +242,15 @@ func NewStoreHandler(options ...option) (*Handler, error) {
 		ChartCache: nil,
 		// Don't need error check or validation. So inline init is enough.
 		GeckoIdCache: &sync.Map{},
+		Events:       NewEventBus(),
+		Workers:      daemon.NewRegistry(),
 	}
 	for _, opt := range options {
 		if err := opt(handler); err != nil {
 			return nil, fmt.Errorf("option failed: %w", err)
 		}
 	}
+	handler.Events.Subscribe(handler.updatePrices)
 	return handler, nil
 }
 
@@ -270,128 +292,110 @@ func (h *Handler) GetGeckoIdForTokenNames(ctx context.Context, names []string) (
 	return ret, nil
 }
 
-// GetCNSWhitelistedTokens returns the whitelisted tokens.
-// It first checks the in-memory cache.
-// If cache is nil, it fetches and updates the cache.
+// GetCNSWhitelistedTokens returns the whitelisted tokens, from the spot
+// cache when it is fresh enough.
 func (h *Handler) GetCNSWhitelistedTokens(ctx context.Context) ([]string, error) {
-	var tokens []string
-	h.SpotCache.Mu.RLock()
-	if h.SpotCache.WhitelistedTickers != nil {
-		tokens = append([]string(nil), h.SpotCache.WhitelistedTickers...)
-	}
-	h.SpotCache.Mu.RUnlock()
-	if len(tokens) != 0 {
-		return tokens, nil
-	}
-
-	names, err := h.Store.GetTokenNames(ctx)
+	names, err := h.SpotCache.whitelistedTickers.get(ctx, cnsCacheKey, h.Store.GetTokenNames)
 	if err != nil {
 		return nil, err
 	}
-	h.SpotCache.Mu.Lock()
-	h.SpotCache.WhitelistedTickers = append([]string(nil), names...)
-	h.SpotCache.Mu.Unlock()
-
-	return names, nil
+	return append([]string(nil), names...), nil
 }
 
+// GetCNSPriceIdsToTicker returns the price id -> ticker map of the CNS
+// tokens, from the spot cache when it is fresh enough.
 func (h *Handler) GetCNSPriceIdsToTicker(ctx context.Context) (map[string]string, error) {
-	h.SpotCache.Mu.RLock()
-	pidToTkr := make(map[string]string, len(h.SpotCache.PriceIDtoTicker))
-	if h.SpotCache.PriceIDtoTicker != nil {
-		for p, t := range h.SpotCache.PriceIDtoTicker {
-			pidToTkr[p] = t
-		}
-	}
-	h.SpotCache.Mu.RUnlock()
-	if len(pidToTkr) != 0 {
-		return pidToTkr, nil
-	}
-
-	idsToTicker, err := h.Store.GetPriceIDToTicker(ctx)
+	idsToTicker, err := h.SpotCache.priceIDToTicker.get(ctx, cnsCacheKey, h.Store.GetPriceIDToTicker)
 	if err != nil {
 		return nil, err
 	}
-	h.SpotCache.Mu.Lock()
-	h.SpotCache.PriceIDtoTicker = idsToTicker
-	h.SpotCache.Mu.Unlock()
-
-	return idsToTicker, nil
+	pidToTkr := make(map[string]string, len(idsToTicker))
+	for p, t := range idsToTicker {
+		pidToTkr[p] = t
+	}
+	return pidToTkr, nil
 }
 
-// GetTokenPriceAndSupplies returns a list of TokenPriceAndSupply. It first
-// checks if in-memory cache is still valid and all requested tokens are cached.
-// If not it fetches all the requested tokens and updates the cache.
+// GetTokenPriceAndSupplies returns the price and supplies of the given
+// tokens in alphabetic order, from the spot cache when it is fresh enough.
+// Tokens without a price are not returned.
 func (h *Handler) GetTokenPriceAndSupplies(ctx context.Context, tokens []string) ([]types.TokenPriceAndSupply, error) {
-	h.SpotCache.Mu.RLock()
-	cachedTokens := make([]string, 0, len(h.SpotCache.TokenPriceAndSupplies))
-	for t := range h.SpotCache.TokenPriceAndSupplies {
-		cachedTokens = append(cachedTokens, t)
-	}
-	h.SpotCache.Mu.RUnlock()
-
-	if h.SpotCache.TokenPriceAndSupplies == nil || !isSubset(tokens, cachedTokens) {
-		tokensDetails, err := h.Store.GetTokenPriceAndSupplies(ctx, tokens)
+	load := sharedLoad(h, tokenCacheKeyPrefix, h.SpotCache.RefreshInterval, func(ctx context.Context, symbols []string) (map[string]types.TokenPriceAndSupply, error) {
+		tokensDetails, err := h.Store.GetTokenPriceAndSupplies(ctx, symbols)
 		if err != nil {
 			return nil, err
 		}
-
-		h.SpotCache.Mu.Lock()
-		if h.SpotCache.TokenPriceAndSupplies == nil {
-			h.SpotCache.TokenPriceAndSupplies = make(map[string]types.TokenPriceAndSupply, len(tokensDetails))
-		}
+		h.selectSupplies(tokensDetails)
+		bySymbol := make(map[string]types.TokenPriceAndSupply, len(tokensDetails))
 		for _, t := range tokensDetails {
-			h.SpotCache.TokenPriceAndSupplies[t.Symbol] = t
+			bySymbol[t.Symbol] = t
 		}
-		h.SpotCache.Mu.Unlock()
-		return tokensDetails, err
+		return bySymbol, nil
+	})
+	cached, err := h.SpotCache.tokenPriceAndSupplies.getMany(ctx, tokens, load)
+	if err != nil {
+		return nil, err
 	}
 
-	h.SpotCache.Mu.RLock()
-	tokenDetails := make([]types.TokenPriceAndSupply, 0, len(tokens))
-	for _, t := range tokens {
-		tokenDetails = append(tokenDetails, h.SpotCache.TokenPriceAndSupplies[t])
+	tokenDetails := make([]types.TokenPriceAndSupply, 0, len(cached))
+	for _, t := range cached {
+		tokenDetails = append(tokenDetails, t)
 	}
-	h.SpotCache.Mu.RUnlock()
+	sort.Slice(tokenDetails, func(i, j int) bool { return tokenDetails[i].Symbol < tokenDetails[j].Symbol })
 	return tokenDetails, nil
 }
 
-// GetFiatPrices returns a list of FiatPrice. It first checks if
-// in-memory cache is still valid and all requested tokens are cached.
-// If not it fetches all the requested tokens and updates the cache.
-func (h *Handler) GetFiatPrices(ctx context.Context, fiats []string) ([]types.FiatPrice, error) {
-	h.SpotCache.Mu.RLock()
-	cachedFiats := make([]string, 0, len(h.SpotCache.FiatPrices))
-	for f := range h.SpotCache.FiatPrices {
-		cachedFiats = append(cachedFiats, f)
+// selectSupplies sets the Supply of the tokens of Cfg.ChainSupplyTokens to
+// their on-chain supply, when known. Other tokens keep the Coingecko
+// circulating supply.
+func (h *Handler) selectSupplies(tokens []types.TokenPriceAndSupply) {
+	if h.Cfg == nil || len(h.Cfg.ChainSupplyTokens) == 0 {
+		return
+	}
+	onChain := make(map[string]bool, len(h.Cfg.ChainSupplyTokens))
+	for _, t := range h.Cfg.ChainSupplyTokens {
+		onChain[strings.ToUpper(t)+types.USDT] = true
 	}
-	h.SpotCache.Mu.RUnlock()
+	for i, t := range tokens {
+		if onChain[t.Symbol] && t.OnChainSupply != nil {
+			tokens[i].Supply = t.OnChainSupply
+		}
+	}
+}
 
-	if len(cachedFiats) == 0 || !isSubset(fiats, cachedFiats) {
-		fiatPrices, err := h.Store.GetFiatPrices(ctx, fiats)
+// GetFiatPrices returns the prices of the given fiats in alphabetic order,
+// from the spot cache when it is fresh enough. Fiats without a price are not
+// returned.
+func (h *Handler) GetFiatPrices(ctx context.Context, fiats []string) ([]types.FiatPrice, error) {
+	load := sharedLoad(h, fiatCacheKeyPrefix, h.SpotCache.RefreshInterval, func(ctx context.Context, symbols []string) (map[string]types.FiatPrice, error) {
+		fiatPrices, err := h.Store.GetFiatPrices(ctx, symbols)
 		if err != nil {
 			return nil, err
 		}
-
-		h.SpotCache.Mu.Lock()
-		if h.SpotCache.FiatPrices == nil {
-			h.SpotCache.FiatPrices = make(map[string]types.FiatPrice, len(fiatPrices))
-		}
+		bySymbol := make(map[string]types.FiatPrice, len(fiatPrices))
 		for _, f := range fiatPrices {
-			h.SpotCache.FiatPrices[f.Symbol] = f
+			bySymbol[f.Symbol] = f
 		}
-		h.SpotCache.Mu.Unlock()
-		return fiatPrices, nil
+		return bySymbol, nil
+	})
+	cached, err := h.SpotCache.fiatPrices.getMany(ctx, fiats, load)
+	if err != nil {
+		return nil, err
 	}
-	h.SpotCache.Mu.RLock()
-	fiatPrices := make([]types.FiatPrice, 0, len(fiats))
-	for _, f := range fiats {
-		fiatPrices = append(fiatPrices, h.SpotCache.FiatPrices[f])
+
+	fiatPrices := make([]types.FiatPrice, 0, len(cached))
+	for _, f := range cached {
+		fiatPrices = append(fiatPrices, f)
 	}
-	h.SpotCache.Mu.RUnlock()
+	sort.Slice(fiatPrices, func(i, j int) bool { return fiatPrices[i].Symbol < fiatPrices[j].Symbol })
 	return fiatPrices, nil
 }
 
+// GetChartData returns the chart data of coinId in the given currency for the
+// last (param:<days>) days. Data is served from the in-memory cache, then
+// from the cache backend if any, then from the local price history, and
+// Coingecko is only asked for the ranges the history does not cover. See
+// historyChartData for details.
 func (h *Handler) GetChartData(
 	ctx context.Context,
 	coinId string,
@@ -412,22 +416,10 @@ func (h *Handler) GetChartData(
 		maxFetchDays = "max"
 	}
 
-	var err error
-	coinIDCurrency := fmt.Sprintf("%s-%s", coinId, currency)
-	h.ChartCache.Mu.Lock()
-	chartData, ok := h.ChartCache.Data[granularity][coinIDCurrency]
-	if !ok {
-		chartData, err = geckoClient.CoinsIDMarketChart(coinId, currency, maxFetchDays)
-		if err != nil {
-			h.ChartCache.Mu.Unlock() // unlock mutex
-			return nil, err
-		}
-		if h.ChartCache.Data[granularity] == nil {
-			h.ChartCache.Data[granularity] = map[string]*geckoTypes.CoinsIDMarketChart{}
-		}
-		h.ChartCache.Data[granularity][coinIDCurrency] = chartData
+	chartData, err := h.cachedChartData(ctx, coinId, maxFetchDays, granularity, currency, geckoClient)
+	if err != nil {
+		return nil, err
 	}
-	h.ChartCache.Mu.Unlock() // unlock mutex
 
 	if days == "1" || days == "max" {
 		return chartData, nil
@@ -464,12 +456,92 @@ func (h *Handler) GetChartData(
 	}, nil
 }
 
+// cachedChartData returns the chart data of coinId from the chart cache, or
+// fetches it. Concurrent requests for the same chart share a single fetch,
+// and wait for it at most until their ctx is done. Failed fetches are cached
+// for ErrorTTL.
+func (h *Handler) cachedChartData(
+	ctx context.Context,
+	coinId string,
+	fetchDays string,
+	granularity string,
+	currency string,
+	geckoClient *gecko.Client,
+) (*geckoTypes.CoinsIDMarketChart, error) {
+	req := chartRequest{coinId: coinId, currency: currency, granularity: granularity, fetchDays: fetchDays}
+	cache := h.ChartCache
+
+	// Only the charts actually served are counted, so that requests for
+	// unknown coins do not grow the counts.
+	if chartData, ok := cache.Get(granularity, req.coinIDCurrency()); ok {
+		cache.recordRequest(req)
+		return chartData, nil
+	}
+	if err := cache.failure(req.key()); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-h.fetchChartData(req, geckoClient, false):
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		cache.recordRequest(req)
+		return res.Val.(*geckoTypes.CoinsIDMarketChart), nil
+	}
+}
+
+// fetchChartData fetches the chart of req, or waits for the ongoing fetch
+// of the same chart, and caches it. Unless refresh is true, the chart is read
+// from the cache backend when it has it.
+func (h *Handler) fetchChartData(req chartRequest, geckoClient *gecko.Client, refresh bool) <-chan singleflight.Result {
+	cache := h.ChartCache
+	key := req.key()
+	return cache.fetches.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.Background(), chartFetchTimeout)
+		defer cancel()
+		ttl := cache.ttl(req.granularity)
+		fetch := func(ctx context.Context, _ []string) (map[string]sharedChart, error) {
+			chartData, err := h.historyChartData(ctx, req.coinId, req.fetchDays, req.granularity, req.currency, geckoClient)
+			if err != nil {
+				return nil, err
+			}
+			expiresAt := time.Now().Add(ttl).UnixMilli()
+			return map[string]sharedChart{key: {Data: chartData, ExpiresAt: expiresAt}}, nil
+		}
+		load := sharedLoad(h, chartCacheKeyPrefix, ttl, fetch)
+		if refresh && h.CacheBackend != nil {
+			load = func(ctx context.Context, keys []string) (map[string]sharedChart, error) {
+				loaded, err := fetch(ctx, keys)
+				if err == nil {
+					sharedSet(ctx, h, chartCacheKeyPrefix, loaded, ttl)
+				}
+				return loaded, err
+			}
+		}
+		loaded, err := load(fetchCtx, []string{key})
+		if err != nil {
+			cache.setFailure(key, err)
+			return nil, err
+		}
+		// A chart read from the cache backend expires when its copy there does.
+		chart := loaded[key]
+		cache.setUntil(req.granularity, req.coinIDCurrency(), chart.Data, time.UnixMilli(chart.ExpiresAt))
+		return chart.Data, nil
+	})
+}
+
 func (h *Handler) PriceTokenAggregator(ctx context.Context) error {
 	span, ctx := sentryx.StartSpan(ctx, "aggregator", sentry.TransactionName("PriceTokenAggregator"))
 	defer span.Finish()
 
 	// symbolKV[Symbol][Store]=price
 	symbolKV := make(map[string]map[string]float64)
+	// audit[Symbol] is the audit log of the aggregation of Symbol.
+	audit := make(map[string][]types.AuditEntry)
+	auditTime := time.Now().Unix()
 	stores := []string{BinanceStore, CoingeckoStore}
 
 	whitelist := make(map[string]struct{})
@@ -492,11 +564,15 @@ func (h *Handler) PriceTokenAggregator(ctx context.Context) error {
 				continue
 			}
 			now := time.Now()
+			entry := types.AuditEntry{Symbol: token.Symbol, CreatedAt: auditTime, Kind: types.AuditInput, Source: s, Price: token.Price, QuotedAt: token.UpdatedAt}
 
 			// do not update if it was already updated in the last minute
 			if token.UpdatedAt < now.Unix()-60 {
+				entry.Kind, entry.Reason = types.AuditRejected, reasonStale
+				audit[token.Symbol] = append(audit[token.Symbol], entry)
 				continue
 			}
+			audit[token.Symbol] = append(audit[token.Symbol], entry)
 			pricelist, ok := symbolKV[token.Symbol]
 			if !ok {
 				pricelist = make(map[string]float64)
@@ -506,6 +582,10 @@ func (h *Handler) PriceTokenAggregator(ctx context.Context) error {
 		}
 	}
 
+	// Aggregated prices are recorded in the history once per HistoryResolution.
+	historyTime := time.Now().Truncate(HistoryResolution).Unix()
+	history := make([]types.HistoricalPrice, 0, len(whitelist))
+	updated := make(map[string]float64, len(whitelist))
 	for token := range whitelist {
 		if len(symbolKV[token]) == 0 {
 			h.Logger.Infow("PriceTokenAggregator", "Price not found for", token)
@@ -521,7 +601,20 @@ func (h *Handler) PriceTokenAggregator(ctx context.Context) error {
 			h.Logger.Errorw("PriceTokenAggregator", "UpsertPrice Err:", err, "Token:", token)
 			continue // Best effort, update as much as we can.
 		}
+		history = append(history, types.HistoricalPrice{Symbol: token, Price: mean, UpdatedAt: historyTime})
+		audit[token] = append(audit[token], types.AuditEntry{Symbol: token, CreatedAt: auditTime, Kind: types.AuditOutput, Source: TokensStore, Price: mean})
+		updated[token] = mean
 	}
+	daemon.AddRows(ctx, len(updated))
+	h.publishPrices(TokensStore, updated)
+
+	h.addMarketCaps(ctx, history)
+	h.addMarketData(ctx, history)
+	if err := h.Store.UpsertPriceHistory(ctx, history); err != nil {
+		h.Logger.Errorw("PriceTokenAggregator", "UpsertPriceHistory Err:", err)
+	}
+
+	h.auditAggregation(ctx, audit)
 	return nil
 }
 
@@ -531,6 +624,9 @@ func (h *Handler) PriceFiatAggregator(ctx context.Context) error {
 
 	// symbolKV[Symbol][Store]=price
 	symbolKV := make(map[string]map[string]float64)
+	// audit[Symbol] is the audit log of the aggregation of Symbol.
+	audit := make(map[string][]types.AuditEntry)
+	auditTime := time.Now().Unix()
 	stores := []string{FixerStore}
 
 	whitelist := make(map[string]struct{})
@@ -549,9 +645,13 @@ func (h *Handler) PriceFiatAggregator(ctx context.Context) error {
 				continue
 			}
 			now := time.Now()
+			entry := types.AuditEntry{Symbol: fiat.Symbol, CreatedAt: auditTime, Kind: types.AuditInput, Source: s, Price: fiat.Price, QuotedAt: fiat.UpdatedAt}
 			if fiat.UpdatedAt < now.Unix()-60 {
+				entry.Kind, entry.Reason = types.AuditRejected, reasonStale
+				audit[fiat.Symbol] = append(audit[fiat.Symbol], entry)
 				continue
 			}
+			audit[fiat.Symbol] = append(audit[fiat.Symbol], entry)
 			pricelist, ok := symbolKV[fiat.Symbol]
 			if !ok {
 				pricelist = make(map[string]float64)
@@ -560,6 +660,9 @@ func (h *Handler) PriceFiatAggregator(ctx context.Context) error {
 			symbolKV[fiat.Symbol] = pricelist
 		}
 	}
+	historyTime := time.Now().Truncate(HistoryResolution).Unix()
+	history := make([]types.HistoricalPrice, 0, len(symbolKV))
+	updated := make(map[string]float64, len(symbolKV))
 	for fiat := range symbolKV {
 		if len(symbolKV[fiat]) == 0 {
 			h.Logger.Infow("PriceFiatAggregator", "Price not found for", fiat)
@@ -575,22 +678,17 @@ func (h *Handler) PriceFiatAggregator(ctx context.Context) error {
 			h.Logger.Errorw("PriceFiatAggregator", "UpsertPrice Err:", err, "Token:", fiat)
 			continue // Best effort, update as much as we can.
 		}
+		history = append(history, types.HistoricalPrice{Symbol: fiat, Price: mean, UpdatedAt: historyTime})
+		audit[fiat] = append(audit[fiat], types.AuditEntry{Symbol: fiat, CreatedAt: auditTime, Kind: types.AuditOutput, Source: FiatsStore, Price: mean})
+		updated[fiat] = mean
 	}
-	return nil
-}
+	daemon.AddRows(ctx, len(updated))
+	h.publishPrices(FiatsStore, updated)
 
-// isSubset returns true if all element of subList in found in globalList
-func isSubset(subList []string, globalList []string) bool {
-	// Turn globalList into a map
-	globalSet := make(map[string]bool, len(globalList))
-	for _, s := range globalList {
-		globalSet[s] = true
+	if err := h.Store.UpsertPriceHistory(ctx, history); err != nil {
+		h.Logger.Errorw("PriceFiatAggregator", "UpsertPriceHistory Err:", err)
 	}
 
-	for _, s := range subList {
-		if _, ok := globalSet[s]; !ok {
-			return false
-		}
-	}
-	return true
+	h.auditAggregation(ctx, audit)
+	return nil
 }
@@ -16,6 +16,7 @@ import (
 	geckoTypes "github.com/superoo7/go-gecko/v3/types"
 
 	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/memory"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
 	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
 	"go.uber.org/zap"
@@ -32,42 +33,29 @@ func TestNewStoreHandler(t *testing.T) {
 	ctx, storeHandler, _, tDown := setup(t)
 	defer tDown()
 	require.NotNil(t, storeHandler)
-
-	storeHandler.SpotCache.Mu.RLock()
-	require.Nil(t, storeHandler.SpotCache.WhitelistedTickers)
-	require.Nil(t, storeHandler.SpotCache.FiatPrices)
-	require.Nil(t, storeHandler.SpotCache.TokenPriceAndSupplies)
-	storeHandler.SpotCache.Mu.RUnlock()
+	require.NotNil(t, storeHandler.SpotCache)
 
 	_, err := storeHandler.GetCNSWhitelistedTokens(ctx)
 	require.NoError(t, err)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.NotNil(t, storeHandler.SpotCache.WhitelistedTickers)
-	storeHandler.SpotCache.Mu.RUnlock()
-
-	require.Eventually(t, func() bool {
-		storeHandler.SpotCache.Mu.RLock()
-		isNil := storeHandler.SpotCache.WhitelistedTickers == nil
-		storeHandler.SpotCache.Mu.RUnlock()
-		return isNil
-	}, 10*time.Second, 1*time.Second)
-
-	_, fiats, err := upsertFiats(storeHandler)
+	upsertedFiats, fiats, err := upsertFiats(storeHandler)
 	require.NoError(t, err)
 
-	_, err = storeHandler.GetFiatPrices(ctx, fiats)
+	fiatPrices, err := storeHandler.GetFiatPrices(ctx, fiats)
 	require.NoError(t, err)
+	require.Equal(t, upsertedFiats, fiatPrices)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.NotNil(t, storeHandler.SpotCache.FiatPrices)
-	storeHandler.SpotCache.Mu.RUnlock()
+	// The cached price is served until it expires, then the new one.
+	err = storeHandler.Store.UpsertPrice(ctx, store.FiatsStore, 42, fiats[0])
+	require.NoError(t, err)
+	fiatPrices, err = storeHandler.GetFiatPrices(ctx, fiats)
+	require.NoError(t, err)
+	require.Equal(t, upsertedFiats, fiatPrices)
 
 	require.Eventually(t, func() bool {
-		storeHandler.SpotCache.Mu.RLock()
-		isNil := storeHandler.SpotCache.FiatPrices == nil
-		storeHandler.SpotCache.Mu.RUnlock()
-		return isNil
+		fiatPrices, err := storeHandler.GetFiatPrices(ctx, fiats)
+		require.NoError(t, err)
+		return fiatPrices[0].Price == 42
 	}, 10*time.Second, 1*time.Second)
 
 	_, tokens, err := upsertTokens(storeHandler)
@@ -76,17 +64,14 @@ func TestNewStoreHandler(t *testing.T) {
 	_, err = storeHandler.GetTokenPriceAndSupplies(ctx, tokens)
 	require.NoError(t, err)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.NotNil(t, storeHandler.SpotCache.TokenPriceAndSupplies)
-	storeHandler.SpotCache.Mu.RUnlock()
+	err = storeHandler.Store.UpsertPrice(ctx, store.TokensStore, 42, tokens[0])
+	require.NoError(t, err)
 
 	require.Eventually(t, func() bool {
-		storeHandler.SpotCache.Mu.RLock()
-		isNil := storeHandler.SpotCache.TokenPriceAndSupplies == nil
-		storeHandler.SpotCache.Mu.RUnlock()
-		return isNil
+		tokenPrices, err := storeHandler.GetTokenPriceAndSupplies(ctx, tokens)
+		require.NoError(t, err)
+		return tokenPrices[0].Price == 42
 	}, 10*time.Second, 1*time.Second)
-
 }
 
 func TestGetCNSWhitelistedTokens(t *testing.T) {
@@ -95,19 +80,11 @@ func TestGetCNSWhitelistedTokens(t *testing.T) {
 
 	whiteList := []string{"ATOM", "LUNA"}
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.Nil(t, storeHandler.SpotCache.WhitelistedTickers)
-	storeHandler.SpotCache.Mu.RUnlock()
-
 	whiteListFromStore, err := storeHandler.GetCNSWhitelistedTokens(ctx)
 	require.NoError(t, err)
 
 	require.Equal(t, whiteList, whiteListFromStore)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.NotNil(t, storeHandler.SpotCache.WhitelistedTickers)
-	storeHandler.SpotCache.Mu.RUnlock()
-
 	whiteListFromCache, err := storeHandler.GetCNSWhitelistedTokens(ctx)
 	require.NoError(t, err)
 
@@ -153,6 +130,24 @@ func TestPriceTokenAggregator(t *testing.T) {
 	}
 }
 
+func TestPriceTokenAggregator_HistoryHasMarketCaps(t *testing.T) {
+	t.Parallel()
+	ctx, storeHandler, _, tDown := setup(t)
+	defer tDown()
+
+	require.NoError(t, storeHandler.Store.UpsertToken(ctx, store.BinanceStore, "ATOMUSDT", 10, time.Now().Unix()))
+	require.NoError(t, storeHandler.Store.UpsertTokenSupply(ctx, store.CoingeckoSupplyStore, "ATOMUSDT", 100))
+
+	require.NoError(t, storeHandler.PriceTokenAggregator(ctx))
+
+	now := time.Now().Unix()
+	history, err := storeHandler.Store.GetPriceHistory(ctx, "ATOMUSDT", now-int64(store.HistoryResolution.Seconds()), now)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, 10.0, history[0].Price)
+	require.Equal(t, 1000.0, history[0].MarketCap)
+}
+
 func TestPriceFiatAggregator(t *testing.T) {
 	t.Parallel()
 	ctx, storeHandler, _, tDown := setup(t)
@@ -189,19 +184,11 @@ func TestGetTokenPriceAndSupplies(t *testing.T) {
 	upsertedTokens, tokens, err := upsertTokens(storeHandler)
 	require.NoError(t, err)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.Nil(t, storeHandler.SpotCache.TokenPriceAndSupplies)
-	storeHandler.SpotCache.Mu.RUnlock()
-
 	tokensFromStore, err := storeHandler.GetTokenPriceAndSupplies(ctx, tokens)
 	require.NoError(t, err)
 
 	require.Equal(t, upsertedTokens, tokensFromStore)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.NotNil(t, storeHandler.SpotCache.TokenPriceAndSupplies)
-	storeHandler.SpotCache.Mu.RUnlock()
-
 	tokensFromCache, err := storeHandler.GetTokenPriceAndSupplies(ctx, tokens)
 	require.NoError(t, err)
 
@@ -213,10 +200,6 @@ func TestGetFiatPrices(t *testing.T) {
 	ctx, storeHandler, _, tDown := setup(t)
 	defer tDown()
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.Nil(t, storeHandler.SpotCache.FiatPrices)
-	storeHandler.SpotCache.Mu.RUnlock()
-
 	upsertedFiats, fiats, err := upsertFiats(storeHandler)
 	require.NoError(t, err)
 
@@ -225,10 +208,6 @@ func TestGetFiatPrices(t *testing.T) {
 
 	require.Equal(t, upsertedFiats, fiatsFromStore)
 
-	storeHandler.SpotCache.Mu.RLock()
-	require.NotNil(t, storeHandler.SpotCache.FiatPrices)
-	storeHandler.SpotCache.Mu.RUnlock()
-
 	fiatsFromCache, err := storeHandler.GetFiatPrices(ctx, fiats)
 	require.NoError(t, err)
 
@@ -253,9 +232,7 @@ func TestGetChartData_CorrectDataReturned(t *testing.T) {
 	ctx, storeHandler, _, tDown := setup(t)
 	defer tDown()
 
-	storeHandler.ChartCache.Mu.RLock()
-	require.NotNil(t, storeHandler.ChartCache.Data)
-	storeHandler.ChartCache.Mu.RUnlock()
+	require.NotNil(t, storeHandler.ChartCache)
 
 	nowUnix := float32(time.Now().Unix())
 
@@ -303,9 +280,7 @@ func TestGetChartData_CacheHit(t *testing.T) {
 	ctx, storeHandler, _, tDown := setup(t)
 	defer tDown()
 
-	storeHandler.ChartCache.Mu.RLock()
-	require.NotNil(t, storeHandler.ChartCache.Data)
-	storeHandler.ChartCache.Mu.RUnlock()
+	require.NotNil(t, storeHandler.ChartCache)
 
 	nowUnix := float32(time.Now().Unix())
 	var clientInvoked int
@@ -371,19 +346,15 @@ func TestGetChartData_CacheEmptied(t *testing.T) {
 			resp, err := storeHandler.GetChartData(ctx, "bitcoin", tt.days, "usd", geckoClient)
 			require.NoError(t, err)
 			require.Equal(t, resp, dataBTC)
-			storeHandler.ChartCache.Mu.RLock()
-			require.Equal(t, storeHandler.ChartCache.Data[tt.cacheGranularity]["bitcoin-usd"], dataBTC)
-			storeHandler.ChartCache.Mu.RUnlock()
+			cached, ok := storeHandler.ChartCache.Get(tt.cacheGranularity, "bitcoin-usd")
+			require.True(t, ok)
+			require.Equal(t, cached, dataBTC)
 
 			time.Sleep(time.Second * 2)
 
-			// We can only ensure that after the refresh interval (1 sec for test setup), the 5M
-			// cache is evicted. Others are dependent on os clock, thus hard to test.
-			if tt.days == "1" {
-				storeHandler.ChartCache.Mu.RLock()
-				require.Nil(t, storeHandler.ChartCache.Data[tt.cacheGranularity])
-				storeHandler.ChartCache.Mu.RUnlock()
-			}
+			// The 5M TTL is 1 sec for the test setup, the others are longer.
+			_, ok = storeHandler.ChartCache.Get(tt.cacheGranularity, "bitcoin-usd")
+			require.Equal(t, tt.days != "1", ok)
 		})
 	}
 }
@@ -460,9 +431,9 @@ func TestGetChartData_FetchDataVSReturnData(t *testing.T) {
 			geckoClient := gecko.NewClient(client)
 			resp, err := storeHandler.GetChartData(ctx, "bitcoin", tt.name, "usd", geckoClient)
 			require.NoError(t, err)
-			storeHandler.ChartCache.Mu.RLock()
-			pricesFromCache := *storeHandler.ChartCache.Data[tt.cacheGranularity]["bitcoin-usd"].Prices
-			storeHandler.ChartCache.Mu.RUnlock()
+			cached, ok := storeHandler.ChartCache.Get(tt.cacheGranularity, "bitcoin-usd")
+			require.True(t, ok)
+			pricesFromCache := *cached.Prices
 			require.Equal(t, tt.returnedDataCount, len(*resp.Prices))
 			require.Equal(t, tt.inCacheDataCount, len(pricesFromCache))
 
@@ -484,6 +455,228 @@ func TestGetChartData_FetchDataVSReturnData(t *testing.T) {
 	}
 }
 
+func TestGetChartData_ServedFromHistory(t *testing.T) {
+	t.Parallel()
+	ctx, storeHandler, _, tDown := setup(t)
+	defer tDown()
+
+	// One sample every 5 minutes over the last day.
+	now := time.Now().Truncate(store.HistoryResolution)
+	history := make([]types.HistoricalPrice, 0, 24*12)
+	for tm := now; tm.After(now.Add(-24 * time.Hour)); tm = tm.Add(-store.HistoryResolution) {
+		history = append(history, types.HistoricalPrice{Symbol: "ATOMUSDT", Price: 10, UpdatedAt: tm.Unix()})
+	}
+	require.NoError(t, storeHandler.Store.UpsertPriceHistory(ctx, history))
+
+	var clientInvoked int
+	client := newTestClient(func(req *http.Request) *http.Response {
+		clientInvoked++
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+	}, time.Second)
+
+	resp, err := storeHandler.GetChartData(ctx, "cosmos", "1", "usd", gecko.NewClient(client))
+	require.NoError(t, err)
+	require.Equal(t, 0, clientInvoked)
+	require.Len(t, *resp.Prices, len(history))
+	for _, p := range *resp.Prices {
+		require.Equal(t, float32(10), p[1])
+	}
+}
+
+func TestGetChartData_CoingeckoFillsHistoryGaps(t *testing.T) {
+	t.Parallel()
+	ctx, storeHandler, _, tDown := setup(t)
+	defer tDown()
+
+	// Local history only covers the last 12 hours.
+	now := time.Now().Truncate(store.HistoryResolution)
+	var history []types.HistoricalPrice
+	for tm := now.Add(-12 * time.Hour); !tm.After(now); tm = tm.Add(store.HistoryResolution) {
+		history = append(history, types.HistoricalPrice{Symbol: "ATOMUSDT", Price: 10, UpdatedAt: tm.Unix()})
+	}
+	require.NoError(t, storeHandler.Store.UpsertPriceHistory(ctx, history))
+
+	// Coingecko has the whole day, timestamps are in milliseconds.
+	geckoData := generateChartData(24*12, float32(now.Add(-24*time.Hour).Unix()*1000), 5*60*1000)
+	var clientInvoked int
+	client := newTestClient(func(req *http.Request) *http.Response {
+		clientInvoked++
+		b, err := json.Marshal(geckoData)
+		require.NoError(t, err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		}
+	}, time.Second)
+
+	resp, err := storeHandler.GetChartData(ctx, "cosmos", "1", "usd", gecko.NewClient(client))
+	require.NoError(t, err)
+	require.Equal(t, 1, clientInvoked)
+
+	// Older half from Coingecko, newer half from the history.
+	prices := *resp.Prices
+	require.Greater(t, len(prices), len(history))
+	require.NotEqual(t, float32(10), prices[0][1])
+	require.Equal(t, float32(10), prices[len(prices)-1][1])
+
+	// Coingecko data has been written back to the history.
+	stored, err := storeHandler.Store.GetPriceHistory(ctx, "ATOMUSDT", now.Add(-24*time.Hour).Unix()-300, now.Unix())
+	require.NoError(t, err)
+	require.Greater(t, len(stored), len(history))
+}
+
+func TestGetChartData_HistoryHasMarketData(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	h, db := newMemoryHandler(t, store.WithChartDataCache(nil, 0))
+
+	// One sample every 5 minutes over the last day.
+	now := time.Now().Truncate(store.HistoryResolution)
+	var history []types.HistoricalPrice
+	for tm := now.Add(-store.HistoryResolution); tm.After(now.Add(-24 * time.Hour)); tm = tm.Add(-store.HistoryResolution) {
+		history = append(history, types.HistoricalPrice{Symbol: "ATOMUSDT", Price: 10, MarketCap: 100, Volume: 1000, UpdatedAt: tm.Unix()})
+	}
+	require.NoError(t, db.UpsertPriceHistory(ctx, history))
+
+	// The aggregator records the latest sample along with the market data.
+	require.NoError(t, db.UpsertToken(ctx, store.BinanceStore, "ATOMUSDT", 11, time.Now().Unix()))
+	require.NoError(t, db.UpsertMarkets(ctx, []types.TokenMarket{{Symbol: "ATOMUSDT", MarketCap: 110, Volume24h: 1100}}))
+	require.NoError(t, h.PriceTokenAggregator(ctx))
+
+	var clientInvoked int
+	client := newTestClient(func(req *http.Request) *http.Response {
+		clientInvoked++
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+	}, time.Second)
+
+	resp, err := h.GetChartData(ctx, "cosmos", "1", "usd", gecko.NewClient(client))
+	require.NoError(t, err)
+	require.Equal(t, 0, clientInvoked)
+	marketCaps, volumes, prices := *resp.MarketCaps, *resp.TotalVolumes, *resp.Prices
+	require.Len(t, marketCaps, len(history)+1)
+	for i := range marketCaps {
+		require.NotZero(t, marketCaps[i][1])
+		require.NotZero(t, volumes[i][1])
+	}
+	last := len(prices) - 1
+	require.Equal(t, float32(11), prices[last][1])
+	require.Equal(t, float32(110), marketCaps[last][1])
+	require.Equal(t, float32(1100), volumes[last][1])
+}
+
+func TestGetPricesAt(t *testing.T) {
+	t.Parallel()
+	ctx, storeHandler, _, tDown := setup(t)
+	defer tDown()
+
+	// 2020-09-13 12:26:40 UTC, far from midnight: no Coingecko fallback.
+	at := int64(1600000000)
+	err := storeHandler.Store.UpsertPriceHistory(ctx, []types.HistoricalPrice{
+		{Symbol: "ATOMUSDT", Price: 5, UpdatedAt: at - 60},
+		{Symbol: "USDEUR", Price: 0.8, UpdatedAt: at + 30},
+	})
+	require.NoError(t, err)
+
+	var clientInvoked int
+	client := newTestClient(func(req *http.Request) *http.Response {
+		clientInvoked++
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+	}, time.Second)
+
+	prices, err := storeHandler.GetPricesAt(ctx, []string{"ATOMUSDT", "LUNAUSDT"}, []string{"USDEUR"}, at, time.Minute, gecko.NewClient(client))
+	require.NoError(t, err)
+	require.Equal(t, 0, clientInvoked)
+	require.ElementsMatch(t, []types.PriceAt{
+		{Symbol: "ATOMUSDT", Price: 5, Timestamp: at - 60, Offset: -60, Source: store.SourceLocal},
+		{Symbol: "USDEUR", Price: 0.8, Timestamp: at + 30, Offset: 30, Source: store.SourceLocal},
+	}, prices)
+}
+
+func TestGetPricesAt_CoingeckoFallback(t *testing.T) {
+	t.Parallel()
+	ctx, storeHandler, _, tDown := setup(t)
+	defer tDown()
+
+	// 2020-09-13 00:00:00 UTC
+	midnight := time.Date(2020, 9, 13, 0, 0, 0, 0, time.UTC)
+	at := midnight.Add(10 * time.Minute).Unix()
+
+	client := newTestClient(func(req *http.Request) *http.Response {
+		require.Equal(t, "13-09-2020", req.URL.Query().Get("date"))
+		prices := map[string]float64{"usd": 5}
+		if strings.Contains(req.URL.Path, "bitcoin") {
+			prices = map[string]float64{"usd": 10000, "eur": 8000}
+		}
+		b, err := json.Marshal(geckoTypes.CoinsIDHistory{
+			MarketData: &geckoTypes.MarketDataItem{CurrentPrice: prices},
+		})
+		require.NoError(t, err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		}
+	}, time.Second)
+
+	prices, err := storeHandler.GetPricesAt(ctx, []string{"ATOMUSDT"}, []string{"USDEUR"}, at, time.Hour, gecko.NewClient(client))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []types.PriceAt{
+		{Symbol: "ATOMUSDT", Price: 5, Timestamp: midnight.Unix(), Offset: -600, Source: store.SourceCoingecko},
+		{Symbol: "USDEUR", Price: 0.8, Timestamp: midnight.Unix(), Offset: -600, Source: store.SourceCoingecko},
+	}, prices)
+
+	// Coingecko prices have been written back in the history.
+	history, err := storeHandler.Store.GetPriceHistory(ctx, "ATOMUSDT", midnight.Unix(), midnight.Unix())
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
+
+func TestGetPricesAt_SkipsFailedLookups(t *testing.T) {
+	t.Parallel()
+	ctx, storeHandler, _, tDown := setup(t)
+	defer tDown()
+
+	// 2020-09-13 00:00:00 UTC
+	midnight := time.Date(2020, 9, 13, 0, 0, 0, 0, time.UTC)
+	at := midnight.Add(10 * time.Minute).Unix()
+
+	// Coingecko fails for terra-luna only.
+	client := newTestClient(func(req *http.Request) *http.Response {
+		if strings.Contains(req.URL.Path, "terra-luna") {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}
+		}
+		b, err := json.Marshal(geckoTypes.CoinsIDHistory{
+			MarketData: &geckoTypes.MarketDataItem{CurrentPrice: map[string]float64{"usd": 5}},
+		})
+		require.NoError(t, err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		}
+	}, time.Second)
+
+	prices, err := storeHandler.GetPricesAt(ctx, []string{"ATOMUSDT", "LUNAUSDT"}, nil, at, time.Hour, gecko.NewClient(client))
+	require.NoError(t, err)
+	require.Equal(t, []types.PriceAt{
+		{Symbol: "ATOMUSDT", Price: 5, Timestamp: midnight.Unix(), Offset: -600, Source: store.SourceCoingecko},
+	}, prices)
+
+	// Failing only when every lookup fails.
+	_, err = storeHandler.GetPricesAt(ctx, []string{"LUNAUSDT"}, nil, at, time.Hour, gecko.NewClient(client))
+	require.Error(t, err)
+}
+
 func TestHandler_GetGeckoIdForToken(t *testing.T) {
 	t.Parallel()
 	ctx, storeHandler, observedLogs, tDown := setup(t)
@@ -565,7 +758,9 @@ func getStoreHandler(t *testing.T, ts testserver.TestServer, logger *zap.Sugared
 		store.WithLogger(logger),
 		store.WithConfig(cfg),
 		store.WithSpotPriceCache(nil),
-		store.WithChartDataCache(nil, time.Second*1),
+		store.WithChartDataCache(&store.ChartDataCache{
+			TTLs: map[string]time.Duration{store.GranularityMinute: time.Second},
+		}, 0),
 	)
 	if err != nil {
 		return nil, err
@@ -574,6 +769,29 @@ func getStoreHandler(t *testing.T, ts testserver.TestServer, logger *zap.Sugared
 	return storeHandler, nil
 }
 
+// newMemoryHandler returns a handler in front of an in-memory DB whose CNS has
+// the ATOM token of cosmos-hub, without spot price cache. options are applied
+// after, and override, these ones.
+func newMemoryHandler(t *testing.T, options ...func(*store.Handler) error) (*store.Handler, *memory.DB) {
+	t.Helper()
+	db := memory.NewDB()
+	db.SetCNS([]memory.CNSChain{{
+		ChainName: "cosmos-hub",
+		Denoms:    []memory.CNSDenom{{Name: "uatom", Ticker: "ATOM", PriceID: "cosmos", FetchPrice: true}},
+	}})
+	h, err := store.NewStoreHandler(
+		store.WithDB(context.Background(), db),
+		store.WithLogger(zap.NewNop().Sugar()),
+		store.WithConfig(&config.Config{}),
+		store.WithSpotPriceCache(nil),
+	)
+	require.NoError(t, err)
+	for _, opt := range options {
+		require.NoError(t, opt(h))
+	}
+	return h, db
+}
+
 func setup(t *testing.T) (context.Context, *store.Handler, *observer.ObservedLogs, func()) {
 	t.Helper()
 	ts, err := testserver.NewTestServer()
@@ -653,14 +871,16 @@ func upsertTokens(storeHandler *store.Handler) ([]types.TokenPriceAndSupply, []s
 	// alphabetic order
 	upsertTokens := []types.TokenPriceAndSupply{
 		{
-			Symbol: "ATOMUSDT",
-			Price:  12.3,
-			Supply: 456789,
+			Symbol:            "ATOMUSDT",
+			Price:             12.3,
+			Supply:            floatPtr(456789),
+			CirculatingSupply: floatPtr(456789),
 		},
 		{
-			Symbol: "LUNAUSDT",
-			Price:  98.7,
-			Supply: 654321,
+			Symbol:            "LUNAUSDT",
+			Price:             98.7,
+			Supply:            floatPtr(654321),
+			CirculatingSupply: floatPtr(654321),
 		},
 	}
 
@@ -670,7 +890,7 @@ func upsertTokens(storeHandler *store.Handler) ([]types.TokenPriceAndSupply, []s
 			return nil, nil, err
 		}
 
-		if err := storeHandler.Store.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, token.Symbol, token.Supply); err != nil {
+		if err := storeHandler.Store.UpsertTokenSupply(context.Background(), store.CoingeckoSupplyStore, token.Symbol, *token.Supply); err != nil {
 			return nil, nil, err
 		}
 
@@ -679,6 +899,10 @@ func upsertTokens(storeHandler *store.Handler) ([]types.TokenPriceAndSupply, []s
 	return upsertTokens, tokens, nil
 }
 
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
 func upsertFiats(storeHandler *store.Handler) ([]types.FiatPrice, []string, error) {
 	// alphabetic order
 	upsertFiats := []types.FiatPrice{
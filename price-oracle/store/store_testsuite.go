@@ -2,9 +2,11 @@ package store
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -53,6 +55,51 @@ func TestStore(t *testing.T, store Store) {
 		require.Equal(t, now.Unix(), prices[0].UpdatedAt)
 	})
 
+	t.Run("Upsert token batches and Get prices", func(t *testing.T) {
+		err := store.UpsertTokens(context.Background(), FixerStore, []types.Prices{
+			{Symbol: "USDEUR", Price: 1, UpdatedAt: 10},
+			{Symbol: "USDCHF", Price: 2, UpdatedAt: 10},
+			// The last duplicate wins.
+			{Symbol: "USDEUR", Price: 3, UpdatedAt: 10},
+		})
+		require.NoError(t, err)
+		err = store.UpsertTokens(context.Background(), FixerStore, []types.Prices{
+			{Symbol: "USDCHF", Price: 4, UpdatedAt: 20},
+		})
+		require.NoError(t, err)
+
+		prices, err := store.GetPrices(context.Background(), FixerStore)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []types.Prices{
+			{Symbol: "USDEUR", Price: 3, UpdatedAt: 10},
+			{Symbol: "USDCHF", Price: 4, UpdatedAt: 20},
+		}, prices)
+
+		err = store.UpsertTokensAndSupplies(context.Background(),
+			CoingeckoStore, []types.Prices{{Symbol: "BATCHUSDT", Price: 5, UpdatedAt: 30}},
+			CoingeckoSupplyStore, []types.TokenSupply{{Symbol: "BATCHUSDT", Supply: 500}})
+		require.NoError(t, err)
+		err = store.UpsertPrice(context.Background(), TokensStore, 5, "BATCHUSDT")
+		require.NoError(t, err)
+
+		tokens, err := store.GetTokenPriceAndSupplies(context.Background(), []string{"BATCHUSDT"})
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		require.NotNil(t, tokens[0].Supply)
+		require.Equal(t, float64(500), *tokens[0].Supply)
+
+		// A failing batch writes nothing.
+		err = store.UpsertTokensAndSupplies(context.Background(),
+			CoingeckoStore, []types.Prices{{Symbol: "BATCHUSDT", Price: 6, UpdatedAt: 40}},
+			"oracle.unknown", []types.TokenSupply{{Symbol: "BATCHUSDT", Supply: 600}})
+		require.Error(t, err)
+		prices, err = store.GetPrices(context.Background(), CoingeckoStore)
+		require.NoError(t, err)
+		require.Contains(t, prices, types.Prices{Symbol: "BATCHUSDT", Price: 5, UpdatedAt: 30})
+
+		require.NoError(t, store.UpsertTokens(context.Background(), FixerStore, nil))
+	})
+
 	t.Run("Upsert token supply and Get Tokens", func(t *testing.T) {
 		err := store.UpsertPrice(context.Background(), TokensStore, -100, "ATOM")
 		require.NoError(t, err)
@@ -64,6 +111,213 @@ func TestStore(t *testing.T, store Store) {
 		prices, err := store.GetTokenPriceAndSupplies(context.Background(), tokenList)
 		require.NoError(t, err)
 		require.Equal(t, "ATOM", prices[0].Symbol)
-		require.Equal(t, float64(-23425), prices[0].Supply)
+		require.NotNil(t, prices[0].Supply)
+		require.Equal(t, float64(-23425), *prices[0].Supply)
+	})
+
+	t.Run("Get Tokens with and without supply", func(t *testing.T) {
+		err := store.UpsertPrice(context.Background(), TokensStore, 1, "AAA")
+		require.NoError(t, err)
+		err = store.UpsertTokenSupply(context.Background(), CoingeckoSupplyStore, "AAA", 1000)
+		require.NoError(t, err)
+		err = store.UpsertPrice(context.Background(), TokensStore, 2, "BBB")
+		require.NoError(t, err)
+
+		// A token without supply must not get the one of the previous token.
+		prices, err := store.GetTokenPriceAndSupplies(context.Background(), []string{"BBB", "AAA", "CCC"})
+		require.NoError(t, err)
+		require.Len(t, prices, 2)
+		require.Equal(t, "AAA", prices[0].Symbol)
+		require.NotNil(t, prices[0].Supply)
+		require.Equal(t, float64(1000), *prices[0].Supply)
+		require.Equal(t, "BBB", prices[1].Symbol)
+		require.Nil(t, prices[1].Supply)
+
+		prices, err = store.GetTokenPriceAndSupplies(context.Background(), nil)
+		require.NoError(t, err)
+		require.Empty(t, prices)
+	})
+
+	t.Run("Get Tokens with total, max and on-chain supplies", func(t *testing.T) {
+		total, max := 2000.0, 3000.0
+		err := store.UpsertPrice(context.Background(), TokensStore, 1, "SUPPLYUSDT")
+		require.NoError(t, err)
+		err = store.UpsertTokensAndSupplies(context.Background(), CoingeckoStore, nil, CoingeckoSupplyStore, []types.TokenSupply{
+			{Symbol: "SUPPLYUSDT", Supply: 1000, TotalSupply: &total, MaxSupply: &max},
+		})
+		require.NoError(t, err)
+
+		prices, err := store.GetTokenPriceAndSupplies(context.Background(), []string{"SUPPLYUSDT"})
+		require.NoError(t, err)
+		require.Len(t, prices, 1)
+		require.Equal(t, 1000.0, *prices[0].Supply)
+		require.Equal(t, 1000.0, *prices[0].CirculatingSupply)
+		require.Equal(t, total, *prices[0].TotalSupply)
+		require.Equal(t, max, *prices[0].MaxSupply)
+		require.Nil(t, prices[0].OnChainSupply)
+
+		err = store.UpsertChainSupplies(context.Background(), []types.ChainSupply{
+			{Symbol: "SUPPLYUSDT", ChainName: "supply-chain", Denom: "usupply", Supply: 1500, UpdatedAt: 10},
+		})
+		require.NoError(t, err)
+		err = store.UpsertChainSupplies(context.Background(), []types.ChainSupply{
+			{Symbol: "SUPPLYUSDT", ChainName: "supply-chain", Denom: "usupply", Supply: 1600, UpdatedAt: 20},
+		})
+		require.NoError(t, err)
+
+		// An upsert of the circulating supply alone keeps the other supplies.
+		err = store.UpsertTokenSupply(context.Background(), CoingeckoSupplyStore, "SUPPLYUSDT", 1100)
+		require.NoError(t, err)
+
+		prices, err = store.GetTokenPriceAndSupplies(context.Background(), []string{"SUPPLYUSDT"})
+		require.NoError(t, err)
+		require.Equal(t, 1100.0, *prices[0].Supply)
+		require.Equal(t, total, *prices[0].TotalSupply)
+		require.NotNil(t, prices[0].OnChainSupply)
+		require.Equal(t, 1600.0, *prices[0].OnChainSupply)
+	})
+
+	t.Run("Upsert and Get markets", func(t *testing.T) {
+		markets := []types.TokenMarket{
+			{Symbol: "MKTBUSDT", MarketCap: 200, Volume24h: 20, High24h: 2.2, Low24h: 1.8, PriceChange24h: -0.1, PriceChangePercentage24h: -5, UpdatedAt: 10},
+			{Symbol: "MKTAUSDT", MarketCap: 100, Volume24h: 10, High24h: 1.1, Low24h: 0.9, PriceChange24h: 0.1, PriceChangePercentage24h: 10, UpdatedAt: 10},
+		}
+		require.NoError(t, store.UpsertMarkets(context.Background(), markets))
+		markets[0].MarketCap = 210
+		markets[0].UpdatedAt = 20
+		require.NoError(t, store.UpsertMarkets(context.Background(), markets[:1]))
+		require.NoError(t, store.UpsertMarkets(context.Background(), nil))
+
+		got, err := store.GetMarkets(context.Background(), []string{"MKTBUSDT", "MKTAUSDT", "MKTCUSDT"})
+		require.NoError(t, err)
+		require.Equal(t, []types.TokenMarket{markets[1], markets[0]}, got)
+
+		got, err = store.GetMarkets(context.Background(), nil)
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("Upsert and Get price history", func(t *testing.T) {
+		history := []types.HistoricalPrice{
+			{Symbol: "ATOMUSDT", Price: 10, MarketCap: 100, Volume: 1000, UpdatedAt: 100},
+			{Symbol: "ATOMUSDT", Price: 11, MarketCap: 110, Volume: 1100, UpdatedAt: 200},
+			{Symbol: "ATOMUSDT", Price: 12, MarketCap: 120, Volume: 1200, UpdatedAt: 300},
+			{Symbol: "LUNAUSDT", Price: 1, MarketCap: 10, Volume: 100, UpdatedAt: 200},
+		}
+		err := store.UpsertPriceHistory(context.Background(), history)
+		require.NoError(t, err)
+
+		got, err := store.GetPriceHistory(context.Background(), "ATOMUSDT", 150, 300)
+		require.NoError(t, err)
+		require.Equal(t, history[1:3], got)
+
+		// Writing the same timestamp again replaces the sample.
+		err = store.UpsertPriceHistory(context.Background(), []types.HistoricalPrice{
+			{Symbol: "ATOMUSDT", Price: 20, MarketCap: 200, Volume: 2000, UpdatedAt: 200},
+		})
+		require.NoError(t, err)
+
+		got, err = store.GetPriceHistory(context.Background(), "ATOMUSDT", 200, 200)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, float64(20), got[0].Price)
+	})
+
+	t.Run("Get price history at a point in time", func(t *testing.T) {
+		history := []types.HistoricalPrice{
+			{Symbol: "OSMOUSDT", Price: 1, UpdatedAt: 1000},
+			{Symbol: "OSMOUSDT", Price: 2, UpdatedAt: 1100},
+			{Symbol: "USDCHF", Price: 3, UpdatedAt: 900},
+			{Symbol: "USDCHF", Price: 4, UpdatedAt: 1120},
+			{Symbol: "USDKRW", Price: 5, UpdatedAt: 500},
+		}
+		err := store.UpsertPriceHistory(context.Background(), history)
+		require.NoError(t, err)
+
+		got, err := store.GetPriceHistoryAt(context.Background(), []string{"OSMOUSDT", "USDCHF", "USDKRW"}, 1080, 100)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []types.HistoricalPrice{history[1], history[3]}, got)
+
+		// On a tie, the older sample wins.
+		got, err = store.GetPriceHistoryAt(context.Background(), []string{"OSMOUSDT"}, 1050, 100)
+		require.NoError(t, err)
+		require.Equal(t, []types.HistoricalPrice{history[0]}, got)
+	})
+
+	t.Run("Stream price history", func(t *testing.T) {
+		history := []types.HistoricalPrice{
+			{Symbol: "STREAMB", Price: 1, UpdatedAt: 100},
+			{Symbol: "STREAMA", Price: 2, UpdatedAt: 200},
+			{Symbol: "STREAMA", Price: 3, UpdatedAt: 100},
+			{Symbol: "STREAMC", Price: 4, UpdatedAt: 100},
+		}
+		err := store.UpsertPriceHistory(context.Background(), history)
+		require.NoError(t, err)
+
+		var got []types.HistoricalPrice
+		err = store.StreamPriceHistory(context.Background(), []string{"STREAMB", "STREAMA"}, 0, 200, func(sample types.HistoricalPrice) error {
+			got = append(got, sample)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []types.HistoricalPrice{history[2], history[1], history[0]}, got)
+
+		// An error of fn stops the stream.
+		errStop := errors.New("stop")
+		calls := 0
+		err = store.StreamPriceHistory(context.Background(), []string{"STREAMA"}, 0, 200, func(types.HistoricalPrice) error {
+			calls++
+			return errStop
+		})
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("Upsert and Get backfill progress", func(t *testing.T) {
+		progress := types.BackfillProgress{Symbol: "ATOMUSDT", GeckoID: "cosmos", From: 100, To: 1000, DoneUntil: 500, UpdatedAt: 10}
+		err := store.UpsertBackfillProgress(context.Background(), progress)
+		require.NoError(t, err)
+		other := types.BackfillProgress{Symbol: "ATOMUSDT", GeckoID: "cosmos", From: 0, To: 1000, DoneUntil: 1000, UpdatedAt: 20}
+		err = store.UpsertBackfillProgress(context.Background(), other)
+		require.NoError(t, err)
+
+		// The same backfill is updated.
+		progress.DoneUntil, progress.UpdatedAt = 1000, 30
+		err = store.UpsertBackfillProgress(context.Background(), progress)
+		require.NoError(t, err)
+
+		got, err := store.GetBackfillProgress(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []types.BackfillProgress{other, progress}, got)
+	})
+
+	t.Run("Append, Get and Delete audit entries", func(t *testing.T) {
+		entries := []types.AuditEntry{
+			{Symbol: "AUDITUSDT", CreatedAt: 200, Kind: types.AuditOutput, Source: TokensStore, Price: 2},
+			{Symbol: "AUDITUSDT", CreatedAt: 200, Kind: types.AuditInput, Source: BinanceStore, Price: 2, QuotedAt: 195},
+			{Symbol: "AUDITUSDT", CreatedAt: 200, Kind: types.AuditRejected, Source: CoingeckoStore, Price: 3, QuotedAt: 100, Reason: "stale"},
+			{Symbol: "AUDITUSDT", CreatedAt: 100, Kind: types.AuditQuote, Source: BinanceStore, Price: 1, QuotedAt: 100},
+			{Symbol: "OTHERUSDT", CreatedAt: 200, Kind: types.AuditQuote, Source: BinanceStore, Price: 4, QuotedAt: 200},
+		}
+		err := store.AppendAudit(context.Background(), entries)
+		require.NoError(t, err)
+		// An entry appended again is kept once.
+		err = store.AppendAudit(context.Background(), entries[3:4])
+		require.NoError(t, err)
+
+		got, err := store.GetAudit(context.Background(), "AUDITUSDT", 0, 200)
+		require.NoError(t, err)
+		require.Equal(t, []types.AuditEntry{entries[3], entries[1], entries[0], entries[2]}, got)
+
+		got, err = store.GetAudit(context.Background(), "AUDITUSDT", 150, 200)
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+
+		deleted, err := store.DeleteAuditBefore(context.Background(), 150)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, deleted, int64(1))
+		got, err = store.GetAudit(context.Background(), "AUDITUSDT", 0, 200)
+		require.NoError(t, err)
+		require.Equal(t, []types.AuditEntry{entries[1], entries[0], entries[2]}, got)
 	})
 }
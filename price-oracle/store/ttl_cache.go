@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ttlLoadTimeout bounds a load. Loads are shared by concurrent callers, so
+// they do not use the context of any of them.
+const ttlLoadTimeout = 30 * time.Second
+
+// ttlCache is a per-key cache in front of a slow source, e.g. the DB.
+//
+// An entry is fresh for ttl after it was loaded. A stale entry is still
+// served for up to maxStale more, while it is reloaded in the background.
+// Older entries are reloaded before being served. A key being loaded is not
+// loaded again by concurrent callers, they wait for the ongoing load.
+type ttlCache[V any] struct {
+	ttl      time.Duration
+	maxStale time.Duration
+	// onRefreshError is called with the error of a failed background reload,
+	// the stale entries are then kept until they are too old.
+	onRefreshError func(error)
+	now            func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]ttlEntry[V]
+	// loading[key] is the ongoing load of key.
+	loading map[string]*ttlLoad[V]
+	// generation is incremented by update, updated[key] is the generation key
+	// was last updated at. A load started before key was updated does not
+	// cache it.
+	generation uint64
+	updated    map[string]uint64
+	// refreshes tracks the background reloads, none starts once closed is
+	// set by close.
+	refreshes sync.WaitGroup
+	closed    bool
+}
+
+type ttlEntry[V any] struct {
+	value    V
+	loadedAt time.Time
+}
+
+// ttlLoad is a call of a loadFunc, done is closed once values and err are
+// set.
+type ttlLoad[V any] struct {
+	done   chan struct{}
+	values map[string]V
+	err    error
+}
+
+// loadFunc returns the values of keys. Keys without a value are left out.
+type loadFunc[V any] func(ctx context.Context, keys []string) (map[string]V, error)
+
+func newTTLCache[V any](ttl time.Duration, maxStale time.Duration, onRefreshError func(error)) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:            ttl,
+		maxStale:       maxStale,
+		onRefreshError: onRefreshError,
+		now:            time.Now,
+		entries:        map[string]ttlEntry[V]{},
+		loading:        map[string]*ttlLoad[V]{},
+		updated:        map[string]uint64{},
+	}
+}
+
+// getMany returns the values of keys, calling load for the keys that are not
+// cached or too stale. Keys without a value are left out.
+func (c *ttlCache[V]) getMany(ctx context.Context, keys []string, load loadFunc[V]) (map[string]V, error) {
+	now := c.now()
+	values := make(map[string]V, len(keys))
+	var missing, stale []string
+	c.mu.RLock()
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		e, ok := c.entries[key]
+		age := now.Sub(e.loadedAt)
+		switch {
+		case ok && age < c.ttl:
+			values[key] = e.value
+		case ok && age < c.ttl+c.maxStale:
+			values[key] = e.value
+			stale = append(stale, key)
+		default:
+			missing = append(missing, key)
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(stale) > 0 {
+		c.refresh(stale, load)
+	}
+	if len(missing) > 0 {
+		loaded, err := c.load(ctx, uniqueKeys(missing), load)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range missing {
+			if v, ok := loaded[key]; ok {
+				values[key] = v
+			}
+		}
+	}
+	return values, nil
+}
+
+// refresh reloads keys in the background, unless the cache is closed. The
+// request that found the entries stale must not wait, nor be able to cancel
+// the reload.
+func (c *ttlCache[V]) refresh(keys []string, load loadFunc[V]) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+	c.refreshes.Add(1)
+	go func() {
+		defer c.refreshes.Done()
+		if _, err := c.load(context.Background(), keys, load); err != nil && c.onRefreshError != nil {
+			c.onRefreshError(err)
+		}
+	}()
+}
+
+// close stops the background reloads and waits for the ongoing ones. Stale
+// entries are still served after, until they are too old.
+func (c *ttlCache[V]) close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.refreshes.Wait()
+}
+
+// update replaces the cached values of keys with fn of them, which are then
+// fresh again, and returns the new values. Keys that are not cached are left
+// out.
+func (c *ttlCache[V]) update(keys []string, fn func(key string, v V) V) map[string]V {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	values := make(map[string]V, len(keys))
+	for _, key := range keys {
+		c.updated[key] = c.generation
+		e, ok := c.entries[key]
+		if !ok {
+			continue
+		}
+		values[key] = fn(key, e.value)
+		c.entries[key] = ttlEntry[V]{value: values[key], loadedAt: now}
+	}
+	return values
+}
+
+// get returns the value of key, calling load when it is not cached or too
+// stale.
+func (c *ttlCache[V]) get(ctx context.Context, key string, load func(ctx context.Context) (V, error)) (V, error) {
+	values, err := c.getMany(ctx, []string{key}, func(ctx context.Context, _ []string) (map[string]V, error) {
+		v, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]V{key: v}, nil
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return values[key], nil
+}
+
+// load calls load for keys, or waits for the ongoing loads of some of them,
+// and caches the values. The loads run until done even if ctx is cancelled,
+// so that other callers waiting for them are not failed.
+func (c *ttlCache[V]) load(ctx context.Context, keys []string, load loadFunc[V]) (map[string]V, error) {
+	c.mu.Lock()
+	loads := make(map[*ttlLoad[V]]bool)
+	var own []string
+	for _, key := range keys {
+		if l, ok := c.loading[key]; ok {
+			loads[l] = true
+			continue
+		}
+		own = append(own, key)
+	}
+	if len(own) > 0 {
+		l := &ttlLoad[V]{done: make(chan struct{})}
+		for _, key := range own {
+			c.loading[key] = l
+		}
+		loads[l] = true
+		go c.run(l, c.generation, own, load)
+	}
+	c.mu.Unlock()
+
+	values := make(map[string]V, len(keys))
+	for l := range loads {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if l.err != nil {
+			return nil, l.err
+		}
+		for key, v := range l.values {
+			values[key] = v
+		}
+	}
+	return values, nil
+}
+
+// run calls load for keys and caches the values, unless they were updated
+// after generation.
+func (c *ttlCache[V]) run(l *ttlLoad[V], generation uint64, keys []string, load loadFunc[V]) {
+	defer close(l.done)
+	ctx, cancel := context.WithTimeout(context.Background(), ttlLoadTimeout)
+	defer cancel()
+	l.values, l.err = load(ctx, keys)
+
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if c.loading[key] == l {
+			delete(c.loading, key)
+		}
+	}
+	if l.err != nil {
+		return
+	}
+	for key, value := range l.values {
+		if c.updated[key] > generation {
+			// Updated while loading, value may be outdated.
+			continue
+		}
+		c.entries[key] = ttlEntry[V]{value: value, loadedAt: now}
+	}
+}
+
+// uniqueKeys returns keys without duplicates, in a new slice.
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a settable clock for ttlCache.now.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// counter is a loadFunc returning version for every key, counting its calls.
+type counter struct {
+	calls   int32
+	version int32
+	err     error
+}
+
+func (c *counter) load(_ context.Context, keys []string) (map[string]int32, error) {
+	atomic.AddInt32(&c.calls, 1)
+	if c.err != nil {
+		return nil, c.err
+	}
+	values := make(map[string]int32, len(keys))
+	for _, key := range keys {
+		if key != "unknown" {
+			values[key] = atomic.LoadInt32(&c.version)
+		}
+	}
+	return values, nil
+}
+
+func newTestTTLCache(onRefreshError func(error)) (*ttlCache[int32], *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := newTTLCache[int32](5*time.Second, 30*time.Second, onRefreshError)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestTTLCache(t *testing.T) {
+	ctx := context.Background()
+	c, clock := newTestTTLCache(nil)
+	src := &counter{version: 1}
+
+	values, err := c.getMany(ctx, []string{"a", "b", "a", "unknown"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 1, "b": 1}, values)
+	require.EqualValues(t, 1, src.calls)
+
+	// Fresh, served from the cache. Only the unknown key is loaded again.
+	atomic.StoreInt32(&src.version, 2)
+	clock.Add(4 * time.Second)
+	values, err = c.getMany(ctx, []string{"a", "b", "unknown"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 1, "b": 1}, values)
+	require.EqualValues(t, 2, src.calls)
+
+	// Stale, served from the cache while reloaded in the background.
+	clock.Add(2 * time.Second)
+	values, err = c.getMany(ctx, []string{"a"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 1}, values)
+	require.Eventually(t, func() bool {
+		values, err := c.getMany(ctx, []string{"a"}, src.load)
+		require.NoError(t, err)
+		return values["a"] == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// Too stale, loaded before being served.
+	atomic.StoreInt32(&src.version, 3)
+	clock.Add(time.Minute)
+	values, err = c.getMany(ctx, []string{"a", "b"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 3, "b": 3}, values)
+}
+
+func TestTTLCache_Errors(t *testing.T) {
+	ctx := context.Background()
+	refreshErrs := make(chan error, 1)
+	c, clock := newTestTTLCache(func(err error) { refreshErrs <- err })
+	src := &counter{version: 1}
+
+	_, err := c.getMany(ctx, []string{"a"}, src.load)
+	require.NoError(t, err)
+
+	// A failed background reload keeps the stale entry.
+	src.err = errors.New("db down")
+	clock.Add(10 * time.Second)
+	values, err := c.getMany(ctx, []string{"a"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 1}, values)
+	select {
+	case err := <-refreshErrs:
+		require.ErrorIs(t, err, src.err)
+	case <-time.After(time.Second):
+		t.Fatal("no refresh error")
+	}
+
+	// Until it is too stale.
+	clock.Add(time.Minute)
+	_, err = c.getMany(ctx, []string{"a"}, src.load)
+	require.ErrorIs(t, err, src.err)
+}
+
+func TestTTLCache_Close(t *testing.T) {
+	ctx := context.Background()
+	c, clock := newTestTTLCache(nil)
+	src := &counter{version: 1}
+	_, err := c.getMany(ctx, []string{"a"}, src.load)
+	require.NoError(t, err)
+	c.close()
+
+	// Stale entries are served without being reloaded.
+	clock.Add(10 * time.Second)
+	values, err := c.getMany(ctx, []string{"a"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 1}, values)
+	c.close()
+	require.EqualValues(t, 1, atomic.LoadInt32(&src.calls))
+}
+
+func TestTTLCache_CoalescesMisses(t *testing.T) {
+	c, _ := newTestTTLCache(nil)
+	var calls int32
+	release := make(chan struct{})
+	load := func(_ context.Context, keys []string) (map[string]int32, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[string]int32{"a": 1, "b": 2}, nil
+	}
+
+	const requests = 10
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := c.getMany(context.Background(), []string{"b", "a"}, load)
+			require.NoError(t, err)
+			require.Equal(t, map[string]int32{"a": 1, "b": 2}, values)
+		}()
+	}
+	// Let the requests pile up on the first load.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestTTLCache_CoalescesPerKey(t *testing.T) {
+	c, _ := newTestTTLCache(nil)
+	loading, release := make(chan struct{}), make(chan struct{})
+	var loaded [][]string
+	var mu sync.Mutex
+	load := func(_ context.Context, keys []string) (map[string]int32, error) {
+		mu.Lock()
+		loaded = append(loaded, keys)
+		mu.Unlock()
+		if keys[0] == "a" {
+			close(loading)
+			<-release
+		}
+		values := make(map[string]int32, len(keys))
+		for _, key := range keys {
+			values[key] = 1
+		}
+		return values, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := c.getMany(context.Background(), []string{"a", "b"}, load)
+		require.NoError(t, err)
+	}()
+	<-loading
+	// b is being loaded, only c is loaded again.
+	second := make(chan map[string]int32)
+	go func() {
+		values, err := c.getMany(context.Background(), []string{"b", "c"}, load)
+		require.NoError(t, err)
+		second <- values
+	}()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(loaded) == 2
+	}, time.Second, 10*time.Millisecond)
+	close(release)
+	require.Equal(t, map[string]int32{"b": 1, "c": 1}, <-second)
+	<-done
+	require.Equal(t, [][]string{{"a", "b"}, {"c"}}, loaded)
+}
+
+func TestTTLCache_CancelledCaller(t *testing.T) {
+	c, _ := newTestTTLCache(nil)
+	loading, release := make(chan struct{}), make(chan struct{})
+	load := func(ctx context.Context, keys []string) (map[string]int32, error) {
+		close(loading)
+		select {
+		case <-release:
+			return map[string]int32{"a": 1}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := c.getMany(ctx, []string{"a"}, load)
+		first <- err
+	}()
+	<-loading
+	second := make(chan map[string]int32)
+	go func() {
+		values, err := c.getMany(context.Background(), []string{"a"}, load)
+		require.NoError(t, err)
+		second <- values
+	}()
+
+	// The first caller gives up, the load goes on for the second one.
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	require.Equal(t, map[string]int32{"a": 1}, <-second)
+}
+
+func TestTTLCache_Get(t *testing.T) {
+	c := newTTLCache[[]string](time.Minute, 0, nil)
+	var calls int
+	load := func(context.Context) ([]string, error) {
+		calls++
+		return []string{"ATOM"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		names, err := c.get(context.Background(), cnsCacheKey, load)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ATOM"}, names)
+	}
+	require.Equal(t, 1, calls)
+}
+
+func TestTTLCache_Update(t *testing.T) {
+	ctx := context.Background()
+	c, clock := newTestTTLCache(nil)
+	src := &counter{version: 1}
+
+	_, err := c.getMany(ctx, []string{"a", "b"}, src.load)
+	require.NoError(t, err)
+
+	// Updated in place, and fresh again.
+	clock.Add(4 * time.Second)
+	updated := c.update([]string{"a", "unknown"}, func(_ string, v int32) int32 { return v + 10 })
+	require.Equal(t, map[string]int32{"a": 11}, updated)
+	clock.Add(4 * time.Second)
+	values, err := c.getMany(ctx, []string{"a"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"a": 11}, values)
+	require.EqualValues(t, 1, atomic.LoadInt32(&src.calls))
+
+	// A load that started before the update is not cached.
+	loading, release := make(chan struct{}), make(chan struct{})
+	slow := func(_ context.Context, keys []string) (map[string]int32, error) {
+		close(loading)
+		<-release
+		return map[string]int32{"c": 1}, nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		values, err := c.getMany(ctx, []string{"c"}, slow)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int32{"c": 1}, values)
+	}()
+	<-loading
+	require.Empty(t, c.update([]string{"c"}, func(_ string, v int32) int32 { return v }))
+	close(release)
+	<-done
+	atomic.StoreInt32(&src.version, 2)
+	values, err = c.getMany(ctx, []string{"c"}, src.load)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int32{"c": 2}, values)
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gecko "github.com/superoo7/go-gecko/v3"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/types"
+)
+
+// Warmup loads the CNS data, the gecko ids and the spot prices of the
+// whitelisted tokens and fiats in the caches, so that the first requests
+// after a start do not all miss them.
+func (h *Handler) Warmup(ctx context.Context) error {
+	tokens, err := h.GetCNSWhitelistedTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("warmup whitelisted tokens: %w", err)
+	}
+	if _, err := h.GetGeckoIdForTokenNames(ctx, nil); err != nil {
+		return fmt.Errorf("warmup gecko ids: %w", err)
+	}
+
+	tokenSymbols := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		tokenSymbols = append(tokenSymbols, token+types.USDT)
+	}
+	if _, err := h.GetTokenPriceAndSupplies(ctx, tokenSymbols); err != nil {
+		return fmt.Errorf("warmup token prices: %w", err)
+	}
+
+	fiatSymbols := make([]string, 0, len(h.Cfg.WhitelistedFiats))
+	for _, fiat := range h.Cfg.WhitelistedFiats {
+		fiatSymbols = append(fiatSymbols, types.USD+fiat)
+	}
+	if _, err := h.GetFiatPrices(ctx, fiatSymbols); err != nil {
+		return fmt.Errorf("warmup fiat prices: %w", err)
+	}
+
+	h.Logger.Infow("Warmup", "tokens", len(tokenSymbols), "fiats", len(fiatSymbols))
+	return nil
+}
+
+// PrefetchCharts refreshes the cached charts among the n most requested ones
+// that expire within lead, so that they are not missed when they expire.
+// Charts that are not cached are left alone. It returns how many charts were
+// refreshed.
+func (h *Handler) PrefetchCharts(ctx context.Context, n int, lead time.Duration, geckoClient *gecko.Client) int {
+	refreshed := 0
+	for _, req := range h.ChartCache.mostRequested(n) {
+		expiresIn, ok := h.ChartCache.expiresIn(req.granularity, req.coinIDCurrency())
+		if !ok || expiresIn > lead {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return refreshed
+		case res := <-h.fetchChartData(req, geckoClient, true):
+			if res.Err != nil {
+				h.Logger.Warnw("PrefetchCharts", "chart", req.key(), "error", res.Err)
+				continue
+			}
+			refreshed++
+		}
+	}
+	return refreshed
+}
+
+// StartChartPrefetch runs PrefetchCharts every Cfg.ChartPrefetchInterval for
+// the Cfg.ChartPrefetchCount most requested charts, until ctx is done.
+func StartChartPrefetch(ctx context.Context, storeHandler *Handler, geckoClient *gecko.Client) {
+	interval := storeHandler.Cfg.ChartPrefetchInterval
+	if interval <= 0 || storeHandler.Cfg.ChartPrefetchCount <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// A chart is refreshed when it would expire before the next round is
+		// done.
+		refreshed := storeHandler.PrefetchCharts(ctx, storeHandler.Cfg.ChartPrefetchCount, 2*interval, geckoClient)
+		if refreshed > 0 {
+			storeHandler.Logger.Debugw("PrefetchCharts", "refreshed", refreshed)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package store_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	gecko "github.com/superoo7/go-gecko/v3"
+	geckoTypes "github.com/superoo7/go-gecko/v3/types"
+
+	"github.com/emerishq/emeris-price-oracle/price-oracle/config"
+	"github.com/emerishq/emeris-price-oracle/price-oracle/store"
+)
+
+func TestWarmup(t *testing.T) {
+	ctx := context.Background()
+	h, db := newMemoryHandler(t,
+		store.WithConfig(&config.Config{WhitelistedFiats: []string{"EUR"}}),
+		store.WithSpotPriceCache(&store.TokenAndFiatCache{RefreshInterval: time.Minute}),
+	)
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 10, "ATOMUSDT"))
+	require.NoError(t, db.UpsertPrice(ctx, store.FiatsStore, 0.9, "USDEUR"))
+
+	require.NoError(t, h.Warmup(ctx))
+
+	// Served from the caches.
+	require.NoError(t, db.UpsertPrice(ctx, store.TokensStore, 11, "ATOMUSDT"))
+	require.NoError(t, db.UpsertPrice(ctx, store.FiatsStore, 0.8, "USDEUR"))
+	tokens, err := h.GetTokenPriceAndSupplies(ctx, []string{"ATOMUSDT"})
+	require.NoError(t, err)
+	require.Equal(t, 10.0, tokens[0].Price)
+	fiats, err := h.GetFiatPrices(ctx, []string{"USDEUR"})
+	require.NoError(t, err)
+	require.Equal(t, 0.9, fiats[0].Price)
+	ids, err := h.GetGeckoIdForTokenNames(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"atom": "cosmos"}, ids)
+}
+
+func TestPrefetchCharts(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newMemoryHandler(t, store.WithChartDataCache(&store.ChartDataCache{
+		TTLs: map[string]time.Duration{store.GranularityMinute: time.Minute},
+	}, 0))
+
+	var version int32
+	fetched := map[string]int{}
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		fetched[req.URL.Path]++
+		return chartResponse(t, generateChartData(2, 0, float32(atomic.LoadInt32(&version))))
+	}, time.Second))
+	get := func(coinId string) *geckoTypes.CoinsIDMarketChart {
+		chartData, err := h.GetChartData(ctx, coinId, "1", "usd", geckoClient)
+		require.NoError(t, err)
+		return chartData
+	}
+	for i := 0; i < 3; i++ {
+		get("bitcoin")
+	}
+	get("cosmos")
+	require.Len(t, fetched, 2)
+
+	// Not about to expire.
+	require.Zero(t, h.PrefetchCharts(ctx, 10, time.Second, geckoClient))
+
+	// Only the most requested chart is refreshed.
+	atomic.StoreInt32(&version, 1)
+	require.Equal(t, 1, h.PrefetchCharts(ctx, 1, time.Hour, geckoClient))
+	require.Equal(t, generateChartData(2, 0, 1), get("bitcoin"))
+	require.Equal(t, generateChartData(2, 0, 0), get("cosmos"))
+	require.Equal(t, 2, fetched["/api/v3/coins/bitcoin/market_chart"])
+	require.Equal(t, 1, fetched["/api/v3/coins/cosmos/market_chart"])
+}
+
+func TestPrefetchCharts_OnlyServedCharts(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newMemoryHandler(t, store.WithChartDataCache(nil, 0))
+
+	fetched := map[string]int{}
+	geckoClient := gecko.NewClient(newTestClient(func(req *http.Request) *http.Response {
+		fetched[req.URL.Path]++
+		if req.URL.Path == "/api/v3/coins/unknown/market_chart" {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}
+		}
+		return chartResponse(t, generateChartData(2, 0, 0))
+	}, time.Second))
+	for i := 0; i < 3; i++ {
+		_, err := h.GetChartData(ctx, "unknown", "1", "usd", geckoClient)
+		require.Error(t, err)
+	}
+	_, err := h.GetChartData(ctx, "bitcoin", "1", "usd", geckoClient)
+	require.NoError(t, err)
+
+	// The failing chart was never served, so the served one is the most
+	// requested.
+	require.Equal(t, 1, h.PrefetchCharts(ctx, 1, time.Hour, geckoClient))
+	require.Equal(t, 1, fetched["/api/v3/coins/unknown/market_chart"])
+	require.Equal(t, 2, fetched["/api/v3/coins/bitcoin/market_chart"])
+}
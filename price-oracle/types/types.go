@@ -18,7 +18,16 @@ type AllPriceResponse struct {
 type TokenPriceAndSupply struct {
 	Symbol string  `db:"symbol"`
 	Price  float64 `db:"price"`
-	Supply float64 `db:"supply"`
+	// Supply is the supply of the token from its configured source, Coingecko
+	// circulating supply or on-chain supply. It is nil when unknown.
+	Supply *float64 `db:"supply"`
+	// CirculatingSupply, TotalSupply and MaxSupply come from Coingecko,
+	// OnChainSupply is the total supply of the bank module of the chain of the
+	// token. They are nil when unknown.
+	CirculatingSupply *float64 `db:"circulatingsupply"`
+	TotalSupply       *float64 `db:"totalsupply"`
+	MaxSupply         *float64 `db:"maxsupply"`
+	OnChainSupply     *float64 `db:"onchainsupply"`
 }
 type FiatPrice struct {
 	Symbol string  `db:"symbol"`
@@ -31,6 +40,125 @@ type Prices struct {
 	UpdatedAt int64   `db:"updatedat"`
 }
 
+// TokenSupply is a row of a provider supply table, e.g. oracle.coingeckosupply.
+// Supply is the circulating supply. TotalSupply and MaxSupply are nil when
+// unknown.
+type TokenSupply struct {
+	Symbol      string   `db:"symbol"`
+	Supply      float64  `db:"supply"`
+	TotalSupply *float64 `db:"totalsupply"`
+	MaxSupply   *float64 `db:"maxsupply"`
+}
+
+// ChainSupply is the total supply of a token according to the bank module of
+// its chain, in display units (ATOM, not uatom). Denom is the base denom it was
+// read for, e.g. uatom.
+type ChainSupply struct {
+	Symbol    string  `db:"symbol"`
+	ChainName string  `db:"chainname"`
+	Denom     string  `db:"denom"`
+	Supply    float64 `db:"supply"`
+	UpdatedAt int64   `db:"updatedat"`
+}
+
+// ChainDenom is a denom of a CNS chain. Endpoint is the Cosmos SDK REST API
+// (LCD) of the chain, from its CNS public node endpoints. Name is the base
+// denom, e.g. uatom, and Precision its number of decimals.
+type ChainDenom struct {
+	ChainName  string
+	Endpoint   string
+	Name       string
+	Ticker     string
+	Precision  int64
+	FetchPrice bool
+}
+
+// TokenMarket is the USD market data of a token from Coingecko. Volume, high,
+// low and changes are over the last 24 hours. UpdatedAt is a unix timestamp in
+// seconds.
+type TokenMarket struct {
+	Symbol                   string  `db:"symbol" json:"symbol"`
+	MarketCap                float64 `db:"marketcap" json:"market_cap"`
+	Volume24h                float64 `db:"volume24h" json:"volume_24h"`
+	High24h                  float64 `db:"high24h" json:"high_24h"`
+	Low24h                   float64 `db:"low24h" json:"low_24h"`
+	PriceChange24h           float64 `db:"pricechange24h" json:"price_change_24h"`
+	PriceChangePercentage24h float64 `db:"pricechangepercentage24h" json:"price_change_percentage_24h"`
+	UpdatedAt                int64   `db:"updatedat" json:"updated_at"`
+}
+
+// HistoricalPrice is one sample of the local price history. Symbols follow the
+// oracle.tokens and oracle.fiats conventions, ATOMUSDT for a token and USDEUR
+// for a fiat, so values are USD denominated or a USD rate. UpdatedAt is a unix
+// timestamp in seconds.
+type HistoricalPrice struct {
+	Symbol    string  `db:"symbol"`
+	Price     float64 `db:"price"`
+	MarketCap float64 `db:"marketcap"`
+	Volume    float64 `db:"volume"`
+	UpdatedAt int64   `db:"updatedat"`
+}
+
+// PriceAt is the price of a symbol at a past point in time. Timestamp is the
+// time of the sample the price comes from, Offset its distance in seconds to
+// the requested time (negative when the sample is older). Source is either
+// "local" or "coingecko".
+type PriceAt struct {
+	Symbol    string  `json:"symbol"`
+	Price     float64 `json:"price"`
+	Timestamp int64   `json:"timestamp"`
+	Offset    int64   `json:"offset"`
+	Source    string  `json:"source"`
+}
+
+// Candle is an OHLC candle. Time is the unix timestamp (seconds) at which the
+// candle starts.
+type Candle struct {
+	Time   int64   `json:"time"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume float64 `json:"volume"`
+}
+
+// BackfillProgress is how far the backfill of the price history of Symbol,
+// between From and To, went. The history up to DoneUntil is written, the
+// backfill is complete when DoneUntil reaches To. Times are unix seconds.
+type BackfillProgress struct {
+	Symbol    string `db:"symbol" json:"symbol"`
+	GeckoID   string `db:"geckoid" json:"gecko_id"`
+	From      int64  `db:"fromts" json:"from"`
+	To        int64  `db:"tots" json:"to"`
+	DoneUntil int64  `db:"doneuntil" json:"done_until"`
+	UpdatedAt int64  `db:"updatedat" json:"updated_at"`
+}
+
+// Kinds of AuditEntry.
+const (
+	AuditQuote    = "quote"
+	AuditInput    = "input"
+	AuditRejected = "rejected"
+	AuditOutput   = "output"
+)
+
+// AuditEntry is a row of the append-only price audit log. An AuditQuote is a
+// raw quote written by the provider Source, e.g. oracle.binance. An
+// aggregation of a symbol is recorded as AuditInput and AuditRejected entries,
+// the quotes of Source it used or rejected for Reason, and an AuditOutput
+// entry, the price it wrote in Source, e.g. oracle.tokens. All the entries of
+// an aggregation have the same CreatedAt. QuotedAt is the time of a quote
+// according to its provider. Times are unix seconds.
+type AuditEntry struct {
+	Symbol    string  `db:"symbol" json:"symbol"`
+	CreatedAt int64   `db:"createdat" json:"created_at"`
+	Kind      string  `db:"kind" json:"kind"`
+	Source    string  `db:"source" json:"source"`
+	Price     float64 `db:"price" json:"price"`
+	QuotedAt  int64   `db:"quotedat" json:"quoted_at,omitempty"`
+	Reason    string  `db:"reason" json:"reason,omitempty"`
+}
+
 type Tokens struct {
 	Tokens []string `json:"tokens"`
 }